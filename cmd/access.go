@@ -0,0 +1,505 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/spf13/cobra"
+)
+
+const docUnderstandingRoles = "https://cloud.google.com/iam/docs/understanding-roles"
+
+var (
+	accessWorkload     string
+	accessNamespace    string
+	accessResource     string
+	accessPermission   string
+	accessTroubleshoot bool
+)
+
+// accessCmd represents the access command
+var accessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Checks whether a workload's identity has a permission on a Google Cloud resource.",
+	Long: `Resolves the identity a workload authenticates as (the annotated GSA, or the KSA principal itself),
+then reads the IAM policy of the resource and of its project, folders and organization, expands every
+role granted to that identity into its permissions and reports whether the permission is granted, and by
+which binding. Deny policies attached to the project, folders and organization override any grant.
+
+Supported resources (full resource names):
+	//cloudresourcemanager.googleapis.com/projects/PROJECT_ID
+	//cloudresourcemanager.googleapis.com/folders/FOLDER_ID
+	//cloudresourcemanager.googleapis.com/organizations/ORG_ID
+	//storage.googleapis.com/projects/_/buckets/BUCKET
+	//iam.googleapis.com/projects/PROJECT_ID/serviceAccounts/EMAIL
+
+With --troubleshoot, the IAM Policy Troubleshooter API is asked the same question and its
+explanation is included in the report. It accepts any resource type it supports.`,
+	Example: `  gke-wif-troubleshooter check access --workload deploy/frontend -n web \
+    --resource //storage.googleapis.com/projects/_/buckets/assets \
+    --permission storage.objects.get \
+    --project my-project --location us-central1 --cluster my-cluster`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		kind, name, ok := strings.Cut(accessWorkload, "/")
+		if !ok || kind == "" || name == "" {
+			log.Fatalf("❌ --workload must be of the form <type>/<name>, e.g. deploy/frontend")
+		}
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		clientset, err := getK8sClientset(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		podSpec, err := getPodSpecFromWorkload(ctx, clientset, accessNamespace, name, kind)
+		if err != nil {
+			log.Fatalf("❌ Failed to get KSA from workload: %v", err)
+		}
+		ksaName := ksaFromPodSpec(*podSpec)
+
+		workload := workloadRef{Kind: canonicalWorkloadKind(kind), Namespace: accessNamespace, Name: name}
+		if err := resolveWorkloadOwner(ctx, clientset, &workload); err != nil {
+			log.Printf("⚠️  Could not find the owner of workload %s: %v", workload, err)
+		}
+
+		report, err := performKsaCheck(ctx, clients, accessNamespace, ksaName, cluster, clientset)
+		report.Workload = &workload
+		// The permission question only makes sense once the workload's identity is known.
+		if err == nil {
+			report.add(checkAccess(ctx, clients, report, accessResource, accessPermission))
+			if accessTroubleshoot {
+				report.add(checkPolicyTroubleshooter(ctx, clients, report, accessResource, accessPermission))
+			}
+		}
+		if outErr := writeOutput(os.Stdout, outputFormat, report); outErr != nil {
+			log.Fatalf("❌ Failed to write report: %v", outErr)
+		}
+		if err != nil {
+			log.Fatalf("❌ Check failed for KSA '%s': %v", ksaName, err)
+		}
+		if report.Access != nil && !report.Access.Granted {
+			log.Fatalf("❌ %s is not granted '%s' on '%s'.", report.Access.Identity, accessPermission, accessResource)
+		}
+	},
+}
+
+// accessResult answers whether an identity holds a permission on a resource.
+type accessResult struct {
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+	Identity   string `json:"identity"`
+	Granted    bool   `json:"granted"`
+	// GrantedBy lists the bindings that grant the permission to the identity.
+	GrantedBy []grantedBinding `json:"grantedBy,omitempty"`
+	// Unevaluated lists bindings that grant the permission to groups or domains, whose
+	// membership can't be checked.
+	Unevaluated []grantedBinding `json:"unevaluatedBindings,omitempty"`
+	// DeniedBy lists the deny rules that block the permission, overriding any grant.
+	DeniedBy           []deniedRule `json:"deniedBy,omitempty"`
+	UnreadablePolicies []string     `json:"unreadablePolicies,omitempty"`
+	UnresolvedRoles    []string     `json:"unresolvedRoles,omitempty"`
+}
+
+// resourcePolicy is an IAM policy and the resource it's attached to.
+type resourcePolicy struct {
+	Resource string
+	Policy   *iampb.Policy
+}
+
+// accessTarget is a parsed full resource name.
+type accessTarget struct {
+	// Kind is one of project, folder, organization, bucket or serviceAccount.
+	Kind string
+	// ID is the project ID, folder or organization number, bucket name or service account email.
+	ID string
+	// Project is the project that owns a service account, if known.
+	Project string
+}
+
+// parseAccessTarget parses the full resource names check access supports.
+func parseAccessTarget(fullName string) (accessTarget, error) {
+	service, path, ok := strings.Cut(strings.TrimPrefix(fullName, "//"), "/")
+	if !ok || !strings.HasPrefix(fullName, "//") {
+		return accessTarget{}, fmt.Errorf("'%s' is not a full resource name, e.g. //storage.googleapis.com/projects/_/buckets/my-bucket", fullName)
+	}
+	parts := strings.Split(path, "/")
+
+	switch {
+	case service == "cloudresourcemanager.googleapis.com" && len(parts) == 2 && parts[1] != "":
+		switch parts[0] {
+		case "projects":
+			return accessTarget{Kind: "project", ID: parts[1]}, nil
+		case "folders":
+			return accessTarget{Kind: "folder", ID: parts[1]}, nil
+		case "organizations":
+			return accessTarget{Kind: "organization", ID: parts[1]}, nil
+		}
+	case service == "storage.googleapis.com" && len(parts) == 4 && parts[0] == "projects" && parts[2] == "buckets" && parts[3] != "":
+		return accessTarget{Kind: "bucket", ID: parts[3]}, nil
+	case service == "iam.googleapis.com" && len(parts) == 4 && parts[0] == "projects" && parts[2] == "serviceAccounts" && parts[3] != "":
+		project := parts[1]
+		if project == "-" {
+			project = gsaProject(parts[3])
+		}
+		return accessTarget{Kind: "serviceAccount", ID: parts[3], Project: project}, nil
+	}
+	return accessTarget{}, fmt.Errorf("unsupported resource '%s'; run 'check access --help' for the supported resource types", fullName)
+}
+
+// gatherAccessPolicies reads the policy attached to the target and to each of its ancestors,
+// nearest first. Failing to read the target's own policy is an error; unreadable ancestors are
+// returned so the caller can report the gap.
+func gatherAccessPolicies(ctx context.Context, clients *gcpClients, target accessTarget) ([]resourcePolicy, []string, error) {
+	var policies []resourcePolicy
+	var unreadable []string
+
+	// ancestorsOf is the resource whose hierarchy is walked after the target's own policy.
+	var ancestorsOf string
+	switch target.Kind {
+	case "project":
+		ancestorsOf = "projects/" + target.ID
+	case "folder":
+		ancestorsOf = "folders/" + target.ID
+	case "organization":
+		ancestorsOf = "organizations/" + target.ID
+	case "bucket":
+		policy, err := clients.buckets.GetBucketIamPolicy(ctx, target.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get IAM policy for bucket '%s': %w", target.ID, err)
+		}
+		policies = append(policies, resourcePolicy{Resource: "buckets/" + target.ID, Policy: policy})
+		number, err := clients.buckets.GetBucketProjectNumber(ctx, target.ID)
+		if err != nil {
+			return policies, []string{"project of bucket " + target.ID}, nil
+		}
+		ancestorsOf = "projects/" + number
+	case "serviceAccount":
+		policy, err := clients.iam.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: gsaPolicyResource(target.ID),
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get IAM policy for service account '%s': %w", target.ID, err)
+		}
+		policies = append(policies, resourcePolicy{Resource: gsaPolicyResource(target.ID), Policy: policy.InternalProto})
+		if target.Project == "" {
+			return policies, []string{"project of service account " + target.ID}, nil
+		}
+		ancestorsOf = "projects/" + target.Project
+	}
+
+	ancestry, err := resourceAncestry(ctx, clients, ancestorsOf)
+	if err != nil {
+		unreadable = append(unreadable, "ancestors of "+ancestry[len(ancestry)-1])
+	}
+	for _, resource := range ancestry {
+		policy, err := getResourcePolicy(ctx, clients, resource)
+		if err != nil {
+			// The target's own policy is required; its ancestors are best effort.
+			if len(policies) == 0 {
+				return nil, nil, fmt.Errorf("failed to get IAM policy for '%s': %w", resource, err)
+			}
+			unreadable = append(unreadable, resource)
+			continue
+		}
+		policies = append(policies, resourcePolicy{Resource: resource, Policy: policy})
+	}
+	return policies, unreadable, nil
+}
+
+// accessSubject is the identity a workload authenticates as.
+type accessSubject struct {
+	// Identity describes the subject, e.g. its IAM member.
+	Identity string
+	// Member is what to grant roles to.
+	Member  string
+	matches func(member string) bool
+	// ksa and gsa identify the subject to deny policies, which use their own principal identifiers.
+	ksa ksaIdentity
+	gsa string
+}
+
+// denyMember returns the subject's identifier in deny policies.
+func (s accessSubject) denyMember() string {
+	if s.gsa != "" {
+		return gsaDenyPrincipal(s.gsa)
+	}
+	return s.Member
+}
+
+// accessSubjectFor returns the identity of the KSA a report was produced for: the annotated GSA
+// when there is one, the KSA principal otherwise.
+func accessSubjectFor(report *ksaReport) accessSubject {
+	if report.GSA != "" {
+		member := "serviceAccount:" + report.GSA
+		return accessSubject{
+			Identity: member,
+			Member:   member,
+			matches:  func(m string) bool { return m == member },
+			gsa:      report.GSA,
+		}
+	}
+	identity := report.identity()
+	return accessSubject{
+		Identity: fmt.Sprintf("KSA principal %s/%s", report.KSA.Namespace, report.KSA.Name),
+		Member:   report.principal(),
+		matches:  func(m string) bool { return principalAppliesTo(m, identity) },
+		ksa:      identity,
+	}
+}
+
+// evaluateAccess looks for bindings that grant permission to the subject. Roles are only expanded
+// for bindings that could apply, so the number of GetRole calls stays small.
+func evaluateAccess(ctx context.Context, clients *gcpClients, policies []resourcePolicy, subject accessSubject, permission string, env conditionEnv) *accessResult {
+	result := &accessResult{Permission: permission, Identity: subject.Identity}
+
+	for _, rp := range policies {
+		for _, binding := range rp.Policy.GetBindings() {
+			matched := ""
+			var groups []string
+			for _, m := range binding.Members {
+				switch {
+				case matched == "" && (subject.matches(m) || m == "allUsers" || m == "allAuthenticatedUsers"):
+					matched = m
+				case strings.HasPrefix(m, "group:") || strings.HasPrefix(m, "domain:"):
+					groups = append(groups, m)
+				}
+			}
+			if matched == "" && len(groups) == 0 {
+				continue
+			}
+
+			permissions, err := clients.rolePermissions(ctx, binding.Role)
+			if err != nil {
+				if !slices.Contains(result.UnresolvedRoles, binding.Role) {
+					result.UnresolvedRoles = append(result.UnresolvedRoles, binding.Role)
+				}
+				continue
+			}
+			if !slices.Contains(permissions, permission) {
+				continue
+			}
+
+			if matched != "" {
+				result.GrantedBy = append(result.GrantedBy, newGrantedBinding(binding, matched, rp.Resource, env))
+				continue
+			}
+			for _, g := range groups {
+				result.Unevaluated = append(result.Unevaluated, newGrantedBinding(binding, g, rp.Resource, env))
+			}
+		}
+	}
+	// Bindings whose condition is known to be false grant nothing.
+	result.Granted = slices.ContainsFunc(result.GrantedBy, func(b grantedBinding) bool { return b.ConditionHolds != conditionFalse })
+	return result
+}
+
+// conditionEnv returns the attributes IAM conditions can test for a request on the target.
+// Resource attributes are only known when the permission applies to the target itself: a
+// storage.objects.get request on a bucket's policy is evaluated against the object.
+func (t accessTarget) conditionEnv(now time.Time, permission string) conditionEnv {
+	env := conditionEnv{now: now}
+	switch {
+	case t.Kind == "project" && strings.HasPrefix(permission, "resourcemanager.projects."):
+		env.resourceType, env.resourceService = "cloudresourcemanager.googleapis.com/Project", "cloudresourcemanager.googleapis.com"
+	case t.Kind == "folder" && strings.HasPrefix(permission, "resourcemanager.folders."):
+		env.resourceType, env.resourceService = "cloudresourcemanager.googleapis.com/Folder", "cloudresourcemanager.googleapis.com"
+	case t.Kind == "organization" && strings.HasPrefix(permission, "resourcemanager.organizations."):
+		env.resourceType, env.resourceService = "cloudresourcemanager.googleapis.com/Organization", "cloudresourcemanager.googleapis.com"
+	case t.Kind == "bucket" && strings.HasPrefix(permission, "storage.buckets."):
+		env.resourceName = "projects/_/buckets/" + t.ID
+		env.resourceType, env.resourceService = "storage.googleapis.com/Bucket", "storage.googleapis.com"
+	case t.Kind == "serviceAccount" && strings.HasPrefix(permission, "iam.serviceAccounts."):
+		env.resourceType, env.resourceService = "iam.googleapis.com/ServiceAccount", "iam.googleapis.com"
+	}
+	return env
+}
+
+// accessRemediation returns the gcloud command that grants a role on the target.
+func accessRemediation(target accessTarget, member, permission string) string {
+	var command string
+	switch target.Kind {
+	case "project":
+		command = addIamPolicyBindingCommand("projects/" + target.ID)
+	case "folder":
+		command = addIamPolicyBindingCommand("folders/" + target.ID)
+	case "organization":
+		command = addIamPolicyBindingCommand("organizations/" + target.ID)
+	case "bucket":
+		command = "gcloud storage buckets add-iam-policy-binding gs://" + target.ID
+	case "serviceAccount":
+		command = "gcloud iam service-accounts add-iam-policy-binding " + target.ID
+	}
+	return fmt.Sprintf("Grant a role that includes '%s', for example:\n%s \\\n  --member=\"%s\" \\\n  --role=ROLE_NAME", permission, command, member)
+}
+
+// checkAccess answers whether the identity of the report's KSA holds permission on the resource.
+func checkAccess(ctx context.Context, clients *gcpClients, report *ksaReport, resource, permission string) checkResult {
+	subject := accessSubjectFor(report)
+	result := checkResult{
+		ID:       checkAccessPermission,
+		Title:    fmt.Sprintf("Checking whether %s has '%s' on '%s'", subject.Identity, permission, resource),
+		Severity: severityHigh,
+		DocLink:  docUnderstandingRoles,
+	}
+
+	target, err := parseAccessTarget(resource)
+	if err != nil {
+		result.Status = statusFail
+		result.Message = err.Error()
+		return result
+	}
+	policies, unreadable, err := gatherAccessPolicies(ctx, clients, target)
+	if err != nil {
+		result.Status = statusFail
+		result.Message = err.Error()
+		return result
+	}
+
+	access := evaluateAccess(ctx, clients, policies, subject, permission, target.conditionEnv(time.Now(), permission))
+	access.Resource = resource
+
+	// A deny rule overrides every grant. Deny policies can only be attached to projects, folders
+	// and organizations.
+	var denyResources []string
+	for _, rp := range policies {
+		if strings.Count(rp.Resource, "/") == 1 && (strings.HasPrefix(rp.Resource, "projects/") || strings.HasPrefix(rp.Resource, "folders/") || strings.HasPrefix(rp.Resource, "organizations/")) {
+			denyResources = append(denyResources, rp.Resource)
+		}
+	}
+	denials, denyUnreadable := gatherDenyRules(ctx, clients, denyResources, subject.ksa, subject.gsa)
+	for _, r := range denials {
+		if r.denies(permission) {
+			access.DeniedBy = append(access.DeniedBy, r)
+		}
+	}
+	for _, r := range denyUnreadable {
+		unreadable = append(unreadable, "deny policies on "+r)
+	}
+	access.UnreadablePolicies = unreadable
+	report.Access = access
+
+	var checked []string
+	for _, rp := range policies {
+		checked = append(checked, rp.Resource)
+	}
+	result.Evidence = map[string]string{
+		"identity":        subject.Identity,
+		"policiesChecked": strings.Join(checked, " → "),
+	}
+	if len(unreadable) > 0 {
+		result.Evidence["unreadablePolicies"] = strings.Join(unreadable, ", ")
+	}
+	if len(access.UnresolvedRoles) > 0 {
+		result.Evidence["unresolvedRoles"] = strings.Join(access.UnresolvedRoles, ", ")
+	}
+
+	var denied []string
+	var definitelyDenied *deniedRule
+	for i, r := range access.DeniedBy {
+		denied = append(denied, r.String())
+		if definitelyDenied == nil && r.Condition == "" && len(r.UnevaluatedExceptions) == 0 {
+			definitelyDenied = &access.DeniedBy[i]
+		}
+	}
+	if len(denied) > 0 {
+		result.Evidence["deniedBy"] = strings.Join(denied, "; ")
+	}
+	if access.Granted && definitelyDenied != nil {
+		access.Granted = false
+		result.Status = statusFail
+		result.Message = fmt.Sprintf("No. '%s' is granted, but a deny policy blocks it:\n      - %s", permission, strings.Join(denied, "\n      - "))
+		result.Remediation = denyRemediation(*definitelyDenied, subject.denyMember())
+		return result
+	}
+
+	var granted []string
+	for _, b := range access.GrantedBy {
+		granted = append(granted, b.String())
+	}
+	if len(granted) > 0 {
+		result.Evidence["grantedBy"] = strings.Join(granted, "; ")
+	}
+
+	if access.Granted {
+		result.Status = statusPass
+		result.Message = fmt.Sprintf("Yes. '%s' is granted by:\n      - %s", permission, strings.Join(granted, "\n      - "))
+		if !slices.ContainsFunc(access.GrantedBy, grantedBinding.effective) {
+			result.Status = statusWarn
+			result.DocLink = docConditions
+			result.Message += "\n    Every granting binding is conditional and no condition could be proven true; the permission only applies when one of them holds."
+		}
+		if len(denied) > 0 {
+			result.Status = statusWarn
+			result.Message += fmt.Sprintf("\n    A deny policy may still block it, depending on its condition or exception principals:\n      - %s", strings.Join(denied, "\n      - "))
+		}
+		return result
+	}
+
+	result.Status = statusFail
+	result.Message = fmt.Sprintf("No. None of the policies on '%s' or its ancestors grant '%s' to %s.", resource, permission, subject.Identity)
+	if len(access.GrantedBy) > 0 {
+		result.DocLink = docConditions
+		result.Message += fmt.Sprintf(" Bindings that would grant it are conditional and their condition is false:\n      - %s", strings.Join(granted, "\n      - "))
+	}
+	if len(access.Unevaluated) > 0 {
+		var groups []string
+		for _, b := range access.Unevaluated {
+			groups = append(groups, b.String())
+		}
+		result.Status = statusWarn
+		result.Message += fmt.Sprintf(" The permission is granted to groups or domains whose membership could not be checked:\n      - %s", strings.Join(groups, "\n      - "))
+	}
+	if len(unreadable) > 0 || len(access.UnresolvedRoles) > 0 {
+		result.Status = statusWarn
+		result.Message += " Some policies or roles could not be read, so the answer may be incomplete."
+	}
+	result.Remediation = accessRemediation(target, subject.Member, permission)
+	return result
+}
+
+func init() {
+	checkCmd.AddCommand(accessCmd)
+	accessCmd.Flags().StringVar(&accessWorkload, "workload", "", "Workload to check, as <type>/<name> (e.g. deploy/frontend)")
+	accessCmd.Flags().StringVarP(&accessNamespace, "namespace", "n", "default", "Kubernetes namespace of the workload")
+	accessCmd.Flags().StringVar(&accessResource, "resource", "", "Full resource name, e.g. //storage.googleapis.com/projects/_/buckets/my-bucket")
+	accessCmd.Flags().StringVar(&accessPermission, "permission", "", "IAM permission to check, e.g. storage.objects.get")
+	accessCmd.Flags().BoolVar(&accessTroubleshoot, "troubleshoot", false, "Also ask the IAM Policy Troubleshooter API to explain the result (requires an annotated GSA)")
+	accessCmd.MarkFlagRequired("workload")
+	accessCmd.MarkFlagRequired("resource")
+	accessCmd.MarkFlagRequired("permission")
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeBuckets serves bucket policies and owning project numbers from memory.
+type fakeBuckets struct {
+	policies map[string]*iampb.Policy
+	projects map[string]string
+}
+
+func (f *fakeBuckets) GetBucketIamPolicy(ctx context.Context, bucket string) (*iampb.Policy, error) {
+	policy, ok := f.policies[bucket]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "bucket %s not found", bucket)
+	}
+	return policy, nil
+}
+
+func (f *fakeBuckets) GetBucketProjectNumber(ctx context.Context, bucket string) (string, error) {
+	return f.projects[bucket], nil
+}
+
+func TestParseAccessTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    accessTarget
+		wantErr bool
+	}{
+		{"//cloudresourcemanager.googleapis.com/projects/my-project", accessTarget{Kind: "project", ID: "my-project"}, false},
+		{"//cloudresourcemanager.googleapis.com/folders/123", accessTarget{Kind: "folder", ID: "123"}, false},
+		{"//cloudresourcemanager.googleapis.com/organizations/456", accessTarget{Kind: "organization", ID: "456"}, false},
+		{"//storage.googleapis.com/projects/_/buckets/assets", accessTarget{Kind: "bucket", ID: "assets"}, false},
+		{"//iam.googleapis.com/projects/-/serviceAccounts/app@other.iam.gserviceaccount.com", accessTarget{Kind: "serviceAccount", ID: "app@other.iam.gserviceaccount.com", Project: "other"}, false},
+		{"//pubsub.googleapis.com/projects/p/topics/t", accessTarget{}, true},
+		{"projects/my-project", accessTarget{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAccessTarget(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	pool := "test-project.svc.id.goog"
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	principal := "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool + "/subject/ns/web/sa/frontend"
+	bucket := "//storage.googleapis.com/projects/_/buckets/assets"
+
+	newClients := func(bucketPolicy *iampb.Policy, folderPolicy *iampb.Policy) *gcpClients {
+		h := &fakeHierarchy{
+			numbers:  map[string]string{"test-project": "123", "123": "123"},
+			parents:  map[string]string{"projects/123": "folders/7"},
+			policies: map[string]*iampb.Policy{"folders/7": folderPolicy},
+		}
+		return &gcpClients{
+			projects:      h,
+			folders:       h,
+			organizations: h,
+			denyPolicies:  &fakeDenyPolicies{},
+			buckets: &fakeBuckets{
+				policies: map[string]*iampb.Policy{"assets": bucketPolicy},
+				projects: map[string]string{"assets": "123"},
+			},
+			iam: &fakeIamAdmin{roles: map[string][]string{
+				"roles/storage.objectViewer":         {"storage.objects.get", "storage.objects.list"},
+				"roles/storage.objectCreator":        {"storage.objects.create"},
+				"projects/test-project/roles/reader": {"storage.objects.get"},
+			}},
+		}
+	}
+	newReport := func(gsa string) *ksaReport {
+		report := newKsaReport("test-cluster", "us-central1", "web", "frontend")
+		report.Cluster.WorkloadPool = pool
+		report.Cluster.WorkloadPoolProjectNumber = "123"
+		report.GSA = gsa
+		return report
+	}
+
+	t.Run("Granted to GSA on the bucket", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectCreator", Members: []string{"serviceAccount:" + gsa}},
+			{Role: "roles/storage.objectViewer", Members: []string{"serviceAccount:" + gsa}},
+		}}, &iampb.Policy{})
+		report := newReport(gsa)
+
+		result := checkAccess(ctx, clients, report, bucket, "storage.objects.get")
+		assert.Equal(t, statusPass, result.Status)
+		assert.True(t, report.Access.Granted)
+		assert.Equal(t, []grantedBinding{{Role: "roles/storage.objectViewer", Member: "serviceAccount:" + gsa, Resource: "buckets/assets"}}, report.Access.GrantedBy)
+		assert.Equal(t, "buckets/assets → projects/123 → folders/7", result.Evidence["policiesChecked"])
+	})
+
+	t.Run("Granted to namespace via custom role on a folder", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{}, &iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "projects/test-project/roles/reader", Members: []string{"principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool + "/namespace/web"}},
+		}})
+		report := newReport("")
+
+		result := checkAccess(ctx, clients, report, bucket, "storage.objects.get")
+		assert.Equal(t, statusPass, result.Status)
+		assert.Equal(t, "folders/7", report.Access.GrantedBy[0].Resource)
+	})
+
+	t.Run("Only conditionally granted", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{principal}, Condition: &expr.Expr{Expression: "resource.name.startsWith('projects/_/buckets/assets/objects/public/')"}},
+		}}, &iampb.Policy{})
+
+		result := checkAccess(ctx, clients, newReport(""), bucket, "storage.objects.get")
+		assert.Equal(t, statusWarn, result.Status)
+		assert.Contains(t, result.Message, "conditional")
+	})
+
+	t.Run("Granted only by an expired binding", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{"serviceAccount:" + gsa}, Condition: &expr.Expr{Expression: "request.time < timestamp('2020-01-01T00:00:00Z')"}},
+		}}, &iampb.Policy{})
+		report := newReport(gsa)
+
+		result := checkAccess(ctx, clients, report, bucket, "storage.objects.get")
+		assert.Equal(t, statusFail, result.Status)
+		assert.False(t, report.Access.Granted)
+		assert.Contains(t, result.Message, "[condition is false]")
+	})
+
+	t.Run("Granted by a condition on the bucket name", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{"serviceAccount:" + gsa}, Condition: &expr.Expr{Expression: "resource.name == 'projects/_/buckets/assets'"}},
+		}}, &iampb.Policy{})
+		clients.iam.(*fakeIamAdmin).roles["roles/storage.objectViewer"] = []string{"storage.buckets.get", "storage.objects.get"}
+
+		result := checkAccess(ctx, clients, newReport(gsa), bucket, "storage.buckets.get")
+		assert.Equal(t, statusPass, result.Status)
+		assert.Contains(t, result.Message, "[condition holds]")
+	})
+
+	t.Run("Not granted", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{"serviceAccount:other@test-project.iam.gserviceaccount.com"}},
+		}}, &iampb.Policy{})
+		report := newReport(gsa)
+
+		result := checkAccess(ctx, clients, report, bucket, "storage.objects.get")
+		assert.Equal(t, statusFail, result.Status)
+		assert.False(t, report.Access.Granted)
+		assert.Contains(t, result.Remediation, "gcloud storage buckets add-iam-policy-binding gs://assets")
+		assert.Contains(t, result.Remediation, "--member=\"serviceAccount:"+gsa+"\"")
+	})
+
+	t.Run("Granted to a group", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{"group:readers@example.com"}},
+		}}, &iampb.Policy{})
+
+		result := checkAccess(ctx, clients, newReport(gsa), bucket, "storage.objects.get")
+		assert.Equal(t, statusWarn, result.Status)
+		assert.Contains(t, result.Message, "group:readers@example.com")
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		clients := newClients(&iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/unknown", Members: []string{"serviceAccount:" + gsa}},
+		}}, &iampb.Policy{})
+
+		result := checkAccess(ctx, clients, newReport(gsa), bucket, "storage.objects.get")
+		assert.Equal(t, statusWarn, result.Status)
+		assert.Equal(t, "roles/unknown", result.Evidence["unresolvedRoles"])
+	})
+
+	t.Run("Missing bucket", func(t *testing.T) {
+		result := checkAccess(ctx, newClients(&iampb.Policy{}, &iampb.Policy{}), newReport(gsa), "//storage.googleapis.com/projects/_/buckets/missing", "storage.objects.get")
+		assert.Equal(t, statusFail, result.Status)
+		assert.Contains(t, result.Message, "failed to get IAM policy for bucket 'missing'")
+	})
+}
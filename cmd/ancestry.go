@@ -0,0 +1,169 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+)
+
+// maxAncestryDepth guards against cycles; Resource Manager allows at most 10 levels of folders.
+const maxAncestryDepth = 12
+
+// grantedBinding is a role granted to a member, and the resource the binding is attached to.
+type grantedBinding struct {
+	Role     string `json:"role"`
+	Member   string `json:"member"`
+	Resource string `json:"resource"`
+	// Condition is the CEL expression of a conditional binding.
+	Condition string `json:"condition,omitempty"`
+	// ConditionHolds is the local evaluation of Condition.
+	ConditionHolds conditionVerdict `json:"conditionHolds,omitempty"`
+}
+
+// newGrantedBinding records a binding and evaluates its condition, if any.
+func newGrantedBinding(binding *iampb.Binding, member, resource string, env conditionEnv) grantedBinding {
+	b := grantedBinding{Role: binding.Role, Member: member, Resource: resource, Condition: binding.GetCondition().GetExpression()}
+	if b.Condition != "" {
+		b.ConditionHolds = evaluateCondition(b.Condition, env)
+	}
+	return b
+}
+
+// effective reports whether the binding is known to grant its role: it is unconditional or its
+// condition evaluates to true.
+func (b grantedBinding) effective() bool {
+	return b.Condition == "" || b.ConditionHolds == conditionTrue
+}
+
+func (b grantedBinding) String() string {
+	s := fmt.Sprintf("%s on %s (via %s)", b.Role, b.Resource, b.Member)
+	if b.Condition != "" {
+		s += fmt.Sprintf(" if %s", b.Condition)
+		switch b.ConditionHolds {
+		case conditionTrue:
+			s += " [condition holds]"
+		case conditionFalse:
+			s += " [condition is false]"
+		case conditionUnknown:
+			s += " [condition can't be evaluated locally]"
+		}
+	}
+	return s
+}
+
+// resourceAncestry returns a project, folder or organization followed by its ancestors, nearest
+// first. The resource itself is always returned, even when walking its ancestors fails.
+func resourceAncestry(ctx context.Context, clients *gcpClients, resource string) ([]string, error) {
+	ancestry := []string{resource}
+
+	var parent string
+	switch {
+	case strings.HasPrefix(resource, "projects/"):
+		p, err := clients.getProject(ctx, strings.TrimPrefix(resource, "projects/"))
+		if err != nil {
+			return ancestry, err
+		}
+		parent = p.Parent
+	case strings.HasPrefix(resource, "folders/"):
+		parent = resource
+		ancestry = ancestry[:0]
+	}
+
+	for parent != "" && len(ancestry) < maxAncestryDepth {
+		ancestry = append(ancestry, parent)
+		if !strings.HasPrefix(parent, "folders/") {
+			break
+		}
+		folder, err := clients.getFolder(ctx, parent)
+		if err != nil {
+			return ancestry, err
+		}
+		parent = folder.Parent
+	}
+	return ancestry, nil
+}
+
+// workloadAncestry returns the cluster's project and its ancestors, followed by the GSA's project
+// and its ancestors when the GSA lives elsewhere. Policies attached anywhere in either hierarchy
+// can affect the workload.
+func workloadAncestry(ctx context.Context, clients *gcpClients, report *ksaReport) ([]string, error) {
+	resources, err := resourceAncestry(ctx, clients, "projects/"+projectID)
+	if report.GSAProject != "" && report.GSAProject != projectID {
+		gsaAncestry, gsaErr := resourceAncestry(ctx, clients, "projects/"+report.GSAProject)
+		if err == nil {
+			err = gsaErr
+		}
+		for _, r := range gsaAncestry {
+			if !slices.Contains(resources, r) {
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources, err
+}
+
+// addIamPolicyBindingCommand returns the gcloud command that grants a role on a project, folder
+// or organization.
+func addIamPolicyBindingCommand(resource string) string {
+	kind, id, _ := strings.Cut(resource, "/")
+	switch kind {
+	case "folders":
+		return "gcloud resource-manager folders add-iam-policy-binding " + id
+	case "organizations":
+		return "gcloud organizations add-iam-policy-binding " + id
+	}
+	return "gcloud projects add-iam-policy-binding " + id
+}
+
+// getResourcePolicy fetches the IAM policy attached to a project, folder or organization.
+// Policies are cached for the whole run, as every KSA in a scan shares the same ancestry; callers
+// must not modify them.
+func getResourcePolicy(ctx context.Context, clients *gcpClients, resource string) (*iampb.Policy, error) {
+	return clients.policyCache.get(resource, func() (*iampb.Policy, error) {
+		req := &iampb.GetIamPolicyRequest{
+			Resource: resource,
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+		}
+		switch {
+		case strings.HasPrefix(resource, "projects/"):
+			return clients.projects.GetIamPolicy(ctx, req)
+		case strings.HasPrefix(resource, "folders/"):
+			return clients.folders.GetIamPolicy(ctx, req)
+		case strings.HasPrefix(resource, "organizations/"):
+			return clients.organizations.GetIamPolicy(ctx, req)
+		}
+		return nil, fmt.Errorf("unsupported resource '%s'", resource)
+	})
+}
+
+// bindingsFor returns every binding in the policy that grants a role to the KSA, directly or
+// through a principalSet, with conditions evaluated in env.
+func bindingsFor(policy *iampb.Policy, resource string, id ksaIdentity, env conditionEnv) []grantedBinding {
+	var found []grantedBinding
+	for _, binding := range policy.GetBindings() {
+		for _, m := range binding.Members {
+			if principalAppliesTo(m, id) {
+				found = append(found, newGrantedBinding(binding, m, resource, env))
+			}
+		}
+	}
+	return found
+}
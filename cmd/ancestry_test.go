@@ -0,0 +1,182 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeHierarchy is an in-memory resource hierarchy. It serves as the project, folder and
+// organization client at once: policies and parents are keyed by resource name.
+type fakeHierarchy struct {
+	numbers  map[string]string
+	parents  map[string]string
+	policies map[string]*iampb.Policy
+	denied   map[string]bool
+	// reads counts the calls per method and resource, e.g. "GetFolder folders/1".
+	reads map[string]int
+}
+
+func (f *fakeHierarchy) read(method, resource string) {
+	if f.reads == nil {
+		f.reads = map[string]int{}
+	}
+	f.reads[method+" "+resource]++
+}
+
+func (f *fakeHierarchy) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error) {
+	f.read("GetIamPolicy", req.Resource)
+	if f.denied[req.Resource] {
+		return nil, status.Errorf(codes.PermissionDenied, "permission denied on %s", req.Resource)
+	}
+	if policy, ok := f.policies[req.Resource]; ok {
+		return policy, nil
+	}
+	return &iampb.Policy{}, nil
+}
+
+func (f *fakeHierarchy) GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest, opts ...gax.CallOption) (*resourcemanagerpb.Project, error) {
+	id := strings.TrimPrefix(req.Name, "projects/")
+	number, ok := f.numbers[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "project %s not found", id)
+	}
+	return &resourcemanagerpb.Project{Name: "projects/" + number, ProjectId: id, Parent: f.parents[req.Name]}, nil
+}
+
+func (f *fakeHierarchy) GetFolder(ctx context.Context, req *resourcemanagerpb.GetFolderRequest, opts ...gax.CallOption) (*resourcemanagerpb.Folder, error) {
+	f.read("GetFolder", req.Name)
+	if f.denied[req.Name] {
+		return nil, status.Errorf(codes.PermissionDenied, "permission denied on %s", req.Name)
+	}
+	return &resourcemanagerpb.Folder{Name: req.Name, Parent: f.parents[req.Name]}, nil
+}
+
+func newHierarchyClients(h *fakeHierarchy) *gcpClients {
+	return &gcpClients{projects: h, folders: h, organizations: h, denyPolicies: &fakeDenyPolicies{}}
+}
+
+func TestResourceAncestry(t *testing.T) {
+	ctx := context.Background()
+	h := &fakeHierarchy{
+		numbers: map[string]string{"test-project": "123"},
+		parents: map[string]string{
+			"projects/test-project": "folders/2",
+			"folders/2":             "folders/1",
+			"folders/1":             "organizations/9",
+		},
+	}
+
+	ancestry, err := resourceAncestry(ctx, newHierarchyClients(h), "projects/test-project")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects/test-project", "folders/2", "folders/1", "organizations/9"}, ancestry)
+
+	h.denied = map[string]bool{"folders/1": true}
+	ancestry, err = resourceAncestry(ctx, newHierarchyClients(h), "projects/test-project")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"projects/test-project", "folders/2", "folders/1"}, ancestry)
+
+	ancestry, err = resourceAncestry(ctx, newHierarchyClients(h), "projects/missing-project")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"projects/missing-project"}, ancestry)
+
+	h.denied = nil
+	ancestry, err = resourceAncestry(ctx, newHierarchyClients(h), "folders/2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"folders/2", "folders/1", "organizations/9"}, ancestry)
+}
+
+func TestAncestryCaching(t *testing.T) {
+	ctx := context.Background()
+	h := &fakeHierarchy{
+		numbers: map[string]string{"test-project": "123"},
+		parents: map[string]string{
+			"projects/test-project": "folders/2",
+			"folders/2":             "folders/1",
+			"folders/1":             "organizations/9",
+		},
+		denied: map[string]bool{"organizations/9": true},
+	}
+	clients := newHierarchyClients(h)
+
+	for i := 0; i < 3; i++ {
+		ancestry, err := resourceAncestry(ctx, clients, "projects/test-project")
+		assert.NoError(t, err)
+		for _, resource := range ancestry {
+			_, err := getResourcePolicy(ctx, clients, resource)
+			assert.Equal(t, resource == "organizations/9", err != nil, resource)
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"GetFolder folders/2":                1,
+		"GetFolder folders/1":                1,
+		"GetIamPolicy projects/test-project": 1,
+		"GetIamPolicy folders/2":             1,
+		"GetIamPolicy folders/1":             1,
+		// Failures aren't cached.
+		"GetIamPolicy organizations/9": 3,
+	}, h.reads)
+}
+
+func TestPerformKsaCheckInheritedBindings(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	pool := "test-project.svc.id.goog"
+	base := "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool},
+	}
+	ksa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "app"}}
+
+	h := &fakeHierarchy{
+		numbers: map[string]string{"test-project": "123"},
+		parents: map[string]string{
+			"projects/test-project": "folders/2",
+			"folders/2":             "organizations/9",
+		},
+		policies: map[string]*iampb.Policy{
+			"folders/2": {Bindings: []*iampb.Binding{
+				{Role: "roles/storage.objectViewer", Members: []string{"principalSet://" + base + "/namespace/app"}},
+				{Role: "roles/pubsub.publisher", Members: []string{"principal://" + base + "/subject/ns/app/sa/web-canary"}},
+			}},
+		},
+		denied: map[string]bool{"organizations/9": true},
+	}
+
+	report, err := performKsaCheck(ctx, newHierarchyClients(h), "app", "web", cluster, newMockClientset(ksa))
+	assert.NoError(t, err)
+	assert.Equal(t, statusPass, report.Status)
+	assert.Equal(t, []grantedBinding{{Role: "roles/storage.objectViewer", Member: "principalSet://" + base + "/namespace/app", Resource: "folders/2"}}, report.Bindings)
+
+	direct := findCheck(t, report, checkIamDirectBinding)
+	assert.Contains(t, direct.Message, "roles/storage.objectViewer on folders/2")
+	assert.Equal(t, "organizations/9", direct.Evidence["unreadablePolicies"])
+}
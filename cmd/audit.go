@@ -0,0 +1,446 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// auditOptions holds the flags of the audit command.
+type auditOptions struct {
+	clusters    []string
+	concurrency int
+}
+
+var auditOpts auditOptions
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Reports stale Workload Identity bindings on a project's Google Service Accounts.",
+	Long: `Lists every Google Service Account in a project and collects the Workload Identity members
+of their IAM policies and of the project's IAM policy. Each member is cross-referenced with the live
+KSAs in the given clusters and classified as active, dangling (the namespace or KSA is gone),
+unannotated, annotated-other-gsa, deleted, or other-pool when no given cluster uses its workload pool.
+KSAs annotated with one of the project's GSAs that no member covers are reported as unbound.
+
+Clusters are given as LOCATION/NAME for clusters in --project, or as
+projects/PROJECT/locations/LOCATION/clusters/NAME.`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat(outputFormat)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if inspectionToken != "" {
+			log.Fatalf("❌ The IAM policies of GSAs cannot be read with an inspection token.")
+		}
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		var clusters []auditCluster
+		for _, ref := range auditOpts.clusters {
+			project, location, name, err := parseClusterRef(ref, projectID)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			cluster, err := getGKECluster(ctx, clients.gke, project, location, name)
+			if err != nil {
+				log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+			}
+			clientset, err := getK8sClientset(cluster)
+			if err != nil {
+				log.Fatalf("❌ Failed to create Kubernetes clientset for cluster '%s': %v", name, err)
+			}
+			c, err := newAuditCluster(ctx, clients, project, cluster, clientset)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			clusters = append(clusters, c)
+		}
+
+		report, err := performAudit(ctx, clients, projectID, clusters, auditOpts.concurrency)
+		if err != nil {
+			log.Fatalf("❌ Failed to audit project '%s': %v", projectID, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ One or more KSAs annotated with a GSA of project '%s' cannot impersonate it.", projectID)
+		}
+	},
+}
+
+// auditCluster is a cluster whose KSAs the audit checks members against.
+type auditCluster struct {
+	info clusterInfo
+	// id identifies the cluster and its workload pool; its Namespace and Name are unset.
+	id        ksaIdentity
+	clientset kubernetes.Interface
+}
+
+// parseClusterRef parses LOCATION/NAME, for a cluster in defaultProject, or
+// projects/PROJECT/locations/LOCATION/clusters/NAME.
+func parseClusterRef(ref, defaultProject string) (project, location, name string, err error) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return defaultProject, parts[0], parts[1], nil
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "locations" && parts[4] == "clusters":
+		return parts[1], parts[3], parts[5], nil
+	}
+	return "", "", "", fmt.Errorf("invalid cluster '%s' (expected LOCATION/NAME or projects/PROJECT/locations/LOCATION/clusters/NAME)", ref)
+}
+
+// newAuditCluster resolves the workload pool of a cluster in project.
+func newAuditCluster(ctx context.Context, clients *gcpClients, project string, cluster *containerpb.Cluster, clientset kubernetes.Interface) (auditCluster, error) {
+	if cluster.WorkloadIdentityConfig == nil || cluster.WorkloadIdentityConfig.WorkloadPool == "" {
+		return auditCluster{}, fmt.Errorf("Workload Identity is not enabled on cluster '%s'", cluster.Name)
+	}
+	c := auditCluster{
+		info:      clusterInfo{Project: project, Location: cluster.Location, Name: cluster.Name, WorkloadPool: cluster.WorkloadIdentityConfig.WorkloadPool},
+		clientset: clientset,
+	}
+	if number, err := clients.projectNumber(ctx, workloadPoolProject(c.info.WorkloadPool)); err == nil {
+		c.info.WorkloadPoolProjectNumber = number
+	}
+	c.id = ksaIdentity{
+		WorkloadPool:      c.info.WorkloadPool,
+		PoolProjectNumber: c.info.WorkloadPoolProjectNumber,
+		Cluster:           clusterResourceName(project, cluster.Location, cluster.Name),
+	}
+	return c, nil
+}
+
+// auditedBinding is a Workload Identity member found on a GSA or project policy.
+type auditedBinding struct {
+	// Resource is the GSA email, or projects/PROJECT for roles granted on the project.
+	Resource string `json:"resource"`
+	Role     string `json:"role"`
+	// Clusters names the audited clusters the state was found in.
+	Clusters []string `json:"clusters,omitempty"`
+	impersonator
+}
+
+// auditReport classifies every Workload Identity binding of a project.
+type auditReport struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Status     checkStatus   `json:"status"`
+	Project    string        `json:"project"`
+	Clusters   []clusterInfo `json:"clusters"`
+	// GSAs is the number of service accounts whose policies were read.
+	GSAs     int                 `json:"gsasScanned"`
+	Summary  map[memberState]int `json:"summary"`
+	Bindings []auditedBinding    `json:"bindings"`
+	// Unreadable lists the policies that couldn't be read, along with the error.
+	Unreadable []string `json:"unreadablePolicies,omitempty"`
+}
+
+// stateRank orders the states a member can have in a single cluster, best first. A member that
+// covers KSAs in several clusters is reported with its best state.
+func stateRank(s memberState) int {
+	switch s {
+	case memberActive:
+		return 0
+	case memberOtherGSA:
+		return 1
+	case memberUnannotated:
+		return 2
+	}
+	return 3
+}
+
+// classifyAcrossClusters classifies a member against every audited cluster that uses its workload
+// pool and keeps the best outcome.
+func classifyAcrossClusters(ctx context.Context, clusters []auditCluster, gsaEmail string, p *wifPrincipal, b *auditedBinding, revoke string) error {
+	var matching []auditCluster
+	for _, c := range clusters {
+		if p.inPool(c.id) && (p.Scope != scopeCluster || p.Cluster == c.id.Cluster) {
+			matching = append(matching, c)
+		}
+	}
+
+	switch {
+	case p.Deleted:
+		b.Scope, b.Pool, b.Namespace, b.KSA = scopeName(p.Scope), p.Pool, p.Namespace, p.KSA
+		b.State = memberDeleted
+		b.Detail = "The member was deleted and grants nothing."
+		b.Remediation = revoke
+		return nil
+	case len(matching) == 0:
+		b.Scope, b.Pool, b.Namespace, b.KSA = scopeName(p.Scope), p.Pool, p.Namespace, p.KSA
+		b.State = memberOtherPool
+		b.Detail = fmt.Sprintf("No audited cluster uses workload pool '%s'.", p.Pool)
+		if p.Scope == scopeCluster {
+			b.Detail = fmt.Sprintf("Cluster '%s' is not audited.", p.Cluster)
+		}
+		b.Remediation = "If no cluster outside this audit uses the member, revoke the grant:\n" + revoke
+		return nil
+	}
+
+	base := b.impersonator
+	for _, c := range matching {
+		imp := base
+		if err := classifyImpersonator(ctx, c.clientset, c.id, gsaEmail, p, &imp, revoke); err != nil {
+			return fmt.Errorf("cluster '%s': %w", c.info.Name, err)
+		}
+		switch {
+		case b.State == "" || stateRank(imp.State) < stateRank(b.State):
+			b.impersonator = imp
+			b.Clusters = []string{c.info.Name}
+		case imp.State == b.State:
+			b.KSAs = append(b.KSAs, imp.KSAs...)
+			b.Clusters = append(b.Clusters, c.info.Name)
+		}
+	}
+	slices.Sort(b.KSAs)
+	b.KSAs = slices.Compact(b.KSAs)
+	return nil
+}
+
+// performAudit reads the IAM policies of every GSA in project, and of the project itself, and
+// classifies each Workload Identity member against the audited clusters. GSA policies are read on
+// a pool of concurrency goroutines. Policies that can't be read are listed in the report.
+func performAudit(ctx context.Context, clients *gcpClients, project string, clusters []auditCluster, concurrency int) (*auditReport, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	report := &auditReport{
+		APIVersion: reportAPIVersion,
+		Kind:       "AuditReport",
+		Status:     statusPass,
+		Project:    project,
+		Clusters:   []clusterInfo{},
+		Summary:    map[memberState]int{},
+		Bindings:   []auditedBinding{},
+	}
+	for _, c := range clusters {
+		report.Clusters = append(report.Clusters, c.info)
+	}
+
+	gsas, err := clients.gsas.ListServiceAccounts(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts in project '%s': %w", project, err)
+	}
+	policies := make([]*iampb.Policy, len(gsas))
+	errs := make([]error, len(gsas))
+	g := &errgroup.Group{}
+	g.SetLimit(concurrency)
+	for i, sa := range gsas {
+		g.Go(func() error {
+			policy, err := clients.iam.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+				Resource: gsaPolicyResource(sa.Email),
+				Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+			})
+			if err != nil {
+				errs[i] = err
+				return nil
+			}
+			policies[i] = policy.InternalProto
+			return nil
+		})
+	}
+	g.Wait()
+
+	env := conditionEnv{now: time.Now()}
+	// add classifies every Workload Identity member of policy. gsaEmail is empty for the project
+	// policy, whose grants only apply to KSAs that aren't annotated.
+	add := func(resource, gsaEmail string, policy *iampb.Policy) error {
+		for _, binding := range policy.GetBindings() {
+			for _, m := range binding.Members {
+				p, ok := parsePrincipal(m)
+				if !ok {
+					continue
+				}
+				b := auditedBinding{Resource: resource, Role: binding.Role, impersonator: impersonator{Member: m}}
+				if expression := binding.GetCondition().GetExpression(); expression != "" {
+					b.Condition = expression
+					b.ConditionHolds = evaluateCondition(expression, env)
+				}
+				impersonated := gsaEmail
+				var revoke string
+				if gsaEmail != "" && binding.Role == workloadIdentityUserRole {
+					revoke = removeWorkloadIdentityUserCommand(gsaEmail, m, b.Condition)
+				} else {
+					// Any other role is used by the KSA principal itself, like a project grant.
+					impersonated = ""
+					revoke = removeIamPolicyBindingCommand(resource, binding.Role, m, b.Condition)
+				}
+				if err := classifyAcrossClusters(ctx, clusters, impersonated, p, &b, revoke); err != nil {
+					return err
+				}
+				report.Bindings = append(report.Bindings, b)
+			}
+		}
+		return nil
+	}
+
+	readable := map[string]*iampb.Policy{}
+	for i, sa := range gsas {
+		if errs[i] != nil {
+			report.Unreadable = append(report.Unreadable, fmt.Sprintf("%s: %v", sa.Email, errs[i]))
+			continue
+		}
+		report.GSAs++
+		readable[strings.ToLower(sa.Email)] = policies[i]
+		if err := add(sa.Email, sa.Email, policies[i]); err != nil {
+			return nil, err
+		}
+	}
+	projectResource := "projects/" + project
+	if policy, err := getResourcePolicy(ctx, clients, projectResource); err != nil {
+		report.Unreadable = append(report.Unreadable, fmt.Sprintf("%s: %v", projectResource, err))
+	} else if err := add(projectResource, "", policy); err != nil {
+		return nil, err
+	}
+
+	// The reverse direction: KSAs annotated with one of the project's GSAs that no
+	// roles/iam.workloadIdentityUser member on it covers.
+	for _, c := range clusters {
+		list, err := c.clientset.CoreV1().ServiceAccounts("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list service accounts in cluster '%s': %w", c.info.Name, err)
+		}
+		for _, sa := range list.Items {
+			gsaEmail := sa.Annotations[gsaAnnotation]
+			policy, ok := readable[strings.ToLower(gsaEmail)]
+			if !ok {
+				continue
+			}
+			id := c.id
+			id.Namespace, id.Name = sa.Namespace, sa.Name
+			if policyGrantsWorkloadIdentityUser(policy, id) {
+				continue
+			}
+			report.Bindings = append(report.Bindings, auditedBinding{
+				Resource: gsaEmail,
+				Role:     workloadIdentityUserRole,
+				Clusters: []string{c.info.Name},
+				impersonator: impersonator{
+					State:     memberUnbound,
+					Scope:     scopeName(scopeKSA),
+					Pool:      c.id.WorkloadPool,
+					Namespace: sa.Namespace,
+					KSA:       sa.Name,
+					Detail:    fmt.Sprintf("KSA '%s/%s' is annotated with the GSA but no %s member covers it.", sa.Namespace, sa.Name, workloadIdentityUserRole),
+					Remediation: fmt.Sprintf("gcloud iam service-accounts add-iam-policy-binding %s \\\n  --role=%s \\\n  --member=\"%s\"",
+						gsaEmail, workloadIdentityUserRole, ksaServiceAccountMember(c.id.WorkloadPool, sa.Namespace, sa.Name)),
+				},
+			})
+		}
+	}
+
+	for _, b := range report.Bindings {
+		report.Summary[b.State]++
+		if s := b.status(); statusRank(s) > statusRank(report.Status) {
+			report.Status = s
+		}
+	}
+	return report, nil
+}
+
+// policyGrantsWorkloadIdentityUser reports whether a GSA policy lets the KSA impersonate the GSA.
+// Conditions are ignored.
+func policyGrantsWorkloadIdentityUser(policy *iampb.Policy, id ksaIdentity) bool {
+	for _, binding := range policy.GetBindings() {
+		if binding.Role == workloadIdentityUserRole && slices.ContainsFunc(binding.Members, func(m string) bool { return principalAppliesTo(m, id) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeIamPolicyBindingCommand returns the command that revokes role from member on a GSA, given
+// by its email, or on a project.
+func removeIamPolicyBindingCommand(resource, role, member, condition string) string {
+	command := "gcloud iam service-accounts remove-iam-policy-binding " + resource
+	if strings.Contains(resource, "/") {
+		command = strings.Replace(addIamPolicyBindingCommand(resource), "add-iam-policy-binding", "remove-iam-policy-binding", 1)
+	}
+	command += fmt.Sprintf(" \\\n  --role=%s \\\n  --member=\"%s\"", role, member)
+	if condition != "" {
+		command += " \\\n  --all"
+	}
+	return command
+}
+
+// renderText writes the per-state summary, a table of the bindings and the suggested fixes.
+func (r *auditReport) renderText(w io.Writer) {
+	clusterNames := make([]string, 0, len(r.Clusters))
+	for _, c := range r.Clusters {
+		clusterNames = append(clusterNames, c.Name)
+	}
+	fmt.Fprintf(w, "🔎 Workload Identity bindings in project '%s' (%d GSA(s), clusters: %s)\n", r.Project, r.GSAs, strings.Join(clusterNames, ", "))
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+	for _, u := range r.Unreadable {
+		fmt.Fprintf(w, "⚠️  Could not read the IAM policy of %s\n", u)
+	}
+	for _, s := range []memberState{memberActive, memberDangling, memberUnannotated, memberOtherGSA, memberOtherPool, memberDeleted, memberUnbound} {
+		if n := r.Summary[s]; n > 0 {
+			fmt.Fprintf(w, "   %s: %d\n", s, n)
+		}
+	}
+	fmt.Fprintln(w)
+
+	bindings := slices.Clone(r.Bindings)
+	slices.SortStableFunc(bindings, func(a, b auditedBinding) int {
+		return statusRank(b.status()) - statusRank(a.status())
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tRESOURCE\tROLE\tPOOL\tKSA\tDETAIL")
+	for _, b := range bindings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", b.State, b.Resource, b.Role, b.Pool, b.target(), b.Detail)
+	}
+	tw.Flush()
+
+	for _, b := range bindings {
+		if b.State != memberActive && b.Remediation != "" {
+			renderRemediation(w, fmt.Sprintf("%s %s on %s", b.State, b.target(), b.Resource), b.Remediation)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().StringVar(&projectID, "project", "", "GCP project whose service accounts and IAM policy are audited (required)")
+	auditCmd.Flags().StringSliceVar(&auditOpts.clusters, "clusters", nil, "Clusters to check members against, as LOCATION/NAME or projects/PROJECT/locations/LOCATION/clusters/NAME (required)")
+	auditCmd.Flags().IntVar(&auditOpts.concurrency, "concurrency", 8, "Maximum number of IAM policies read concurrently")
+	auditCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+	auditCmd.MarkFlagRequired("project")
+	auditCmd.MarkFlagRequired("clusters")
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampolicy "cloud.google.com/go/iam"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeGsaPolicies serves one IAM policy per GSA, keyed by email, and lists those GSAs. GSAs in
+// denied can be listed but their policies can't be read.
+type fakeGsaPolicies struct {
+	fakeIamAdmin
+	policies map[string]*iampb.Policy
+	denied   map[string]bool
+}
+
+func (f *fakeGsaPolicies) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampolicy.Policy, error) {
+	for email, policy := range f.policies {
+		if req.Resource == gsaPolicyResource(email) {
+			return &iampolicy.Policy{InternalProto: policy}, nil
+		}
+	}
+	return nil, status.Errorf(codes.PermissionDenied, "permission denied on %s", req.Resource)
+}
+
+func (f *fakeGsaPolicies) ListServiceAccounts(ctx context.Context, project string) ([]*adminpb.ServiceAccount, error) {
+	var accounts []*adminpb.ServiceAccount
+	for email := range f.policies {
+		accounts = append(accounts, &adminpb.ServiceAccount{Email: email})
+	}
+	for email := range f.denied {
+		accounts = append(accounts, &adminpb.ServiceAccount{Email: email})
+	}
+	return accounts, nil
+}
+
+func TestParseClusterRef(t *testing.T) {
+	project, location, name, err := parseClusterRef("us-central1/prod", "test-project")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test-project", "us-central1", "prod"}, []string{project, location, name})
+
+	project, location, name, err = parseClusterRef("projects/other/locations/europe-west1/clusters/dev", "test-project")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other", "europe-west1", "dev"}, []string{project, location, name})
+
+	_, _, _, err = parseClusterRef("prod", "test-project")
+	assert.ErrorContains(t, err, "invalid cluster 'prod'")
+}
+
+func TestPerformAudit(t *testing.T) {
+	ctx := context.Background()
+	pool := "test-project.svc.id.goog"
+	app := "app@test-project.iam.gserviceaccount.com"
+	batch := "batch@test-project.iam.gserviceaccount.com"
+	hidden := "hidden@test-project.iam.gserviceaccount.com"
+
+	ksa := func(namespace, name, annotation string) *corev1.ServiceAccount {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if annotation != "" {
+			sa.Annotations = map[string]string{gsaAnnotation: annotation}
+		}
+		return sa
+	}
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	prod := fake.NewSimpleClientset(
+		namespace("web"), namespace("jobs"),
+		ksa("web", "frontend", app),
+		ksa("web", "reader", ""),
+		ksa("jobs", "runner", batch),
+	)
+	dev := fake.NewSimpleClientset(
+		namespace("web"),
+		ksa("web", "frontend", ""),
+		ksa("web", "debug", app),
+	)
+
+	admin := &fakeGsaPolicies{
+		policies: map[string]*iampb.Policy{
+			app: {Bindings: []*iampb.Binding{{Role: workloadIdentityUserRole, Members: []string{
+				ksaServiceAccountMember(pool, "web", "frontend"),
+				ksaServiceAccountMember(pool, "gone", "app"),
+				ksaServiceAccountMember("legacy-project.svc.id.goog", "web", "frontend"),
+				"user:dev@example.com",
+			}}}},
+			batch: {Bindings: []*iampb.Binding{{Role: workloadIdentityUserRole, Members: []string{
+				ksaServiceAccountMember(pool, "web", "reader"),
+				"deleted:" + ksaServiceAccountMember(pool, "jobs", "old") + "?uid=1",
+			}}}},
+		},
+		denied: map[string]bool{hidden: true},
+	}
+	h := &fakeHierarchy{
+		numbers: map[string]string{"test-project": "123"},
+		policies: map[string]*iampb.Policy{
+			"projects/test-project": {Bindings: []*iampb.Binding{
+				{Role: "roles/storage.objectViewer", Members: []string{
+					ksaPrincipal("123", pool, "web", "reader"),
+					ksaPrincipal("123", pool, "jobs", "runner"),
+					principalSetPrefix + "projects/123/locations/global/workloadIdentityPools/" + pool + "/namespace/retired",
+				}},
+			}},
+		},
+	}
+	clients := newHierarchyClients(h)
+	clients.iam = admin
+	clients.gsas = admin
+
+	var clusters []auditCluster
+	for _, c := range []struct {
+		name      string
+		clientset *fake.Clientset
+	}{{"prod", prod}, {"dev", dev}} {
+		cluster := &containerpb.Cluster{Name: c.name, Location: "us-central1", WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool}}
+		ac, err := newAuditCluster(ctx, clients, "test-project", cluster, c.clientset)
+		assert.NoError(t, err)
+		clusters = append(clusters, ac)
+	}
+	assert.Equal(t, "123", clusters[0].info.WorkloadPoolProjectNumber)
+
+	report, err := performAudit(ctx, clients, "test-project", clusters, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.GSAs)
+	assert.Len(t, report.Unreadable, 1)
+	assert.Contains(t, report.Unreadable[0], hidden)
+
+	type key struct{ resource, target, pool string }
+	states := map[key]memberState{}
+	for _, b := range report.Bindings {
+		states[key{b.Resource, b.target(), b.Pool}] = b.State
+	}
+	assert.Equal(t, map[key]memberState{
+		{app, "web/frontend", pool}:                         memberActive,
+		{app, "gone/app", pool}:                             memberDangling,
+		{app, "web/frontend", "legacy-project.svc.id.goog"}: memberOtherPool,
+		{app, "web/debug", pool}:                            memberUnbound,
+		{batch, "web/reader", pool}:                         memberUnannotated,
+		{batch, "jobs/old", pool}:                           memberDeleted,
+		{batch, "jobs/runner", pool}:                        memberUnbound,
+		{"projects/test-project", "web/reader", pool}:       memberActive,
+		{"projects/test-project", "jobs/runner", pool}:      memberOtherGSA,
+		{"projects/test-project", "retired", pool}:          memberDangling,
+	}, states)
+	assert.Equal(t, statusFail, report.Status)
+	assert.Equal(t, 2, report.Summary[memberUnbound])
+
+	for _, b := range report.Bindings {
+		switch {
+		case b.Resource == app && b.target() == "web/frontend" && b.Pool == pool:
+			// Active in prod; dev's KSA of the same name isn't annotated.
+			assert.Equal(t, []string{"prod"}, b.Clusters)
+		case b.Resource == "projects/test-project" && b.target() == "retired":
+			assert.Equal(t, "gcloud projects remove-iam-policy-binding test-project \\\n  --role=roles/storage.objectViewer \\\n  --member=\""+b.Member+"\"", b.Remediation)
+		case b.Resource == app && b.Pool == "legacy-project.svc.id.goog":
+			assert.Equal(t, "No audited cluster uses workload pool 'legacy-project.svc.id.goog'.", b.Detail)
+		}
+	}
+
+	var buf bytes.Buffer
+	report.renderText(&buf)
+	assert.Contains(t, buf.String(), "   unbound: 2\n")
+	assert.Regexp(t, `(?m)^dangling\s+projects/test-project\s+roles/storage.objectViewer\s+`+pool+`\s+retired\s`, buf.String())
+	assert.Contains(t, buf.String(), "🔧 dangling gone/app on "+app+":")
+}
@@ -21,18 +21,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	container "cloud.google.com/go/container/apiv1"
 	"cloud.google.com/go/container/apiv1/containerpb"
-	iam "cloud.google.com/go/iam/admin/apiv1"
 	iampb "cloud.google.com/go/iam/apiv1/iampb"
-	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
 	"github.com/spf13/cobra"
 	"github.com/vishnu-trace/gke-wif-troubleshooter/internal/auth"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/exec"
@@ -41,6 +43,12 @@ import (
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+// gsaAnnotation links a KSA to the Google Service Account it impersonates.
+const gsaAnnotation = "iam.gke.io/gcp-service-account"
+
+// workloadIdentityUserRole lets a Workload Identity principal impersonate a GSA.
+const workloadIdentityUserRole = "roles/iam.workloadIdentityUser"
+
 var (
 	projectID      string
 	location       string
@@ -56,34 +64,41 @@ var checkCmd = &cobra.Command{
 	Long: `Performs a series of checks to validate the Workload Identity setup
 for resources like Kubernetes Service Accounts (KSA) and workloads (Deployments, etc.).`,
 	// This is a parent command, so it doesn't have a Run function.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat(outputFormat)
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(checkCmd)
 
-	checkCmd.PersistentFlags().StringVar(&projectID, "project", "", "GCP project ID (required)")
-	checkCmd.PersistentFlags().StringVar(&location, "location", "", "GKE cluster location (region or zone) (required)")
-	checkCmd.PersistentFlags().StringVar(&clusterName, "cluster", "", "GKE cluster name (required)")
-	checkCmd.PersistentFlags().BoolFunc("local-kubeconfig", "Use local GKE cluster kubeconfig (optional)", getKubeconfig)
+	addClusterFlags(checkCmd)
+	checkCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+}
+
+// addClusterFlags registers the flags identifying the target GKE cluster on cmd and its subcommands.
+func addClusterFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&projectID, "project", "", "GCP project ID (required)")
+	cmd.PersistentFlags().StringVar(&location, "location", "", "GKE cluster location (region or zone) (required)")
+	cmd.PersistentFlags().StringVar(&clusterName, "cluster", "", "GKE cluster name (required)")
+	cmd.PersistentFlags().BoolFunc("local-kubeconfig", "Use local GKE cluster kubeconfig (optional)", getKubeconfig)
 
-	checkCmd.MarkPersistentFlagRequired("project")
-	checkCmd.MarkPersistentFlagRequired("location")
-	checkCmd.MarkPersistentFlagRequired("cluster")
+	cmd.MarkPersistentFlagRequired("project")
+	cmd.MarkPersistentFlagRequired("location")
+	cmd.MarkPersistentFlagRequired("cluster")
 }
 
 // generate kubeconfig path if --local-kubeconfig flag used
 func getKubeconfig(string) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Errorf("❌ Failed to retrieve home directory: %v", err)
-		return err
+		return fmt.Errorf("failed to retrieve home directory: %w", err)
 	}
 	kubeconfigpath = filepath.Join(homeDir, ".kube", "config")
 
 	_, err = os.Stat(kubeconfigpath)
 	if err != nil {
-		fmt.Errorf("❌ Failed to find local kubeconfig at: %v/n. More details %w", kubeconfigpath, err)
-		return err
+		return fmt.Errorf("failed to find local kubeconfig at %s: %w", kubeconfigpath, err)
 	}
 	return nil
 }
@@ -96,7 +111,7 @@ func newGKEClient(ctx context.Context) (*container.ClusterManagerClient, error)
 }
 
 // getGKECluster retrieves GKE cluster details.
-func getGKECluster(ctx context.Context, client *container.ClusterManagerClient, project, location, cluster string) (*containerpb.Cluster, error) {
+func getGKECluster(ctx context.Context, client clusterGetter, project, location, cluster string) (*containerpb.Cluster, error) {
 	req := &containerpb.GetClusterRequest{
 		Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, cluster),
 	}
@@ -105,6 +120,20 @@ func getGKECluster(ctx context.Context, client *container.ClusterManagerClient,
 
 // getK8sClientset creates a Kubernetes clientset from GKE cluster data.
 func getK8sClientset(cluster *containerpb.Cluster) (*kubernetes.Clientset, error) {
+	config, err := getK8sConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset from config: %w", err)
+	}
+	return clientset, nil
+}
+
+// getK8sConfig returns the REST config for the cluster, from --kubeconfig if it is set or
+// else from the cluster's endpoint with gke-gcloud-auth-plugin credentials.
+func getK8sConfig(cluster *containerpb.Cluster) (*rest.Config, error) {
 	var config *rest.Config
 	if kubeconfigpath == "" {
 		caDec, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
@@ -132,121 +161,263 @@ func getK8sClientset(cluster *containerpb.Cluster) (*kubernetes.Clientset, error
 		}
 	}
 	config.UserAgent = userAgentHeader
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create clientset from config: %w", err)
-	}
-	return clientset, nil
+	return config, nil
 }
 
-// performKsaCheck carries out the actual validation for a given KSA.
-func performKsaCheck(ctx context.Context, ksaNamespace, ksaName string, cluster *containerpb.Cluster, clientset kubernetes.Interface) error {
-	fmt.Printf("🔎 Starting GKE Workload Identity analysis for KSA: %s/%s\n", ksaNamespace, ksaName)
-	fmt.Println("-------------------------------------------------------------")
+// performKsaCheck carries out the actual validation for a given KSA. Every step is
+// recorded in the returned report; a non-nil error means a check failed badly
+// enough that the remaining steps could not run.
+func performKsaCheck(ctx context.Context, clients *gcpClients, ksaNamespace, ksaName string, cluster *containerpb.Cluster, clientset kubernetes.Interface) (*ksaReport, error) {
+	report := newKsaReport(cluster.Name, cluster.Location, ksaNamespace, ksaName)
 
 	// 1. Check GKE cluster for Workload Identity
-	fmt.Printf("1. Checking cluster '%s' in '%s'...\n", cluster.Name, cluster.Location)
-
+	clusterCheck := checkResult{
+		ID:       checkClusterWorkloadIdentity,
+		Title:    fmt.Sprintf("Checking cluster '%s' in '%s'", cluster.Name, cluster.Location),
+		Severity: severityHigh,
+		DocLink:  docWorkloadIdentity,
+	}
 	if cluster.WorkloadIdentityConfig == nil || cluster.WorkloadIdentityConfig.WorkloadPool == "" {
-		return fmt.Errorf("Workload Identity is not enabled on cluster '%s'", cluster.Name)
+		clusterCheck.Remediation = fmt.Sprintf("gcloud container clusters update %s \\\n  --location=%s \\\n  --workload-pool=%s.svc.id.goog", cluster.Name, cluster.Location, projectID)
+		return report, report.fail(clusterCheck, fmt.Errorf("Workload Identity is not enabled on cluster '%s'", cluster.Name))
 	}
 	workloadPool := cluster.WorkloadIdentityConfig.WorkloadPool
-	fmt.Printf("   ✅ Workload Identity is enabled. Workload Pool: %s\n", workloadPool)
+	report.Cluster.WorkloadPool = workloadPool
+	clusterCheck.Status = statusPass
+	clusterCheck.Message = fmt.Sprintf("Workload Identity is enabled. Workload Pool: %s", workloadPool)
+	report.add(clusterCheck)
 
 	// 2. Check K8s Service Account and annotation
-	fmt.Printf("\n2. Checking K8s Service Account '%s/%s'...\n", ksaNamespace, ksaName)
-
+	ksaCheck := checkResult{
+		ID:       checkKsaExists,
+		Title:    fmt.Sprintf("Checking K8s Service Account '%s/%s'", ksaNamespace, ksaName),
+		Severity: severityHigh,
+	}
 	ksa, err := clientset.CoreV1().ServiceAccounts(ksaNamespace).Get(ctx, ksaName, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", ksaName, ksaNamespace, err)
+		ksaCheck.Remediation = fmt.Sprintf("kubectl create serviceaccount %s --namespace %s", ksaName, ksaNamespace)
+		return report, report.fail(ksaCheck, fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", ksaName, ksaNamespace, err))
 	}
-	fmt.Printf("   ✅ Found KSA '%s/%s'.\n", ksaNamespace, ksaName)
+	ksaCheck.Status = statusPass
+	ksaCheck.Message = fmt.Sprintf("Found KSA '%s/%s'.", ksaNamespace, ksaName)
+	report.add(ksaCheck)
 
-	gsaAnnotation := "iam.gke.io/gcp-service-account"
 	gsaEmail, ok := ksa.Annotations[gsaAnnotation]
 
-	legacySyntax := fmt.Sprintf("serviceAccount:%s.svc.id.goog[%s/%s]", projectID, ksaNamespace, ksaName)
-	principalSchema := fmt.Sprintf("%s.svc.id.goog/subject/ns/%s/sa/%s", projectID, ksaNamespace, ksaName)
+	legacySyntax := ksaServiceAccountMember(workloadPool, ksaNamespace, ksaName)
+	// principal:// identifiers carry the pool project's number. If it can't be resolved, members
+	// are matched without it and suggestions fall back to a placeholder.
+	if number, err := clients.projectNumber(ctx, workloadPoolProject(workloadPool)); err == nil {
+		report.Cluster.WorkloadPoolProjectNumber = number
+	}
+	identity := report.identity()
+	principal := report.principal()
+
+	annotationCheck := checkResult{
+		ID:       checkKsaAnnotation,
+		Title:    fmt.Sprintf("Checking KSA '%s/%s' for the '%s' annotation", ksaNamespace, ksaName, gsaAnnotation),
+		Severity: severityInfo,
+		DocLink:  docWorkloadIdentity,
+	}
 
 	// 3. Check IAM binding
 
 	if !ok || gsaEmail == "" {
-		fmt.Printf("   ℹ️  KSA '%s/%s' is missing the '%s' annotation.\n", ksaNamespace, ksaName, gsaAnnotation)
-		fmt.Println("   ℹ️  This is not necessarily an error. Checking for direct IAM role bindings on the KSA principal...")
-
-		fmt.Println("\n3. Checking for direct IAM bindings for KSA principal at the project level...")
-		projectsClient, err := resourcemanager.NewProjectsClient(ctx, getClientOptions(ctx)...)
-		if err != nil {
-			return fmt.Errorf("failed to create Cloud Resource Manager client: %w", err)
-		}
-		defer projectsClient.Close()
-
-		policy, err := projectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-			Resource: "projects/" + projectID,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get IAM policy for project '%s': %w", projectID, err)
+		annotationCheck.Status = statusSkip
+		annotationCheck.Message = fmt.Sprintf("KSA '%s/%s' is missing the '%s' annotation. This is not necessarily an error; checking for direct IAM role bindings on the KSA principal instead.", ksaNamespace, ksaName, gsaAnnotation)
+		report.add(annotationCheck)
+
+		directCheck := checkResult{
+			ID:       checkIamDirectBinding,
+			Title:    "Checking for direct IAM bindings for KSA principal on the project and its folders and organization",
+			Severity: severityMedium,
+			DocLink:  docPrincipals,
 		}
 
-		foundMember := ""
-		for _, binding := range policy.Bindings {
-			for _, m := range binding.Members {
-				if strings.Contains(m, principalSchema) || strings.Contains(m, legacySyntax) {
-					foundMember = m
-					break
+		// Roles granted on a folder or the organization are inherited by the project, so walk the
+		// whole ancestry. Only the project's own policy is required; ancestors the caller can't
+		// read are reported but don't fail the check.
+		ancestry, ancestryErr := resourceAncestry(ctx, clients, "projects/"+projectID)
+		var unreadable []string
+		for i, resource := range ancestry {
+			policy, err := getResourcePolicy(ctx, clients, resource)
+			if err != nil {
+				if i == 0 {
+					return report, report.fail(directCheck, fmt.Errorf("failed to get IAM policy for project '%s': %w", projectID, err))
+				}
+				unreadable = append(unreadable, resource)
+				continue
+			}
+			for _, b := range bindingsFor(policy, resource, identity, conditionEnv{now: time.Now()}) {
+				report.Bindings = append(report.Bindings, b)
+				if !slices.Contains(report.Members, b.Member) {
+					report.Members = append(report.Members, b.Member)
 				}
 			}
 		}
 
-		if foundMember == "" {
-			fmt.Printf("   ❌ No direct IAM bindings found for KSA principal at the project level ('%s').\n", projectID)
-			fmt.Println("   ℹ️  This is not necessarily an error if the principal is assigned role directly on the product.")
-			fmt.Println("   ℹ️  If your workload needs permissions at the project level, you should either:")
-			fmt.Println("	  1. Grant IAM roles directly to the KSA principal on the project level (recommended).\n		The principal syntax could be found at https://cloud.google.com/kubernetes-engine/docs/concepts/workload-identity#kubernetes-resources-iam-policies")
-			fmt.Printf("	  2. Annotate the KSA '%s/%s' to impersonate a GSA .\n", ksaNamespace, ksaName)
+		directCheck.Evidence = map[string]string{"ancestry": strings.Join(ancestry, " → ")}
+		if ancestryErr != nil {
+			directCheck.Evidence["ancestryError"] = ancestryErr.Error()
+		}
+		if len(unreadable) > 0 {
+			directCheck.Evidence["unreadablePolicies"] = strings.Join(unreadable, ", ")
+		}
 
+		if len(report.Bindings) == 0 {
+			directCheck.Status = statusWarn
+			directCheck.Message = fmt.Sprintf("No direct IAM bindings found for KSA principal on project '%s' or its folders and organization. This is not necessarily an error if the principal is assigned roles directly on the product.", projectID)
+			directCheck.Remediation = fmt.Sprintf("If your workload needs permissions at the project level, you should either:\n  1. Grant IAM roles directly to the KSA principal on the project level (recommended):\n     gcloud projects add-iam-policy-binding %s \\\n       --role=ROLE_NAME \\\n       --member=\"%s\"\n  2. Annotate the KSA '%s/%s' to impersonate a GSA.", projectID, principal, ksaNamespace, ksaName)
+			directCheck.Evidence["expectedPrincipal"] = principal
 		} else {
-			fmt.Printf("   ✅ Found direct IAM bindings for KSA principal '%s' at the project level.\n", foundMember)
-			fmt.Println("\n🎉 Checks passed! The KSA has direct IAM role bindings at the project level.")
-			fmt.Println("   Please ensure these roles provide the necessary permissions for your workload to function.")
+			var granted, uncertain []string
+			for _, b := range report.Bindings {
+				granted = append(granted, b.String())
+				if !b.effective() {
+					uncertain = append(uncertain, b.String())
+				}
+			}
+			directCheck.Status = statusPass
+			directCheck.Message = fmt.Sprintf("Found direct IAM bindings for KSA principal:\n      - %s\n    Please ensure these roles provide the necessary permissions for your workload to function.", strings.Join(granted, "\n      - "))
+			directCheck.Evidence["member"] = report.Bindings[0].Member
+			// Conditional bindings only grant their role while the condition holds, e.g. until an
+			// expiry time has passed.
+			if len(uncertain) > 0 {
+				directCheck.Status = statusWarn
+				directCheck.Message += fmt.Sprintf("\n    These bindings are conditional and may not be in effect:\n      - %s", strings.Join(uncertain, "\n      - "))
+				directCheck.Evidence["conditionalBindings"] = strings.Join(uncertain, "; ")
+				directCheck.DocLink = docConditions
+			}
 		}
+		report.add(directCheck)
 	} else {
+		report.GSA = gsaEmail
+		report.GSAProject = gsaProject(gsaEmail)
+		annotationCheck.Status = statusPass
+		annotationCheck.Message = fmt.Sprintf("KSA is annotated with GSA: %s", gsaEmail)
+		annotationCheck.Evidence = map[string]string{"gsa": gsaEmail}
+		if report.GSAProject != "" {
+			annotationCheck.Message += fmt.Sprintf(" (owned by project '%s')", report.GSAProject)
+			annotationCheck.Evidence["gsaProject"] = report.GSAProject
+		}
+		report.add(annotationCheck)
+
+		// A GSA in another project is fine unless that project forbids cross-project use of its
+		// service accounts.
+		if report.GSAProject != "" && report.GSAProject != projectID {
+			report.add(checkCrossProjectUsage(ctx, clients, gsaEmail, report.GSAProject))
+		}
 
-		fmt.Printf("   ✅ KSA is annotated with GSA: %s\n", gsaEmail)
+		// The KSA can only impersonate a GSA that exists and is enabled.
+		gsaCheck, sa, err := inspectGSA(ctx, clients, gsaEmail)
+		if err != nil {
+			return report, report.fail(gsaCheck, err)
+		}
+		report.add(gsaCheck)
+		if sa != nil {
+			report.GSAUniqueID = sa.UniqueId
+			report.add(checkGSAKeys(ctx, clients, gsaEmail))
+		}
 
-		fmt.Printf("\n3. Checking IAM binding for GSA '%s'...\n", gsaEmail)
+		bindingCheck := checkResult{
+			ID:       checkIamWorkloadIdentityUser,
+			Title:    fmt.Sprintf("Checking IAM binding for GSA '%s'", gsaEmail),
+			Severity: severityHigh,
+			DocLink:  docWorkloadIdentity,
+		}
 
 		// TODO: once inscpection capability for getIamPolicy is restored remove this.
 		if inspectionToken != "" {
-			fmt.Println("Currently serviceaccount IAM policy retreival is blocked using inspection token. Consider checking manually.")
-			return nil
-		}
-
-		iamClient, err := iam.NewIamClient(ctx, getClientOptions(ctx)...)
-		if err != nil {
-			return fmt.Errorf("failed to create IAM client: %w", err)
+			bindingCheck.Status = statusSkip
+			bindingCheck.Message = "Currently serviceaccount IAM policy retreival is blocked using inspection token. Consider checking manually."
+			report.add(bindingCheck)
+			return report, nil
 		}
-		defer iamClient.Close()
 
-		iamPolicy, err := iamClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-			Resource: fmt.Sprintf("projects/%s/serviceAccounts/%s", projectID, gsaEmail),
+		iamPolicy, err := clients.iam.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: gsaPolicyResource(gsaEmail),
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
 		})
 
 		if err != nil {
-			return fmt.Errorf("failed to get IAM policy for GSA '%s' (does it exist?): %w", gsaEmail, err)
+			switch status.Code(err) {
+			case codes.NotFound:
+				err = fmt.Errorf("failed to get IAM policy for GSA '%s': the GSA does not exist: %w", gsaEmail, err)
+			case codes.PermissionDenied:
+				err = fmt.Errorf("failed to get IAM policy for GSA '%s': reading it requires iam.serviceAccounts.getIamPolicy on the GSA: %w", gsaEmail, err)
+			default:
+				err = fmt.Errorf("failed to get IAM policy for GSA '%s': %w", gsaEmail, err)
+			}
+			return report, report.fail(bindingCheck, err)
+		}
+
+		// A policy can hold several roles/iam.workloadIdentityUser bindings with different
+		// conditions, so look at all of them rather than just the first.
+		env := gsaConditionEnv(report.GSAUniqueID)
+		for _, binding := range iamPolicy.InternalProto.GetBindings() {
+			if binding.Role != workloadIdentityUserRole {
+				continue
+			}
+			for _, m := range binding.Members {
+				if !slices.Contains(report.Members, m) {
+					report.Members = append(report.Members, m)
+				}
+				if principalAppliesTo(m, identity) {
+					report.Bindings = append(report.Bindings, newGrantedBinding(binding, m, gsaPolicyResource(gsaEmail), env))
+				}
+			}
 		}
 
-		bindingFound := iamPolicy.HasRole(fmt.Sprintf("serviceAccount:%s.svc.id.goog[%s/%s]", projectID, ksaNamespace, ksaName), "roles/iam.workloadIdentityUser")
+		// Prefer a binding known to be in effect; fall back to one whose condition can't be
+		// evaluated locally.
+		var bound *grantedBinding
+		for i := range report.Bindings {
+			b := &report.Bindings[i]
+			if b.effective() {
+				bound = b
+				break
+			}
+			if bound == nil && b.ConditionHolds == conditionUnknown {
+				bound = b
+			}
+		}
 
-		if !bindingFound {
-			return fmt.Errorf("IAM binding not found. Run the following command to fix:\n\ngcloud iam service-accounts add-iam-policy-binding %s \\\n  --role=roles/iam.workloadIdentityUser \\\n  --member=\"serviceAccount:%s.svc.id.goog[%s/%s]\"", gsaEmail, projectID, ksaNamespace, ksaName)
+		remediation := fmt.Sprintf("gcloud iam service-accounts add-iam-policy-binding %s \\\n  --role=roles/iam.workloadIdentityUser \\\n  --member=\"%s\"", gsaEmail, legacySyntax)
+		if bound == nil {
+			bindingCheck.Remediation = remediation
+			bindingCheck.Evidence = map[string]string{"expectedMember": legacySyntax}
+			if len(report.Bindings) > 0 {
+				// Every matching binding is conditional and its condition is false, e.g. expired.
+				bindingCheck.Evidence["condition"] = report.Bindings[0].Condition
+				bindingCheck.DocLink = docConditions
+				return report, report.fail(bindingCheck, fmt.Errorf("IAM binding for member '%s' with role roles/iam.workloadIdentityUser on GSA '%s' is conditional and its condition is false: %s", report.Bindings[0].Member, gsaEmail, report.Bindings[0].Condition))
+			}
+			return report, report.fail(bindingCheck, fmt.Errorf("IAM binding for member '%s' with role roles/iam.workloadIdentityUser not found on GSA '%s'", legacySyntax, gsaEmail))
 		}
-		fmt.Printf("   ✅ Found IAM binding for member '%s' with role roles/iam.workloadIdentityUser\n", legacySyntax)
+		bindingCheck.Status = statusPass
+		bindingCheck.Message = fmt.Sprintf("Found IAM binding for member '%s' with role roles/iam.workloadIdentityUser", bound.Member)
+		bindingCheck.Evidence = map[string]string{"member": bound.Member}
+		if bound.Condition != "" {
+			bindingCheck.Evidence["condition"] = bound.Condition
+			bindingCheck.Message += fmt.Sprintf(" if %s", bound.Condition)
+		}
+		if bound.ConditionHolds == conditionUnknown {
+			bindingCheck.Status = statusWarn
+			bindingCheck.DocLink = docConditions
+			bindingCheck.Message += ". The binding is conditional and its condition can't be evaluated locally, so impersonation may still be refused."
+			bindingCheck.Remediation = "If the condition doesn't hold for the workload, grant the role without a condition:\n" + remediation
+		}
+		report.add(bindingCheck)
+	}
 
-		fmt.Println("-------------------------------------------------------------")
-		fmt.Println("🎉 All checks passed! Your Workload Identity setup seems correct for this KSA.")
+	// 4. Check deny policies, which override the bindings found above, and grants left behind by a
+	// deleted GSA that was recreated with the same email.
+	resources, ancestryErr := workloadAncestry(ctx, clients, report)
+	if report.GSA != "" {
+		report.add(checkDeletedGSAMembers(ctx, clients, report, resources))
 	}
-	return nil
+	report.add(checkDenyPolicies(ctx, clients, report, resources, ancestryErr))
+	return report, nil
 }
 
 func getTokenFromConfig(ctx context.Context) oauth2.TokenSource {
@@ -17,21 +17,35 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	container "cloud.google.com/go/container/apiv1"
 	"cloud.google.com/go/container/apiv1/containerpb"
+	iampolicy "cloud.google.com/go/iam"
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
 	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/googleapis/gax-go/v2"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	clientcmd "k8s.io/client-go/tools/clientcmd"
@@ -140,9 +154,17 @@ func TestGetK8sClientset(t *testing.T) {
 	})
 }
 
+// setProjectID sets the global --project flag for the rest of the test and restores it afterwards.
+func setProjectID(t *testing.T, project string) {
+	t.Helper()
+	old := projectID
+	projectID = project
+	t.Cleanup(func() { projectID = old })
+}
+
 func TestPerformKsaCheck(t *testing.T) {
 	ctx := context.Background()
-	projectID = "test-project"
+	setProjectID(t, "test-project")
 	ksaNamespace := "default"
 	ksaName := "test-ksa"
 
@@ -159,22 +181,161 @@ func TestPerformKsaCheck(t *testing.T) {
 		Location: "us-central1",
 	}
 
-	// Mock IAM and ResourceManager clients are needed.
-	// Since we cannot modify the source to inject mocks, we can't fully test these.
-	// We will test the logic branches that don't require live clients.
-
 	t.Run("WI not enabled", func(t *testing.T) {
-		err := performKsaCheck(ctx, ksaNamespace, ksaName, clusterWithoutWI, fake.NewSimpleClientset())
+		report, err := performKsaCheck(ctx, nil, ksaNamespace, ksaName, clusterWithoutWI, fake.NewSimpleClientset())
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "Workload Identity is not enabled")
+		assert.Len(t, report.Checks, 1)
+		assert.Equal(t, checkClusterWorkloadIdentity, report.Checks[0].ID)
+		assert.Equal(t, statusFail, report.Status)
 	})
 
 	t.Run("KSA not found", func(t *testing.T) {
 		clientset := fake.NewSimpleClientset()
-		err := performKsaCheck(ctx, ksaNamespace, ksaName, clusterWithWI, clientset)
+		report, err := performKsaCheck(ctx, nil, ksaNamespace, ksaName, clusterWithWI, clientset)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to get Kubernetes Service Account")
+		assert.Equal(t, "test-project.svc.id.goog", report.Cluster.WorkloadPool)
+		assert.Len(t, report.Checks, 2)
+		assert.Equal(t, statusPass, report.Checks[0].Status)
+		assert.Equal(t, checkKsaExists, report.Checks[1].ID)
+		assert.Equal(t, statusFail, report.Checks[1].Status)
+	})
+
+	gsaEmail := "app@test-project.iam.gserviceaccount.com"
+	annotatedKsa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ksaName,
+			Namespace:   ksaNamespace,
+			Annotations: map[string]string{"iam.gke.io/gcp-service-account": gsaEmail},
+		},
+	}
+	plainKsa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: ksaName, Namespace: ksaNamespace}}
+	member := "serviceAccount:test-project.svc.id.goog[default/test-ksa]"
+
+	t.Run("Annotated with binding", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/iam.workloadIdentityUser", Members: []string{member}}},
+		}, nil, nil, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(annotatedKsa))
+		assert.NoError(t, err)
+		assert.Equal(t, statusPass, report.Status)
+		assert.Equal(t, gsaEmail, report.GSA)
+		assert.Equal(t, []string{member}, report.Members)
+	})
+
+	t.Run("Annotated without binding", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/iam.workloadIdentityUser", Members: []string{"serviceAccount:test-project.svc.id.goog[default/other]"}}},
+		}, nil, nil, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(annotatedKsa))
+		assert.Error(t, err)
+		last := report.Checks[len(report.Checks)-1]
+		assert.Equal(t, checkIamWorkloadIdentityUser, last.ID)
+		assert.Equal(t, statusFail, last.Status)
+		assert.Contains(t, last.Remediation, "gcloud iam service-accounts add-iam-policy-binding "+gsaEmail)
+	})
+
+	t.Run("Annotated GSA policy error", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, nil, status.Error(codes.NotFound, "not found"), nil, nil)
+		defer cleanup()
+
+		_, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(annotatedKsa))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get IAM policy for GSA")
+	})
+
+	t.Run("Direct binding found", func(t *testing.T) {
+		principal := "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/test-project.svc.id.goog/subject/ns/default/sa/test-ksa"
+		clients, cleanup := newMockGcpClients(ctx, t, nil, nil, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/storage.objectViewer", Members: []string{principal}}},
+		}, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(plainKsa))
+		assert.NoError(t, err)
+		assert.Equal(t, statusPass, report.Status)
+		assert.Equal(t, []string{principal}, report.Members)
+	})
+
+	t.Run("Direct binding missing", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, nil, nil, &iampb.Policy{}, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(plainKsa))
+		assert.NoError(t, err)
+		assert.Equal(t, statusWarn, report.Status)
+		assert.Equal(t, "123", report.Cluster.WorkloadPoolProjectNumber)
+		direct := findCheck(t, report, checkIamDirectBinding)
+		assert.Equal(t, "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/test-project.svc.id.goog/subject/ns/default/sa/test-ksa", direct.Evidence["expectedPrincipal"])
+	})
+
+	t.Run("Direct binding in another project's pool", func(t *testing.T) {
+		principal := "principal://iam.googleapis.com/projects/999/locations/global/workloadIdentityPools/test-project.svc.id.goog/subject/ns/default/sa/test-ksa"
+		clients, cleanup := newMockGcpClients(ctx, t, nil, nil, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/storage.objectViewer", Members: []string{principal}}},
+		}, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(plainKsa))
+		assert.NoError(t, err)
+		assert.Equal(t, statusWarn, report.Status)
+		assert.Empty(t, report.Members)
+	})
+
+	t.Run("Project policy error", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, nil, nil, nil, status.Error(codes.PermissionDenied, "denied"))
+		defer cleanup()
+
+		_, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, clusterWithWI, newMockClientset(plainKsa))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get IAM policy for project")
+	})
+
+	t.Run("Fleet workload pool", func(t *testing.T) {
+		fleetCluster := &containerpb.Cluster{
+			Name:                   "test-cluster",
+			Location:               "us-central1",
+			WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: "fleet-host.svc.id.goog"},
+		}
+		fleetMember := "serviceAccount:fleet-host.svc.id.goog[default/test-ksa]"
+
+		clients, cleanup := newMockGcpClients(ctx, t, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/iam.workloadIdentityUser", Members: []string{member}}},
+		}, nil, nil, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, fleetCluster, newMockClientset(annotatedKsa))
+		assert.Error(t, err)
+		last := report.Checks[len(report.Checks)-1]
+		assert.Equal(t, fleetMember, last.Evidence["expectedMember"])
+		assert.Contains(t, last.Remediation, "--member=\""+fleetMember+"\"")
+	})
+}
+
+func TestGetGKECluster(t *testing.T) {
+	ctx := context.Background()
+	server := &mockClusterManagerServer{Cluster: &containerpb.Cluster{Name: "test-cluster"}}
+	lis, conn := startMockServer(t, func(s *grpc.Server) {
+		containerpb.RegisterClusterManagerServer(s, server)
 	})
+	defer lis.Close()
+	defer conn.Close()
+
+	client, err := container.NewClusterManagerClient(ctx, getMockClientOptions(ctx, conn)...)
+	assert.NoError(t, err)
+
+	cluster, err := getGKECluster(ctx, client, "test-project", "us-central1", "test-cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-cluster", cluster.Name)
+
+	server.Err = status.Error(codes.NotFound, "cluster not found")
+	_, err = getGKECluster(ctx, client, "test-project", "us-central1", "missing")
+	assert.Error(t, err)
 }
 
 func TestGetTokenFromConfig(t *testing.T) {
@@ -244,8 +405,8 @@ func TestGetClientOptions(t *testing.T) {
 	})
 }
 
-// The following tests require live or mocked GCP services.
-// Since we cannot modify the source to inject mocks, these tests are limited.
+// The following helpers stand in for the GCP services. The mock servers are served over
+// a local gRPC listener and wired into gcpClients through small adapters.
 
 type mockClusterManagerServer struct {
 	containerpb.UnimplementedClusterManagerServer
@@ -290,21 +451,100 @@ func newMockClientset(ksa *corev1.ServiceAccount) kubernetes.Interface {
 	return fake.NewSimpleClientset(ksa)
 }
 
+// iamAdminAdapter exposes an IAMPolicy gRPC client through the iamAdminClient interface.
+type iamAdminAdapter struct {
+	client iampb.IAMPolicyClient
+}
+
+func (a *iamAdminAdapter) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampolicy.Policy, error) {
+	policy, err := a.client.GetIamPolicy(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &iampolicy.Policy{InternalProto: policy}, nil
+}
+
+func (a *iamAdminAdapter) SetIamPolicy(ctx context.Context, req *iam.SetIamPolicyRequest) (*iampolicy.Policy, error) {
+	policy, err := a.client.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: req.Resource, Policy: req.Policy.InternalProto})
+	if err != nil {
+		return nil, err
+	}
+	return &iampolicy.Policy{InternalProto: policy}, nil
+}
+
+func (a *iamAdminAdapter) GetRole(ctx context.Context, req *adminpb.GetRoleRequest, opts ...gax.CallOption) (*adminpb.Role, error) {
+	return nil, status.Errorf(codes.Unimplemented, "GetRole is not served by the mock IAM server")
+}
+
+// GetServiceAccount reports every GSA as existing and enabled.
+func (a *iamAdminAdapter) GetServiceAccount(ctx context.Context, req *adminpb.GetServiceAccountRequest, opts ...gax.CallOption) (*adminpb.ServiceAccount, error) {
+	email := path.Base(req.Name)
+	return &adminpb.ServiceAccount{Name: req.Name, Email: email, UniqueId: "100", ProjectId: gsaProject(email)}, nil
+}
+
+func (a *iamAdminAdapter) ListServiceAccountKeys(ctx context.Context, req *adminpb.ListServiceAccountKeysRequest, opts ...gax.CallOption) (*adminpb.ListServiceAccountKeysResponse, error) {
+	return &adminpb.ListServiceAccountKeysResponse{}, nil
+}
+
+// projectPolicyAdapter exposes an IAMPolicy gRPC client through the projectPolicyClient interface.
+// Projects are looked up in numbers, keyed by project ID.
+type projectPolicyAdapter struct {
+	client  iampb.IAMPolicyClient
+	numbers map[string]string
+}
+
+func (a *projectPolicyAdapter) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error) {
+	return a.client.GetIamPolicy(ctx, req)
+}
+
+func (a *projectPolicyAdapter) GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest, opts ...gax.CallOption) (*resourcemanagerpb.Project, error) {
+	id := strings.TrimPrefix(req.Name, "projects/")
+	number, ok := a.numbers[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "project %s not found", id)
+	}
+	return &resourcemanagerpb.Project{Name: "projects/" + number, ProjectId: id}, nil
+}
+
+// findCheck returns the report's check with the given ID.
+func findCheck(t *testing.T, report *ksaReport, id string) checkResult {
+	t.Helper()
+	for _, c := range report.Checks {
+		if c.ID == id {
+			return c
+		}
+	}
+	t.Fatalf("check %s not found in report", id)
+	return checkResult{}
+}
+
 func newMockGcpClients(ctx context.Context, t *testing.T, iamPolicy *iampb.Policy, iamErr error, rmPolicy *iampb.Policy, rmErr error) (
-	*grpc.ClientConn, func()) {
+	*gcpClients, func()) {
 
+	iamServer := &mockIAMPolicyServer{Policy: iamPolicy, Err: iamErr}
 	rmServer := &mockIAMPolicyServer{Policy: rmPolicy, Err: rmErr}
 
+	iamLis, iamConn := startMockServer(t, func(s *grpc.Server) {
+		iampb.RegisterIAMPolicyServer(s, iamServer)
+	})
 	rmLis, rmConn := startMockServer(t, func(s *grpc.Server) {
 		iampb.RegisterIAMPolicyServer(s, rmServer)
 	})
 
+	clients := &gcpClients{
+		iam:          &iamAdminAdapter{client: iampb.NewIAMPolicyClient(iamConn)},
+		projects:     &projectPolicyAdapter{client: iampb.NewIAMPolicyClient(rmConn), numbers: map[string]string{"test-project": "123"}},
+		denyPolicies: &fakeDenyPolicies{},
+	}
+
 	cleanup := func() {
+		iamConn.Close()
+		iamLis.Close()
 		rmConn.Close()
 		rmLis.Close()
 	}
 
-	return rmConn, cleanup
+	return clients, cleanup
 }
 
 func startMockServer(t *testing.T, register func(s *grpc.Server)) (net.Listener, *grpc.ClientConn) {
@@ -328,3 +568,134 @@ func getMockClientOptions(ctx context.Context, conn *grpc.ClientConn) []option.C
 		option.WithGRPCConn(conn),
 	}
 }
+
+func TestRenderText(t *testing.T) {
+	report := newKsaReport("test-cluster", "us-central1", "default", "test-ksa")
+	report.add(checkResult{ID: checkClusterWorkloadIdentity, Title: "Checking cluster", Status: statusPass, Message: "Workload Identity is enabled."})
+	report.fail(checkResult{ID: checkIamWorkloadIdentityUser, Title: "Checking IAM binding", Remediation: "gcloud iam service-accounts add-iam-policy-binding"}, fmt.Errorf("IAM binding not found"))
+
+	var buf bytes.Buffer
+	report.renderText(&buf)
+	out := buf.String()
+
+	assert.Contains(t, out, "1. Checking cluster")
+	assert.Contains(t, out, "✅ Workload Identity is enabled.")
+	assert.Contains(t, out, "❌ IAM binding not found")
+	assert.Contains(t, out, "gcloud iam service-accounts add-iam-policy-binding")
+	assert.Equal(t, statusFail, report.Status)
+}
+
+func TestWriteOutput(t *testing.T) {
+	setProjectID(t, "test-project")
+	report := newKsaReport("test-cluster", "us-central1", "default", "test-ksa")
+	report.GSA = "gsa@test-project.iam.gserviceaccount.com"
+	report.add(checkResult{ID: checkKsaExists, Title: "Checking KSA", Status: statusPass, Severity: severityHigh, Message: "Found KSA."})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, writeOutput(&buf, outputJSON, report))
+
+		var doc map[string]interface{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+		assert.Equal(t, reportAPIVersion, doc["apiVersion"])
+		assert.Equal(t, "pass", doc["status"])
+		assert.Equal(t, "gsa@test-project.iam.gserviceaccount.com", doc["gsa"])
+		assert.Len(t, doc["checks"], 1)
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, writeOutput(&buf, outputYAML, report))
+		assert.Contains(t, buf.String(), "apiVersion: "+reportAPIVersion)
+		assert.Contains(t, buf.String(), "id: "+checkKsaExists)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		assert.Error(t, validateOutputFormat("xml"))
+		assert.Error(t, writeOutput(&bytes.Buffer{}, "xml", report))
+	})
+}
+
+// countingProjects counts GetProject calls to verify that project numbers are cached.
+type countingProjects struct {
+	projectPolicyAdapter
+	calls int
+}
+
+func (c *countingProjects) GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest, opts ...gax.CallOption) (*resourcemanagerpb.Project, error) {
+	c.calls++
+	return c.projectPolicyAdapter.GetProject(ctx, req, opts...)
+}
+
+func TestProjectNumber(t *testing.T) {
+	ctx := context.Background()
+	projects := &countingProjects{projectPolicyAdapter: projectPolicyAdapter{numbers: map[string]string{"test-project": "123"}}}
+	clients := &gcpClients{projects: projects}
+
+	for i := 0; i < 3; i++ {
+		number, err := clients.projectNumber(ctx, "test-project")
+		assert.NoError(t, err)
+		assert.Equal(t, "123", number)
+	}
+	assert.Equal(t, 1, projects.calls)
+
+	_, err := clients.projectNumber(ctx, "missing-project")
+	assert.Error(t, err)
+}
+
+// blockingProjects holds GetProject calls for "slow-project" until release is closed, and counts
+// the calls for each project.
+type blockingProjects struct {
+	projectPolicyAdapter
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (b *blockingProjects) GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest, opts ...gax.CallOption) (*resourcemanagerpb.Project, error) {
+	b.mu.Lock()
+	b.calls[req.Name]++
+	b.mu.Unlock()
+	if req.Name == "projects/slow-project" {
+		<-b.release
+	}
+	return b.projectPolicyAdapter.GetProject(ctx, req, opts...)
+}
+
+func TestProjectNumberConcurrent(t *testing.T) {
+	ctx := context.Background()
+	projects := &blockingProjects{
+		projectPolicyAdapter: projectPolicyAdapter{numbers: map[string]string{"slow-project": "123", "test-project": "456"}},
+		release:              make(chan struct{}),
+		calls:                map[string]int{},
+	}
+	clients := &gcpClients{projects: projects}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			number, err := clients.projectNumber(ctx, "slow-project")
+			assert.NoError(t, err)
+			assert.Equal(t, "123", number)
+		}()
+	}
+
+	// A slow lookup must not hold up lookups of other projects.
+	number, err := clients.projectNumber(ctx, "test-project")
+	assert.NoError(t, err)
+	assert.Equal(t, "456", number)
+
+	close(projects.release)
+	wg.Wait()
+	assert.LessOrEqual(t, projects.calls["projects/slow-project"], 3)
+	assert.Equal(t, 1, projects.calls["projects/test-project"])
+
+	// Once cached, the slow project isn't looked up again.
+	calls := projects.calls["projects/slow-project"]
+	_, err = clients.projectNumber(ctx, "slow-project")
+	assert.NoError(t, err)
+	assert.Equal(t, calls, projects.calls["projects/slow-project"])
+}
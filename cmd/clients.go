@@ -0,0 +1,393 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampolicy "cloud.google.com/go/iam"
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	iamv2 "cloud.google.com/go/iam/apiv2"
+	iamv2pb "cloud.google.com/go/iam/apiv2/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/singleflight"
+	crmv1 "google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/iterator"
+	storagev1 "google.golang.org/api/storage/v1"
+	htransport "google.golang.org/api/transport/http"
+	"google.golang.org/genproto/googleapis/type/expr"
+)
+
+// clusterGetter looks up GKE clusters. It is satisfied by *container.ClusterManagerClient.
+type clusterGetter interface {
+	GetCluster(ctx context.Context, req *containerpb.GetClusterRequest, opts ...gax.CallOption) (*containerpb.Cluster, error)
+}
+
+// iamAdminClient reads Google Service Accounts and their keys, reads and updates the IAM policies
+// attached to them, and reads role definitions. It is satisfied by *iam.IamClient.
+type iamAdminClient interface {
+	GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampolicy.Policy, error)
+	SetIamPolicy(ctx context.Context, req *iam.SetIamPolicyRequest) (*iampolicy.Policy, error)
+	GetRole(ctx context.Context, req *adminpb.GetRoleRequest, opts ...gax.CallOption) (*adminpb.Role, error)
+	GetServiceAccount(ctx context.Context, req *adminpb.GetServiceAccountRequest, opts ...gax.CallOption) (*adminpb.ServiceAccount, error)
+	ListServiceAccountKeys(ctx context.Context, req *adminpb.ListServiceAccountKeysRequest, opts ...gax.CallOption) (*adminpb.ListServiceAccountKeysResponse, error)
+}
+
+// projectPolicyClient reads projects and the IAM policies attached to them.
+// It is satisfied by *resourcemanager.ProjectsClient.
+type projectPolicyClient interface {
+	GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error)
+	GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest, opts ...gax.CallOption) (*resourcemanagerpb.Project, error)
+}
+
+// folderClient reads folders and the IAM policies attached to them.
+// It is satisfied by *resourcemanager.FoldersClient.
+type folderClient interface {
+	GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error)
+	GetFolder(ctx context.Context, req *resourcemanagerpb.GetFolderRequest, opts ...gax.CallOption) (*resourcemanagerpb.Folder, error)
+}
+
+// organizationPolicyClient reads IAM policies attached to organizations.
+// It is satisfied by *resourcemanager.OrganizationsClient.
+type organizationPolicyClient interface {
+	GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error)
+}
+
+// orgPolicyClient evaluates organization policy constraints on a resource, taking inheritance into account.
+type orgPolicyClient interface {
+	BooleanPolicyEnforced(ctx context.Context, resource, constraint string) (bool, error)
+}
+
+// crmOrgPolicyClient implements orgPolicyClient with the Cloud Resource Manager v1 API, which
+// computes the effective policy of a project from its own policy and its ancestors'.
+type crmOrgPolicyClient struct {
+	service *crmv1.Service
+}
+
+func (c *crmOrgPolicyClient) BooleanPolicyEnforced(ctx context.Context, resource, constraint string) (bool, error) {
+	policy, err := c.service.Projects.GetEffectiveOrgPolicy(resource, &crmv1.GetEffectiveOrgPolicyRequest{
+		Constraint: "constraints/" + constraint,
+	}).Context(ctx).Do()
+	if err != nil {
+		return false, err
+	}
+	return policy.BooleanPolicy != nil && policy.BooleanPolicy.Enforced, nil
+}
+
+// bucketClient reads Cloud Storage buckets and the IAM policies attached to them.
+type bucketClient interface {
+	GetBucketIamPolicy(ctx context.Context, bucket string) (*iampb.Policy, error)
+	GetBucketProjectNumber(ctx context.Context, bucket string) (string, error)
+}
+
+// storageBucketClient implements bucketClient with the Cloud Storage JSON API.
+type storageBucketClient struct {
+	service *storagev1.Service
+}
+
+func (c *storageBucketClient) GetBucketIamPolicy(ctx context.Context, bucket string) (*iampb.Policy, error) {
+	policy, err := c.service.Buckets.GetIamPolicy(bucket).OptionsRequestedPolicyVersion(3).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	converted := &iampb.Policy{Version: int32(policy.Version)}
+	for _, b := range policy.Bindings {
+		binding := &iampb.Binding{Role: b.Role, Members: b.Members}
+		if b.Condition != nil {
+			binding.Condition = &expr.Expr{Expression: b.Condition.Expression, Title: b.Condition.Title, Description: b.Condition.Description}
+		}
+		converted.Bindings = append(converted.Bindings, binding)
+	}
+	return converted, nil
+}
+
+func (c *storageBucketClient) GetBucketProjectNumber(ctx context.Context, bucket string) (string, error) {
+	b, err := c.service.Buckets.Get(bucket).Fields("projectNumber").Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(b.ProjectNumber), nil
+}
+
+// denyPolicyClient lists the IAM deny policies attached to a resource.
+type denyPolicyClient interface {
+	ListDenyPolicies(ctx context.Context, attachmentPoint string) ([]*iamv2pb.Policy, error)
+}
+
+// iamDenyPolicyClient implements denyPolicyClient with the IAM v2 API. Listing only returns policy
+// metadata, so each policy is read again to get its rules.
+type iamDenyPolicyClient struct {
+	client *iamv2.PoliciesClient
+}
+
+func (c *iamDenyPolicyClient) ListDenyPolicies(ctx context.Context, attachmentPoint string) ([]*iamv2pb.Policy, error) {
+	parent := fmt.Sprintf("policies/%s/denypolicies", url.PathEscape(attachmentPoint))
+	var policies []*iamv2pb.Policy
+	it := c.client.ListPolicies(ctx, &iamv2pb.ListPoliciesRequest{Parent: parent})
+	for {
+		p, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		policy, err := c.client.GetPolicy(ctx, &iamv2pb.GetPolicyRequest{Name: p.Name})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// serviceAccountLister lists the Google Service Accounts of a project.
+type serviceAccountLister interface {
+	ListServiceAccounts(ctx context.Context, project string) ([]*adminpb.ServiceAccount, error)
+}
+
+// iamServiceAccountLister implements serviceAccountLister with the IAM admin API.
+type iamServiceAccountLister struct {
+	client *iam.IamClient
+}
+
+func (l *iamServiceAccountLister) ListServiceAccounts(ctx context.Context, project string) ([]*adminpb.ServiceAccount, error) {
+	var accounts []*adminpb.ServiceAccount
+	it := l.client.ListServiceAccounts(ctx, &adminpb.ListServiceAccountsRequest{Name: "projects/" + project})
+	for {
+		sa, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, sa)
+	}
+	return accounts, nil
+}
+
+// gcpClients is the set of Google Cloud API clients shared by every check in a single run.
+// The clients are safe for concurrent use, so one set can serve a whole cluster scan.
+// Tests swap the fields for stand-ins backed by local gRPC servers.
+type gcpClients struct {
+	gke            clusterGetter
+	iam            iamAdminClient
+	projects       projectPolicyClient
+	folders        folderClient
+	organizations  organizationPolicyClient
+	orgPolicies    orgPolicyClient
+	buckets        bucketClient
+	troubleshooter policyTroubleshooter
+	denyPolicies   denyPolicyClient
+	gsas           serviceAccountLister
+
+	closers []io.Closer
+
+	projectCache runCache[*resourcemanagerpb.Project]
+	roleCache    runCache[[]string]
+	denyCache    runCache[[]*iamv2pb.Policy]
+	folderCache  runCache[*resourcemanagerpb.Folder]
+	policyCache  runCache[*iampb.Policy]
+}
+
+// runCache memoizes lookups for the whole run. Concurrent lookups of the same key share a single
+// call, while lookups of different keys proceed in parallel. Failed lookups aren't cached.
+type runCache[V any] struct {
+	mu     sync.Mutex
+	values map[string]V
+	group  singleflight.Group
+}
+
+// get returns the cached value for key, calling load if there isn't one yet.
+func (c *runCache[V]) get(key string, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	v, ok := c.values[key]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		v, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.values == nil {
+			c.values = map[string]V{}
+		}
+		c.values[key] = v
+		c.mu.Unlock()
+		return v, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return result.(V), nil
+}
+
+// newGCPClients creates every Google Cloud API client the checks use with the necessary options,
+// including the inspection token if it's set.
+func newGCPClients(ctx context.Context) (*gcpClients, error) {
+	clients := &gcpClients{}
+
+	gkeClient, err := newGKEClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GKE client: %w", err)
+	}
+	clients.gke = gkeClient
+	clients.closers = append(clients.closers, gkeClient)
+
+	iamClient, err := iam.NewIamClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create IAM client: %w", err)
+	}
+	clients.iam = iamClient
+	clients.gsas = &iamServiceAccountLister{client: iamClient}
+	clients.closers = append(clients.closers, iamClient)
+
+	projectsClient, err := resourcemanager.NewProjectsClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Cloud Resource Manager client: %w", err)
+	}
+	clients.projects = projectsClient
+	clients.closers = append(clients.closers, projectsClient)
+
+	foldersClient, err := resourcemanager.NewFoldersClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Cloud Resource Manager folders client: %w", err)
+	}
+	clients.folders = foldersClient
+	clients.closers = append(clients.closers, foldersClient)
+
+	organizationsClient, err := resourcemanager.NewOrganizationsClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Cloud Resource Manager organizations client: %w", err)
+	}
+	clients.organizations = organizationsClient
+	clients.closers = append(clients.closers, organizationsClient)
+
+	crmService, err := crmv1.NewService(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Cloud Resource Manager v1 client: %w", err)
+	}
+	clients.orgPolicies = &crmOrgPolicyClient{service: crmService}
+
+	storageService, err := storagev1.NewService(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Cloud Storage client: %w", err)
+	}
+	clients.buckets = &storageBucketClient{service: storageService}
+
+	troubleshooterClient, _, err := htransport.NewClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create Policy Troubleshooter client: %w", err)
+	}
+	clients.troubleshooter = &restPolicyTroubleshooter{client: troubleshooterClient, endpoint: policyTroubleshooterEndpoint}
+
+	policiesClient, err := iamv2.NewPoliciesClient(ctx, getClientOptions(ctx)...)
+	if err != nil {
+		clients.Close()
+		return nil, fmt.Errorf("failed to create IAM v2 policies client: %w", err)
+	}
+	clients.denyPolicies = &iamDenyPolicyClient{client: policiesClient}
+	clients.closers = append(clients.closers, policiesClient)
+
+	return clients, nil
+}
+
+// getProject looks up a project by ID. Projects are cached for the whole run.
+func (c *gcpClients) getProject(ctx context.Context, project string) (*resourcemanagerpb.Project, error) {
+	return c.projectCache.get(project, func() (*resourcemanagerpb.Project, error) {
+		p, err := c.projects.GetProject(ctx, &resourcemanagerpb.GetProjectRequest{Name: "projects/" + project})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project '%s': %w", project, err)
+		}
+		return p, nil
+	})
+}
+
+// getFolder looks up a folder by resource name. Folders are cached for the whole run, as every
+// KSA in a scan walks the same ancestry.
+func (c *gcpClients) getFolder(ctx context.Context, folder string) (*resourcemanagerpb.Folder, error) {
+	return c.folderCache.get(folder, func() (*resourcemanagerpb.Folder, error) {
+		f, err := c.folders.GetFolder(ctx, &resourcemanagerpb.GetFolderRequest{Name: folder})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get folder '%s': %w", folder, err)
+		}
+		return f, nil
+	})
+}
+
+// projectNumber resolves a project ID to its project number. principal:// identifiers carry the
+// number, while flags and workload pools carry the ID.
+func (c *gcpClients) projectNumber(ctx context.Context, project string) (string, error) {
+	p, err := c.getProject(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(p.Name, "projects/"), nil
+}
+
+// rolePermissions expands a predefined or custom role into the permissions it includes.
+// Role definitions are cached for the whole run.
+func (c *gcpClients) rolePermissions(ctx context.Context, role string) ([]string, error) {
+	return c.roleCache.get(role, func() ([]string, error) {
+		r, err := c.iam.GetRole(ctx, &adminpb.GetRoleRequest{Name: role})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role '%s': %w", role, err)
+		}
+		return r.IncludedPermissions, nil
+	})
+}
+
+// denyPoliciesAt returns the deny policies attached to a project, folder or organization. Policies
+// are cached for the whole run, as every KSA in a scan shares the same ancestry.
+func (c *gcpClients) denyPoliciesAt(ctx context.Context, resource string) ([]*iamv2pb.Policy, error) {
+	return c.denyCache.get(resource, func() ([]*iamv2pb.Policy, error) {
+		policies, err := c.denyPolicies.ListDenyPolicies(ctx, "cloudresourcemanager.googleapis.com/"+resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deny policies on '%s': %w", resource, err)
+		}
+		return policies, nil
+	})
+}
+
+// Close releases every client that was successfully created.
+func (c *gcpClients) Close() {
+	for _, closer := range c.closers {
+		closer.Close()
+	}
+}
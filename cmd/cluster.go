@@ -0,0 +1,265 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clusterScanOptions controls which namespaces a cluster scan visits and how wide it fans out.
+type clusterScanOptions struct {
+	includeNamespaces []string
+	excludeNamespaces []string
+	namespaceSelector string
+	concurrency       int
+}
+
+var clusterScanOpts clusterScanOptions
+
+// clusterCmd represents the cluster command
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Audits the Workload Identity configuration of every KSA and workload in the cluster.",
+	Long: `Walks every namespace in the cluster and verifies the Workload Identity setup of all
+Kubernetes Service Accounts and pod-owning workloads, then prints a pass/warn/fail summary per namespace.
+
+Namespaces can be narrowed down with --include-namespaces, --exclude-namespaces (both accept glob
+patterns such as 'team-*') and --namespace-selector. Checks run concurrently, bounded by --concurrency,
+and share a single set of GKE, IAM and Resource Manager clients.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		clientset, err := getK8sClientset(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		report, err := performClusterCheck(ctx, clients, cluster, clientset, clusterScanOpts)
+		if err != nil {
+			log.Fatalf("❌ Failed to scan cluster '%s': %v", cluster.Name, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ One or more namespaces in cluster '%s' failed their checks.", cluster.Name)
+		}
+	},
+}
+
+// namespaceSummary counts KSA verdicts for one namespace.
+type namespaceSummary struct {
+	Namespace string `json:"namespace"`
+	KSAs      int    `json:"ksas"`
+	Pass      int    `json:"pass"`
+	Warn      int    `json:"warn"`
+	Fail      int    `json:"fail"`
+	Error     string `json:"error,omitempty"`
+}
+
+// clusterReport aggregates the namespace reports for a whole cluster.
+type clusterReport struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Status     checkStatus        `json:"status"`
+	Cluster    clusterInfo        `json:"cluster"`
+	Summary    []namespaceSummary `json:"summary"`
+	Namespaces []*namespaceReport `json:"namespaces"`
+}
+
+// matchesAny reports whether name matches one of the glob patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectNamespaces lists the namespaces matching the selector and include/exclude filters.
+func selectNamespaces(ctx context.Context, clientset kubernetes.Interface, opts clusterScanOptions) ([]string, error) {
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: opts.namespaceSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var selected []string
+	for _, ns := range namespaces.Items {
+		if len(opts.includeNamespaces) > 0 && !matchesAny(ns.Name, opts.includeNamespaces) {
+			continue
+		}
+		if matchesAny(ns.Name, opts.excludeNamespaces) {
+			continue
+		}
+		selected = append(selected, ns.Name)
+	}
+	sort.Strings(selected)
+	return selected, nil
+}
+
+// performClusterCheck scans every selected namespace. Namespace discovery and the KSA checks
+// both run on a worker pool of opts.concurrency goroutines. A namespace that cannot be listed is
+// reported as failed rather than aborting the whole scan.
+func performClusterCheck(ctx context.Context, clients *gcpClients, cluster *containerpb.Cluster, clientset kubernetes.Interface, opts clusterScanOptions) (*clusterReport, error) {
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	namespaces, err := selectNamespaces(ctx, clientset, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Phase 1: discover workloads and KSAs per namespace.
+	reports := make([]*namespaceReport, len(namespaces))
+	ksaNames := make([][]string, len(namespaces))
+	g := &errgroup.Group{}
+	g.SetLimit(opts.concurrency)
+	for i, ns := range namespaces {
+		g.Go(func() error {
+			reports[i] = newNamespaceReport(ns, cluster)
+			workloads, names, err := discoverNamespace(ctx, clientset, ns)
+			if err != nil {
+				reports[i].Error = err.Error()
+				reports[i].Status = statusFail
+				return nil
+			}
+			reports[i].Workloads = append(reports[i].Workloads, workloads...)
+			ksaNames[i] = names
+			return nil
+		})
+	}
+	g.Wait()
+
+	// Phase 2: run the KSA checks. Every job writes to its own slot, so no locking is needed.
+	type ksaJob struct {
+		nsIndex int
+		name    string
+	}
+	var jobs []ksaJob
+	for i, names := range ksaNames {
+		for _, name := range names {
+			jobs = append(jobs, ksaJob{nsIndex: i, name: name})
+		}
+	}
+	results := make([]*ksaReport, len(jobs))
+	g = &errgroup.Group{}
+	g.SetLimit(opts.concurrency)
+	for i, job := range jobs {
+		g.Go(func() error {
+			// The error is already captured as a failed check inside the KSA report.
+			results[i], _ = performKsaCheck(ctx, clients, namespaces[job.nsIndex], job.name, cluster, clientset)
+			return nil
+		})
+	}
+	g.Wait()
+
+	for i, job := range jobs {
+		reports[job.nsIndex].addKsaReport(results[i])
+	}
+
+	report := &clusterReport{
+		APIVersion: reportAPIVersion,
+		Kind:       "ClusterReport",
+		Status:     statusPass,
+		Cluster:    clusterInfo{Project: projectID, Location: cluster.Location, Name: cluster.Name},
+		Summary:    []namespaceSummary{},
+		Namespaces: reports,
+	}
+	if cluster.WorkloadIdentityConfig != nil {
+		report.Cluster.WorkloadPool = cluster.WorkloadIdentityConfig.WorkloadPool
+	}
+	for _, ns := range reports {
+		summary := namespaceSummary{Namespace: ns.Namespace, KSAs: len(ns.KSAReports), Error: ns.Error}
+		for _, ksa := range ns.KSAReports {
+			switch ksa.Status {
+			case statusPass:
+				summary.Pass++
+			case statusWarn:
+				summary.Warn++
+			case statusFail:
+				summary.Fail++
+			}
+		}
+		report.Summary = append(report.Summary, summary)
+		if statusRank(ns.Status) > statusRank(report.Status) {
+			report.Status = ns.Status
+		}
+	}
+	return report, nil
+}
+
+// renderText writes the findings that need attention followed by the per-namespace summary table.
+func (r *clusterReport) renderText(w io.Writer) {
+	fmt.Fprintf(w, "🔎 Workload Identity audit for cluster '%s' (%d namespace(s))\n", r.Cluster.Name, len(r.Namespaces))
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+
+	for _, ns := range r.Namespaces {
+		if ns.Error != "" {
+			fmt.Fprintf(w, "❌ %s: %s\n", ns.Namespace, ns.Error)
+		}
+		for _, ksa := range ns.KSAReports {
+			for _, c := range ksa.Checks {
+				if c.Status != statusWarn && c.Status != statusFail {
+					continue
+				}
+				fmt.Fprintf(w, "%s %s/%s [%s] %s\n", statusIcon(c.Status), ns.Namespace, ksa.KSA.Name, c.ID, c.Message)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tKSAS\tPASS\tWARN\tFAIL")
+	for _, s := range r.Summary {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", s.Namespace, s.KSAs, s.Pass, s.Warn, s.Fail)
+	}
+	tw.Flush()
+}
+
+func init() {
+	checkCmd.AddCommand(clusterCmd)
+	clusterCmd.Flags().StringSliceVar(&clusterScanOpts.includeNamespaces, "include-namespaces", nil, "Only scan namespaces matching these glob patterns")
+	clusterCmd.Flags().StringSliceVar(&clusterScanOpts.excludeNamespaces, "exclude-namespaces", []string{"kube-system", "kube-public", "kube-node-lease", "gke-*", "gmp-*"}, "Skip namespaces matching these glob patterns")
+	clusterCmd.Flags().StringVar(&clusterScanOpts.namespaceSelector, "namespace-selector", "", "Only scan namespaces matching this label selector (e.g. 'team=payments')")
+	clusterCmd.Flags().IntVar(&clusterScanOpts.concurrency, "concurrency", 8, "Maximum number of concurrent checks")
+}
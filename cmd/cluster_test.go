@@ -0,0 +1,73 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPerformClusterCheck(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tier": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team-a"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "team-a"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team-b"}},
+	)
+
+	// Without Workload Identity every KSA check stops at the cluster step.
+	cluster := &containerpb.Cluster{Name: "test-cluster", Location: "us-central1"}
+
+	t.Run("Filters", func(t *testing.T) {
+		names, err := selectNamespaces(ctx, clientset, clusterScanOptions{excludeNamespaces: []string{"kube-*"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sandbox", "team-a", "team-b"}, names)
+
+		names, err = selectNamespaces(ctx, clientset, clusterScanOptions{includeNamespaces: []string{"team-*"}, excludeNamespaces: []string{"team-b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"team-a"}, names)
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		opts := clusterScanOptions{namespaceSelector: "tier=prod", concurrency: 4}
+		report, err := performClusterCheck(ctx, nil, cluster, clientset, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, statusFail, report.Status)
+		assert.Equal(t, []namespaceSummary{
+			{Namespace: "team-a", KSAs: 2, Fail: 2},
+			{Namespace: "team-b", KSAs: 1, Fail: 1},
+		}, report.Summary)
+
+		var buf bytes.Buffer
+		report.renderText(&buf)
+		assert.Contains(t, buf.String(), "NAMESPACE")
+		assert.Contains(t, buf.String(), "team-a/api")
+	})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+)
+
+const docConditions = "https://cloud.google.com/iam/docs/conditions-overview"
+
+// conditionVerdict is the outcome of evaluating an IAM condition locally.
+type conditionVerdict string
+
+const (
+	conditionTrue  conditionVerdict = "true"
+	conditionFalse conditionVerdict = "false"
+	// conditionUnknown means the condition depends on attributes that are only known at request
+	// time, uses functions IAM provides but CEL doesn't, or is invalid.
+	conditionUnknown conditionVerdict = "unknown"
+)
+
+// conditionEnv holds the request attributes known ahead of the request. Empty resource attributes
+// are unknown.
+type conditionEnv struct {
+	now             time.Time
+	resourceName    string
+	resourceType    string
+	resourceService string
+}
+
+// requestOnlyAttributes are IAM condition attributes that are only known when a request is made,
+// so they are always left unbound.
+var requestOnlyAttributes = []string{"request.auth", "request.host", "request.path", "destination.ip", "destination.port"}
+
+// conditionCELEnv declares the attributes IAM conditions can refer to.
+var conditionCELEnv = sync.OnceValues(func() (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		cel.Variable("request.time", cel.TimestampType),
+		cel.Variable("resource.name", cel.StringType),
+		cel.Variable("resource.type", cel.StringType),
+		cel.Variable("resource.service", cel.StringType),
+	}
+	for _, name := range requestOnlyAttributes {
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	return cel.NewEnv(opts...)
+})
+
+// evaluateCondition evaluates an IAM condition with CEL. Attributes the environment doesn't know
+// are unbound, so the condition is unknown unless the known attributes decide it on their own,
+// e.g. one false operand of &&. Conditions that don't compile, such as those calling
+// resource.matchTag or api.getAttribute, and conditions that fail to evaluate are unknown too.
+func evaluateCondition(expression string, env conditionEnv) conditionVerdict {
+	celEnv, err := conditionCELEnv()
+	if err != nil {
+		return conditionUnknown
+	}
+	ast, issues := celEnv.Compile(expression)
+	if issues.Err() != nil {
+		return conditionUnknown
+	}
+	program, err := celEnv.Program(ast, cel.EvalOptions(cel.OptPartialEval))
+	if err != nil {
+		return conditionUnknown
+	}
+
+	vars := map[string]any{"request.time": env.now}
+	var unbound []*cel.AttributePatternType
+	for name, value := range map[string]string{
+		"resource.name":    env.resourceName,
+		"resource.type":    env.resourceType,
+		"resource.service": env.resourceService,
+	} {
+		if value != "" {
+			vars[name] = value
+		} else {
+			unbound = append(unbound, cel.AttributePattern(name))
+		}
+	}
+	for _, name := range requestOnlyAttributes {
+		unbound = append(unbound, cel.AttributePattern(name))
+	}
+	activation, err := cel.PartialVars(vars, unbound...)
+	if err != nil {
+		return conditionUnknown
+	}
+
+	out, _, err := program.Eval(activation)
+	if err != nil || types.IsUnknown(out) {
+		return conditionUnknown
+	}
+	switch out {
+	case types.True:
+		return conditionTrue
+	case types.False:
+		return conditionFalse
+	}
+	return conditionUnknown
+}
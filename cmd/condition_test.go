@@ -0,0 +1,167 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/expr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	env := conditionEnv{
+		now:             time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		resourceName:    "projects/_/buckets/assets",
+		resourceType:    "storage.googleapis.com/Bucket",
+		resourceService: "storage.googleapis.com",
+	}
+
+	tests := []struct {
+		expression string
+		want       conditionVerdict
+	}{
+		{`request.time < timestamp("2030-01-01T00:00:00Z")`, conditionTrue},
+		{`request.time < timestamp("2025-01-01T00:00:00Z")`, conditionFalse},
+		{`request.time >= timestamp('2026-03-01T12:00:00Z') && request.time <= timestamp('2026-03-02T00:00:00.000Z')`, conditionTrue},
+		{`resource.name.startsWith("projects/_/buckets/assets")`, conditionTrue},
+		{`resource.name.endsWith("-logs")`, conditionFalse},
+		{`resource.name.contains("/buckets/")`, conditionTrue},
+		{`resource.name.matches("^projects/_/buckets/as+ets$")`, conditionTrue},
+		{`resource.type == "storage.googleapis.com/Bucket" && resource.service != "iam.googleapis.com"`, conditionTrue},
+		{`!(resource.type == "storage.googleapis.com/Object")`, conditionTrue},
+		{`resource.name == "projects/_/buckets/other" || request.time < timestamp("2030-01-01T00:00:00Z")`, conditionTrue},
+		// Unknown attributes don't matter when the other operand decides the result.
+		{`request.auth.claims.team == "web" && request.time < timestamp("2025-01-01T00:00:00Z")`, conditionFalse},
+		{`request.auth.claims.team == "web" || resource.type == "storage.googleapis.com/Bucket"`, conditionTrue},
+		{`request.auth.claims.team == "web" && request.time < timestamp("2030-01-01T00:00:00Z")`, conditionUnknown},
+		{`resource.matchTag("123/env", "prod")`, conditionUnknown},
+		{`request.time.getHours("Europe/Berlin") == 13`, conditionTrue},
+		{`request.time.getDayOfWeek() == 0`, conditionTrue},
+		{`request.time > timestamp("2026-03-01T00:00:00Z") + duration("6h") && request.time < timestamp("2026-03-01T13:00:00Z") - duration("30m")`, conditionTrue},
+		{`resource.type in ["storage.googleapis.com/Bucket", "storage.googleapis.com/Object"]`, conditionTrue},
+		{`size(["a", "b"]) > -1`, conditionTrue},
+		// ! binds tighter than ==.
+		{`!false == true`, conditionTrue},
+		{`request.auth.claims.team in ["web", "api"] || resource.service == "iam.googleapis.com"`, conditionUnknown},
+		{`request.host == "example.com"`, conditionUnknown},
+		{`request.time < timestamp("not a time")`, conditionUnknown},
+		{`request.time <`, conditionUnknown},
+		{`resource.name`, conditionUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			assert.Equal(t, tt.want, evaluateCondition(tt.expression, env))
+		})
+	}
+
+	t.Run("Unknown resource", func(t *testing.T) {
+		assert.Equal(t, conditionUnknown, evaluateCondition(`resource.name.startsWith("projects/_/buckets/assets")`, conditionEnv{now: env.now}))
+	})
+}
+
+func TestPerformKsaCheckConditions(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	pool := "test-project.svc.id.goog"
+	member := "serviceAccount:" + pool + "[default/test-ksa]"
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool},
+	}
+	annotatedKsa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test-ksa",
+		Namespace:   "default",
+		Annotations: map[string]string{gsaAnnotation: "app@test-project.iam.gserviceaccount.com"},
+	}}
+	plainKsa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "test-ksa", Namespace: "default"}}
+	expired := &expr.Expr{Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`}
+	future := &expr.Expr{Expression: `request.time < timestamp("2999-01-01T00:00:00Z")`}
+	unknown := &expr.Expr{Expression: `resource.matchTag("123/env", "prod")`}
+	thisGSA := &expr.Expr{Expression: `resource.name == "projects/-/serviceAccounts/100"`}
+	otherGSA := &expr.Expr{Expression: `resource.name.startsWith("projects/-/serviceAccounts/999")`}
+
+	wiuPolicy := func(bindings ...*iampb.Binding) *iampb.Policy {
+		for _, b := range bindings {
+			b.Role = workloadIdentityUserRole
+		}
+		return &iampb.Policy{Version: 3, Bindings: bindings}
+	}
+
+	tests := []struct {
+		name       string
+		policy     *iampb.Policy
+		wantStatus checkStatus
+		wantErr    bool
+	}{
+		{"Expired binding", wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: expired}), statusFail, true},
+		{"Binding not yet expired", wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: future}), statusPass, false},
+		{"Condition can't be evaluated", wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: unknown}), statusWarn, false},
+		{"Resource name matches the GSA", wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: thisGSA}), statusPass, false},
+		{"Resource name names another GSA", wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: otherGSA}), statusFail, true},
+		{"Expired binding next to an unconditional one", wiuPolicy(
+			&iampb.Binding{Members: []string{member}, Condition: expired},
+			&iampb.Binding{Members: []string{"serviceAccount:" + pool + "[other/ksa]", member}},
+		), statusPass, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, cleanup := newMockGcpClients(ctx, t, tt.policy, nil, nil, nil)
+			defer cleanup()
+
+			report, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(annotatedKsa))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			check := findCheck(t, report, checkIamWorkloadIdentityUser)
+			assert.Equal(t, tt.wantStatus, check.Status)
+		})
+	}
+
+	t.Run("Expired binding reports its condition", func(t *testing.T) {
+		clients, cleanup := newMockGcpClients(ctx, t, wiuPolicy(&iampb.Binding{Members: []string{member}, Condition: expired}), nil, nil, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(annotatedKsa))
+		assert.ErrorContains(t, err, "its condition is false")
+		assert.Equal(t, expired.Expression, findCheck(t, report, checkIamWorkloadIdentityUser).Evidence["condition"])
+		assert.Equal(t, []grantedBinding{{Role: workloadIdentityUserRole, Member: member, Resource: gsaPolicyResource("app@test-project.iam.gserviceaccount.com"), Condition: expired.Expression, ConditionHolds: conditionFalse}}, report.Bindings)
+	})
+
+	t.Run("Conditional direct binding", func(t *testing.T) {
+		principal := "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool + "/subject/ns/default/sa/test-ksa"
+		clients, cleanup := newMockGcpClients(ctx, t, nil, nil, &iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{principal}, Condition: expired},
+		}}, nil)
+		defer cleanup()
+
+		report, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(plainKsa))
+		assert.NoError(t, err)
+		direct := findCheck(t, report, checkIamDirectBinding)
+		assert.Equal(t, statusWarn, direct.Status)
+		assert.Contains(t, direct.Message, "[condition is false]")
+	})
+}
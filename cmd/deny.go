@@ -0,0 +1,269 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	iamv2pb "cloud.google.com/go/iam/apiv2/iampb"
+)
+
+const (
+	docDenyPolicies = "https://cloud.google.com/iam/docs/deny-overview"
+	// getAccessTokenPermission is what the KSA needs on the GSA to impersonate it.
+	getAccessTokenPermission = "iam.serviceAccounts.getAccessToken"
+	publicPrincipalSet       = "principalSet://goog/public:all"
+)
+
+// denyServiceNames maps the service prefix of a permission to the service name deny policies use,
+// where it isn't simply SERVICE.googleapis.com.
+var denyServiceNames = map[string]string{
+	"resourcemanager": "cloudresourcemanager.googleapis.com",
+}
+
+// deniedRule is a deny rule that applies to the workload's identity.
+type deniedRule struct {
+	// Resource is the project, folder or organization the deny policy is attached to.
+	Resource  string `json:"resource"`
+	Policy    string `json:"policy"`
+	Principal string `json:"principal"`
+	// Permissions are in the SERVICE_FQDN/RESOURCE.ACTION form deny policies use.
+	Permissions          []string `json:"deniedPermissions"`
+	ExceptionPermissions []string `json:"exceptionPermissions,omitempty"`
+	// Condition is the CEL expression the denial is subject to, usually on resource tags.
+	Condition string `json:"condition,omitempty"`
+	// UnevaluatedExceptions are exception principals, such as groups, whose membership can't be
+	// checked. The identity may be exempt through one of them.
+	UnevaluatedExceptions []string `json:"unevaluatedExceptions,omitempty"`
+}
+
+func (r deniedRule) String() string {
+	s := fmt.Sprintf("%s on %s denies %s to %s", path.Base(r.Policy), r.Resource, strings.Join(r.Permissions, ", "), r.Principal)
+	if len(r.ExceptionPermissions) > 0 {
+		s += fmt.Sprintf(" (except %s)", strings.Join(r.ExceptionPermissions, ", "))
+	}
+	if r.Condition != "" {
+		s += fmt.Sprintf(" if %s", r.Condition)
+	}
+	return s
+}
+
+// denies reports whether the rule blocks permission, given in its v1 form (storage.objects.get).
+func (r deniedRule) denies(permission string) bool {
+	p := denyPermission(permission)
+	matches := func(pattern string) bool { return denyPermissionMatches(pattern, p) }
+	return slices.ContainsFunc(r.Permissions, matches) && !slices.ContainsFunc(r.ExceptionPermissions, matches)
+}
+
+// denyPermission converts a permission from its v1 form, SERVICE.RESOURCE.ACTION, to the
+// SERVICE_FQDN/RESOURCE.ACTION form deny policies use.
+func denyPermission(permission string) string {
+	service, rest, ok := strings.Cut(permission, ".")
+	if !ok {
+		return permission
+	}
+	if fqdn, ok := denyServiceNames[service]; ok {
+		return fqdn + "/" + rest
+	}
+	return service + ".googleapis.com/" + rest
+}
+
+// denyPermissionMatches matches a deny policy permission, which may use * for the resource or the
+// action (storage.googleapis.com/objects.*), against a permission in the same form.
+func denyPermissionMatches(pattern, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	patternService, patternRest, ok := strings.Cut(pattern, "/")
+	if !ok {
+		return false
+	}
+	service, rest, ok := strings.Cut(permission, "/")
+	if !ok || patternService != service {
+		return false
+	}
+	if patternRest == "*" {
+		return true
+	}
+	cut := func(s string) (string, string) {
+		i := strings.LastIndex(s, ".")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i+1:]
+	}
+	patternResource, patternAction := cut(patternRest)
+	resource, action := cut(rest)
+	return (patternResource == "*" || patternResource == resource) && (patternAction == "*" || patternAction == action)
+}
+
+// gsaDenyPrincipal returns the identifier deny policies use for a service account.
+func gsaDenyPrincipal(gsa string) string {
+	return "principal://iam.googleapis.com/projects/-/serviceAccounts/" + gsa
+}
+
+// denyPrincipalApplies reports whether a principal in a deny rule covers the KSA or, when gsa is
+// set, the GSA. evaluable is false for groups and other principal sets whose membership can't be
+// checked.
+func denyPrincipalApplies(member string, id ksaIdentity, gsa string) (applies, evaluable bool) {
+	switch {
+	case strings.HasPrefix(member, deletedPrefix):
+		return false, true
+	case member == publicPrincipalSet:
+		return true, true
+	case gsa != "" && strings.EqualFold(member, gsaDenyPrincipal(gsa)):
+		return true, true
+	}
+	if p, ok := parsePrincipal(member); ok {
+		return p.appliesTo(id), true
+	}
+	return false, !strings.HasPrefix(member, "principalSet://")
+}
+
+// denyRulesFor returns the rules of the deny policies attached to resource that apply to the KSA
+// or the GSA. Rules whose exception principals cover the identity are left out.
+func denyRulesFor(policies []*iamv2pb.Policy, resource string, id ksaIdentity, gsa string) []deniedRule {
+	var found []deniedRule
+	for _, policy := range policies {
+		for _, r := range policy.GetRules() {
+			deny := r.GetDenyRule()
+			if deny == nil {
+				continue
+			}
+			principal := ""
+			for _, m := range deny.GetDeniedPrincipals() {
+				if applies, _ := denyPrincipalApplies(m, id, gsa); applies {
+					principal = m
+					break
+				}
+			}
+			if principal == "" {
+				continue
+			}
+
+			exempt := false
+			var unevaluated []string
+			for _, m := range deny.GetExceptionPrincipals() {
+				applies, evaluable := denyPrincipalApplies(m, id, gsa)
+				exempt = exempt || applies
+				if !evaluable {
+					unevaluated = append(unevaluated, m)
+				}
+			}
+			if exempt {
+				continue
+			}
+			found = append(found, deniedRule{
+				Resource:              resource,
+				Policy:                policy.GetName(),
+				Principal:             principal,
+				Permissions:           deny.GetDeniedPermissions(),
+				ExceptionPermissions:  deny.GetExceptionPermissions(),
+				Condition:             deny.GetDenialCondition().GetExpression(),
+				UnevaluatedExceptions: unevaluated,
+			})
+		}
+	}
+	return found
+}
+
+// gatherDenyRules lists the deny policies attached to each resource and returns the rules that
+// apply to the identity, along with the resources whose deny policies couldn't be read.
+func gatherDenyRules(ctx context.Context, clients *gcpClients, resources []string, id ksaIdentity, gsa string) ([]deniedRule, []string) {
+	var rules []deniedRule
+	var unreadable []string
+	for _, resource := range resources {
+		policies, err := clients.denyPoliciesAt(ctx, resource)
+		if err != nil {
+			unreadable = append(unreadable, resource)
+			continue
+		}
+		rules = append(rules, denyRulesFor(policies, resource, id, gsa)...)
+	}
+	return rules, unreadable
+}
+
+// denyRemediation explains how to exempt the identity from a deny rule.
+func denyRemediation(r deniedRule, member string) string {
+	attachmentPoint := "cloudresourcemanager.googleapis.com/" + r.Resource
+	return fmt.Sprintf("Remove '%s' from the denied principals of the rule, or add '%s' to its exception principals:\n"+
+		"gcloud iam policies get %s --attachment-point=%s --kind=denypolicies --format=json > policy.json\n"+
+		"gcloud iam policies update %s --attachment-point=%s --kind=denypolicies --policy-file=policy.json",
+		r.Principal, member, path.Base(r.Policy), attachmentPoint, path.Base(r.Policy), attachmentPoint)
+}
+
+// checkDenyPolicies looks for deny policies attached to the workload's resources, the cluster
+// project's ancestry and the GSA project's ancestry, that deny permissions to the KSA or its GSA.
+// An allow binding grants nothing for a permission that is denied.
+func checkDenyPolicies(ctx context.Context, clients *gcpClients, report *ksaReport, resources []string, ancestryErr error) checkResult {
+	result := checkResult{
+		ID:       checkIamDenyPolicy,
+		Title:    "Checking IAM deny policies on the project and its folders and organization",
+		Severity: severityHigh,
+		DocLink:  docDenyPolicies,
+	}
+
+	rules, unreadable := gatherDenyRules(ctx, clients, resources, report.identity(), report.GSA)
+	report.Denials = rules
+
+	result.Evidence = map[string]string{"resources": strings.Join(resources, ", ")}
+	if ancestryErr != nil {
+		result.Evidence["ancestryError"] = ancestryErr.Error()
+	}
+	if len(unreadable) > 0 {
+		result.Evidence["unreadableDenyPolicies"] = strings.Join(unreadable, ", ")
+	}
+
+	if len(rules) == 0 {
+		if len(unreadable) == len(resources) {
+			result.Status = statusSkip
+			result.Severity = severityInfo
+			result.Message = "Deny policies could not be read. Listing them requires the iam.denypolicies.list and iam.denypolicies.get permissions."
+			return result
+		}
+		result.Status = statusPass
+		result.Message = "No deny policy denies permissions to the KSA or its GSA."
+		if len(unreadable) > 0 {
+			result.Message += " Some deny policies could not be read."
+		}
+		return result
+	}
+
+	var lines []string
+	for _, r := range rules {
+		lines = append(lines, r.String())
+	}
+	result.Status = statusWarn
+	result.Message = fmt.Sprintf("Deny policies block permissions for the workload even where roles grant them:\n      - %s", strings.Join(lines, "\n      - "))
+
+	// Impersonating the GSA requires the KSA to be granted getAccessToken on it; denying that
+	// breaks Workload Identity for the workload altogether.
+	if report.GSA != "" {
+		for _, r := range rules {
+			if r.Condition == "" && len(r.UnevaluatedExceptions) == 0 && r.denies(getAccessTokenPermission) && !strings.EqualFold(r.Principal, gsaDenyPrincipal(report.GSA)) {
+				result.Status = statusFail
+				result.Message = fmt.Sprintf("A deny policy stops the KSA from impersonating GSA '%s': %s", report.GSA, r)
+				result.Remediation = denyRemediation(r, report.principal())
+				break
+			}
+		}
+	}
+	return result
+}
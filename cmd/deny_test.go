@@ -0,0 +1,260 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	iamv2pb "cloud.google.com/go/iam/apiv2/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeDenyPolicies serves deny policies from memory, keyed by attachment point
+// (cloudresourcemanager.googleapis.com/projects/P).
+type fakeDenyPolicies struct {
+	policies map[string][]*iamv2pb.Policy
+	denied   map[string]bool
+	calls    int
+}
+
+func (f *fakeDenyPolicies) ListDenyPolicies(ctx context.Context, attachmentPoint string) ([]*iamv2pb.Policy, error) {
+	f.calls++
+	if f.denied[attachmentPoint] {
+		return nil, status.Errorf(codes.PermissionDenied, "permission denied on %s", attachmentPoint)
+	}
+	return f.policies[attachmentPoint], nil
+}
+
+func denyPolicy(name string, rules ...*iamv2pb.DenyRule) *iamv2pb.Policy {
+	policy := &iamv2pb.Policy{Name: name}
+	for _, r := range rules {
+		policy.Rules = append(policy.Rules, &iamv2pb.PolicyRule{Kind: &iamv2pb.PolicyRule_DenyRule{DenyRule: r}})
+	}
+	return policy
+}
+
+func TestDenyPermissionMatches(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		permission string
+		want       bool
+	}{
+		{"storage.googleapis.com/objects.get", "storage.objects.get", true},
+		{"storage.googleapis.com/objects.*", "storage.objects.get", true},
+		{"storage.googleapis.com/*.get", "storage.objects.get", true},
+		{"storage.googleapis.com/*", "storage.objects.get", true},
+		{"storage.googleapis.com/objects.delete", "storage.objects.get", false},
+		{"storage.googleapis.com/buckets.*", "storage.objects.get", false},
+		{"iam.googleapis.com/serviceAccounts.getAccessToken", getAccessTokenPermission, true},
+		{"cloudresourcemanager.googleapis.com/projects.get", "resourcemanager.projects.get", true},
+		{"bigquery.googleapis.com/*", "storage.objects.get", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.permission, func(t *testing.T) {
+			assert.Equal(t, tt.want, denyPermissionMatches(tt.pattern, denyPermission(tt.permission)))
+		})
+	}
+}
+
+func TestDenyRulesFor(t *testing.T) {
+	const pool = "test-project.svc.id.goog"
+	const base = "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	id := ksaIdentity{WorkloadPool: pool, PoolProjectNumber: "123", Namespace: "app", Name: "web"}
+	getObjects := []string{"storage.googleapis.com/objects.get"}
+
+	policies := []*iamv2pb.Policy{
+		denyPolicy("policies/p/denypolicies/namespace",
+			&iamv2pb.DenyRule{DeniedPrincipals: []string{"principalSet://" + base + "/namespace/app"}, DeniedPermissions: getObjects},
+			&iamv2pb.DenyRule{DeniedPrincipals: []string{"principalSet://" + base + "/namespace/other"}, DeniedPermissions: getObjects},
+		),
+		denyPolicy("policies/p/denypolicies/exempt",
+			&iamv2pb.DenyRule{
+				DeniedPrincipals:    []string{publicPrincipalSet},
+				ExceptionPrincipals: []string{"principal://" + base + "/subject/ns/app/sa/web"},
+				DeniedPermissions:   getObjects,
+			},
+		),
+		denyPolicy("policies/p/denypolicies/gsa",
+			&iamv2pb.DenyRule{
+				DeniedPrincipals:     []string{gsaDenyPrincipal(gsa)},
+				ExceptionPrincipals:  []string{"principalSet://goog/group/admins@example.com"},
+				DeniedPermissions:    []string{"storage.googleapis.com/objects.*"},
+				ExceptionPermissions: []string{"storage.googleapis.com/objects.list"},
+				DenialCondition:      &expr.Expr{Expression: "resource.matchTag('test-project/env', 'prod')"},
+			},
+		),
+	}
+
+	rules := denyRulesFor(policies, "projects/test-project", id, gsa)
+	assert.Equal(t, []deniedRule{
+		{Resource: "projects/test-project", Policy: "policies/p/denypolicies/namespace", Principal: "principalSet://" + base + "/namespace/app", Permissions: getObjects},
+		{
+			Resource:              "projects/test-project",
+			Policy:                "policies/p/denypolicies/gsa",
+			Principal:             gsaDenyPrincipal(gsa),
+			Permissions:           []string{"storage.googleapis.com/objects.*"},
+			ExceptionPermissions:  []string{"storage.googleapis.com/objects.list"},
+			Condition:             "resource.matchTag('test-project/env', 'prod')",
+			UnevaluatedExceptions: []string{"principalSet://goog/group/admins@example.com"},
+		},
+	}, rules)
+	assert.True(t, rules[1].denies("storage.objects.get"))
+	assert.False(t, rules[1].denies("storage.objects.list"))
+
+	// Only the rule that denies everyone applies to an unrelated identity.
+	rules = denyRulesFor(policies, "projects/test-project", ksaIdentity{WorkloadPool: pool, Namespace: "other-app", Name: "web"}, "")
+	assert.Len(t, rules, 1)
+	assert.Equal(t, publicPrincipalSet, rules[0].Principal)
+}
+
+func TestCheckDenyPolicies(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	pool := "test-project.svc.id.goog"
+	base := "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool},
+	}
+	h := &fakeHierarchy{
+		numbers: map[string]string{"test-project": "123"},
+		parents: map[string]string{"projects/test-project": "organizations/9"},
+	}
+	newReport := func(gsa string) *ksaReport {
+		report := newKsaReport("test-cluster", "us-central1", "app", "web")
+		report.Cluster.WorkloadPool = pool
+		report.Cluster.WorkloadPoolProjectNumber = "123"
+		report.GSA = gsa
+		return report
+	}
+
+	checkDeny := func(clients *gcpClients, report *ksaReport) checkResult {
+		resources, err := workloadAncestry(ctx, clients, report)
+		return checkDenyPolicies(ctx, clients, report, resources, err)
+	}
+
+	t.Run("Impersonation denied at the organization", func(t *testing.T) {
+		deny := &fakeDenyPolicies{policies: map[string][]*iamv2pb.Policy{
+			"cloudresourcemanager.googleapis.com/organizations/9": {denyPolicy("policies/o/denypolicies/no-impersonation", &iamv2pb.DenyRule{
+				DeniedPrincipals:  []string{"principalSet://" + base + "/*"},
+				DeniedPermissions: []string{"iam.googleapis.com/serviceAccounts.getAccessToken"},
+			})},
+		}}
+		clients := newHierarchyClients(h)
+		clients.denyPolicies = deny
+
+		report := newReport(gsa)
+		result := checkDeny(clients, report)
+		assert.Equal(t, statusFail, result.Status)
+		assert.Len(t, report.Denials, 1)
+		assert.Equal(t, "projects/test-project, organizations/9", result.Evidence["resources"])
+		assert.Contains(t, result.Remediation, "gcloud iam policies get no-impersonation --attachment-point=cloudresourcemanager.googleapis.com/organizations/9 --kind=denypolicies")
+		assert.Contains(t, result.Remediation, "principal://"+base+"/subject/ns/app/sa/web")
+
+		// The same rule doesn't matter for a KSA that calls Google Cloud as itself.
+		result = checkDeny(clients, newReport(""))
+		assert.Equal(t, statusWarn, result.Status)
+	})
+
+	t.Run("No deny policies", func(t *testing.T) {
+		clients := newHierarchyClients(h)
+		result := checkDeny(clients, newReport(gsa))
+		assert.Equal(t, statusPass, result.Status)
+	})
+
+	t.Run("Deny policies unreadable", func(t *testing.T) {
+		clients := newHierarchyClients(h)
+		clients.denyPolicies = &fakeDenyPolicies{denied: map[string]bool{
+			"cloudresourcemanager.googleapis.com/projects/test-project": true,
+			"cloudresourcemanager.googleapis.com/organizations/9":       true,
+		}}
+		result := checkDeny(clients, newReport(gsa))
+		assert.Equal(t, statusSkip, result.Status)
+		assert.Equal(t, "projects/test-project, organizations/9", result.Evidence["unreadableDenyPolicies"])
+	})
+
+	t.Run("Policies are cached", func(t *testing.T) {
+		deny := &fakeDenyPolicies{}
+		clients := newHierarchyClients(h)
+		clients.denyPolicies = deny
+		checkDeny(clients, newReport(gsa))
+		checkDeny(clients, newReport(gsa))
+		assert.Equal(t, 2, deny.calls)
+	})
+
+	t.Run("Run after the IAM checks", func(t *testing.T) {
+		clients := newHierarchyClients(h)
+		clients.iam = &fakeIamAdmin{policy: &iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: workloadIdentityUserRole, Members: []string{"serviceAccount:" + pool + "[app/web]"}},
+		}}}
+		ksa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "app", Annotations: map[string]string{gsaAnnotation: gsa}}}
+
+		report, err := performKsaCheck(ctx, clients, "app", "web", cluster, newMockClientset(ksa))
+		assert.NoError(t, err)
+		last := report.Checks[len(report.Checks)-1]
+		assert.Equal(t, checkIamDenyPolicy, last.ID)
+		assert.Equal(t, statusPass, last.Status)
+	})
+}
+
+func TestCheckAccessDenied(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	h := &fakeHierarchy{numbers: map[string]string{"123": "123"}}
+	clients := &gcpClients{
+		projects:      h,
+		folders:       h,
+		organizations: h,
+		buckets: &fakeBuckets{
+			policies: map[string]*iampb.Policy{"assets": {Bindings: []*iampb.Binding{
+				{Role: "roles/storage.objectViewer", Members: []string{"serviceAccount:" + gsa}},
+			}}},
+			projects: map[string]string{"assets": "123"},
+		},
+		iam: &fakeIamAdmin{roles: map[string][]string{"roles/storage.objectViewer": {"storage.objects.get"}}},
+		denyPolicies: &fakeDenyPolicies{policies: map[string][]*iamv2pb.Policy{
+			"cloudresourcemanager.googleapis.com/projects/123": {denyPolicy("policies/p/denypolicies/no-reads", &iamv2pb.DenyRule{
+				DeniedPrincipals:  []string{gsaDenyPrincipal(gsa)},
+				DeniedPermissions: []string{"storage.googleapis.com/objects.get"},
+			})},
+		}},
+	}
+	report := newKsaReport("test-cluster", "us-central1", "app", "web")
+	report.GSA = gsa
+
+	result := checkAccess(ctx, clients, report, "//storage.googleapis.com/projects/_/buckets/assets", "storage.objects.get")
+	assert.Equal(t, statusFail, result.Status)
+	assert.False(t, report.Access.Granted)
+	assert.Len(t, report.Access.GrantedBy, 1)
+	assert.Len(t, report.Access.DeniedBy, 1)
+	assert.Contains(t, result.Remediation, "add '"+gsaDenyPrincipal(gsa)+"' to its exception principals")
+
+	result = checkAccess(ctx, clients, report, "//storage.googleapis.com/projects/_/buckets/assets", "storage.objects.list")
+	assert.Equal(t, statusFail, result.Status)
+	assert.Empty(t, report.Access.DeniedBy)
+}
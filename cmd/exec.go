@@ -0,0 +1,92 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/utils/exec"
+)
+
+// execInPod runs command in a container and returns what it wrote to stdout. It is a variable
+// because the fake clientset can't exec.
+var execInPod = remoteExec
+
+// remoteExec runs command in a container through the exec subresource, the way kubectl exec does:
+// over a WebSocket, falling back to SPDY when the API server can't upgrade to one. Both go through
+// the transport built from config, so they carry the clientset's credentials and proxy settings.
+func remoteExec(ctx context.Context, config *rest.Config, namespace, pod, container string, command []string) (string, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Kubernetes clientset: %w", err)
+	}
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{Container: container, Command: command, Stdout: true, Stderr: true}, scheme.ParameterCodec)
+
+	websocketExec, err := remotecommand.NewWebSocketExecutor(config, http.MethodGet, req.URL().String())
+	if err != nil {
+		return "", fmt.Errorf("failed to create WebSocket executor: %w", err)
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExec, spdyExec, httpstream.IsUpgradeFailure)
+	if err != nil {
+		return "", fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	if err == nil {
+		return stdout.String(), nil
+	}
+
+	// The API server answers a rejected upgrade with a Status carrying the HTTP code.
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		s := apiStatus.Status()
+		if s.Code == http.StatusForbidden {
+			return "", fmt.Errorf("the API server refused to exec into pod '%s/%s' (HTTP 403): %s; check that you are allowed to create pods/exec in the namespace", namespace, pod, s.Message)
+		}
+		return "", fmt.Errorf("the API server refused to exec into pod '%s/%s' (HTTP %d): %s", namespace, pod, s.Code, s.Message)
+	}
+	msg := err.Error()
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		msg += ": " + out
+	}
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), fmt.Errorf("command failed: %s", msg)
+	}
+	return stdout.String(), fmt.Errorf("failed to exec into pod '%s/%s': %s", namespace, pod, msg)
+}
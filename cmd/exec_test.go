@@ -0,0 +1,177 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream/wsstream"
+	"k8s.io/client-go/rest"
+)
+
+// fakeExec is what the fake API server's container writes when a command runs in it.
+type fakeExec struct {
+	stdout, stderr string
+	exitCode       int
+}
+
+// newFakeExecServer serves the exec subresource of pod web/frontend the way the API server does:
+// over a v5.channel.k8s.io WebSocket, ending with the command's exit status on the error channel.
+// Rejected requests get a Status with the matching HTTP code.
+func newFakeExecServer(t *testing.T, run fakeExec) *httptest.Server {
+	reject := func(w http.ResponseWriter, err *apierrors.StatusError) {
+		s := err.Status()
+		s.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(int(s.Code))
+		assert.NoError(t, json.NewEncoder(w).Encode(s))
+	}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer test-token" {
+			reject(w, apierrors.NewForbidden(schema.GroupResource{Resource: "pods/exec"}, "frontend", nil))
+			return
+		}
+		pod, ok := strings.CutPrefix(req.URL.Path, "/api/v1/namespaces/web/pods/")
+		pod, ok = strings.CutSuffix(pod, "/exec")
+		if !ok || pod != "frontend" {
+			reject(w, apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, pod))
+			return
+		}
+		if container := req.URL.Query().Get("container"); container != "app" {
+			reject(w, apierrors.NewBadRequest("container "+container+" is not valid for pod frontend"))
+			return
+		}
+		assert.Equal(t, []string{"sh", "-c", "echo hi"}, req.URL.Query()["command"])
+
+		conn := wsstream.NewConn(map[string]wsstream.ChannelProtocolConfig{
+			"v5.channel.k8s.io": {
+				Binary:   true,
+				Channels: []wsstream.ChannelType{wsstream.IgnoreChannel, wsstream.WriteChannel, wsstream.WriteChannel, wsstream.WriteChannel, wsstream.IgnoreChannel},
+			},
+		})
+		_, streams, err := conn.Open(w, req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		streams[1].Write([]byte(run.stdout))
+		streams[2].Write([]byte(run.stderr))
+		status := metav1.Status{Status: metav1.StatusSuccess}
+		if run.exitCode != 0 {
+			status = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  "NonZeroExitCode",
+				Message: "command terminated with non-zero exit code",
+				Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Type: "ExitCode", Message: fmt.Sprint(run.exitCode)}}},
+			}
+		}
+		assert.NoError(t, json.NewEncoder(streams[3]).Encode(status))
+	}))
+}
+
+func TestRemoteExec(t *testing.T) {
+	ctx := context.Background()
+	command := []string{"sh", "-c", "echo hi"}
+	config := func(srv *httptest.Server, token string) *rest.Config {
+		return &rest.Config{Host: srv.URL, BearerToken: token, TLSClientConfig: rest.TLSClientConfig{Insecure: true}}
+	}
+
+	srv := newFakeExecServer(t, fakeExec{stdout: "hello\n", stderr: "ignored"})
+	out, err := remoteExec(ctx, config(srv, "test-token"), "web", "frontend", "app", command)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", out)
+	srv.Close()
+
+	srv = newFakeExecServer(t, fakeExec{stdout: "partial", stderr: "sh: 1: curl: not found\n", exitCode: 127})
+	defer srv.Close()
+	out, err = remoteExec(ctx, config(srv, "test-token"), "web", "frontend", "app", command)
+	assert.EqualError(t, err, "command failed: command terminated with exit code 127: sh: 1: curl: not found")
+	assert.Equal(t, "partial", out)
+
+	// Only a 403 points at RBAC; other rejections show the status the API server returned.
+	_, err = remoteExec(ctx, config(srv, "wrong-token"), "web", "frontend", "app", command)
+	assert.ErrorContains(t, err, "the API server refused to exec into pod 'web/frontend' (HTTP 403)")
+	assert.ErrorContains(t, err, "check that you are allowed to create pods/exec in the namespace")
+
+	_, err = remoteExec(ctx, config(srv, "test-token"), "web", "missing", "app", command)
+	assert.EqualError(t, err, `the API server refused to exec into pod 'web/missing' (HTTP 404): pods "missing" not found`)
+
+	_, err = remoteExec(ctx, config(srv, "test-token"), "web", "frontend", "sidecar", command)
+	assert.EqualError(t, err, "the API server refused to exec into pod 'web/frontend' (HTTP 400): container sidecar is not valid for pod frontend")
+}
+
+// newFakeProxy tunnels CONNECT requests and records the target of each one along with the
+// credentials it was given.
+func newFakeProxy(t *testing.T, targets *[]string, auths *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		*targets = append(*targets, req.Host)
+		*auths = append(*auths, req.Header.Get("Proxy-Authorization"))
+		upstream, err := net.Dial("tcp", req.Host)
+		if !assert.NoError(t, err) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if !assert.NoError(t, err) {
+			upstream.Close()
+			return
+		}
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		assert.NoError(t, err)
+		go func() {
+			io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+}
+
+func TestRemoteExecThroughProxy(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeExecServer(t, fakeExec{stdout: "hi\n"})
+	defer srv.Close()
+	var targets, auths []string
+	proxy := newFakeProxy(t, &targets, &auths)
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NoError(t, err)
+	proxyURL.User = url.UserPassword("user", "secret")
+
+	config := &rest.Config{Host: srv.URL, BearerToken: "test-token", TLSClientConfig: rest.TLSClientConfig{Insecure: true}, Proxy: http.ProxyURL(proxyURL)}
+	out, err := remoteExec(ctx, config, "web", "frontend", "app", []string{"sh", "-c", "echo hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\n", out)
+	assert.Equal(t, []string{srv.Listener.Addr().String()}, targets)
+	assert.Equal(t, []string{"Basic dXNlcjpzZWNyZXQ="}, auths)
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	iampolicy "cloud.google.com/go/iam"
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxPolicyUpdateAttempts bounds the read-modify-write loop when SetIamPolicy reports an etag conflict.
+const maxPolicyUpdateAttempts = 5
+
+var (
+	fixGSA          string
+	fixDryRun       bool
+	fixNamespace    string
+	fixWorkloadType string
+)
+
+// fixCmd represents the fix command
+var fixCmd = &cobra.Command{
+	Use:   "fix",
+	Short: "Applies the missing Workload Identity configuration for various resources.",
+	Long: `Applies the fixes suggested by the check commands: it annotates the Kubernetes Service Account
+with the Google Service Account and grants the KSA's principal roles/iam.workloadIdentityUser on that GSA.
+
+Use --dry-run to print the exact changes without applying them.`,
+	// This is a parent command, so it doesn't have a Run function.
+}
+
+// fixKsaCmd represents the fix ksa command
+var fixKsaCmd = &cobra.Command{
+	Use:   "ksa <ksa-name>",
+	Short: "Fixes the Workload Identity configuration for a specific Kubernetes Service Account (KSA).",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runFix(fixNamespace, func(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+			return args[0], nil
+		})
+	},
+}
+
+// fixWorkloadCmd represents the fix workload command
+var fixWorkloadCmd = &cobra.Command{
+	Use:   "workload <workload-name>",
+	Short: "Fixes the Workload Identity configuration for the KSA used by a Kubernetes workload.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runFix(fixNamespace, func(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+			return getKsaFromWorkload(ctx, clientset, fixNamespace, args[0], fixWorkloadType)
+		})
+	},
+}
+
+// fixPlan describes the changes needed to wire a KSA to a GSA.
+type fixPlan struct {
+	Namespace string
+	KSA       string
+	GSA       string
+	Member    string
+
+	// CurrentAnnotation is the KSA's existing GSA annotation, if any.
+	CurrentAnnotation string
+	PatchAnnotation   bool
+	AddBinding        bool
+}
+
+// runFix resolves the target KSA, plans the fix and applies it unless --dry-run is set.
+func runFix(namespace string, resolveKsa func(ctx context.Context, clientset kubernetes.Interface) (string, error)) {
+	ctx := context.Background()
+
+	if inspectionToken != "" {
+		log.Fatalf("❌ The fix commands cannot run with an inspection token; it only grants read access.")
+	}
+
+	clients, err := newGCPClients(ctx)
+	if err != nil {
+		log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+	}
+	defer clients.Close()
+
+	cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+	if err != nil {
+		log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+	}
+	if cluster.WorkloadIdentityConfig == nil || cluster.WorkloadIdentityConfig.WorkloadPool == "" {
+		log.Fatalf("❌ Workload Identity is not enabled on cluster '%s'; enable it before fixing individual KSAs.", cluster.Name)
+	}
+
+	clientset, err := getK8sClientset(cluster)
+	if err != nil {
+		log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+	}
+
+	ksaName, err := resolveKsa(ctx, clientset)
+	if err != nil {
+		log.Fatalf("❌ Failed to resolve KSA: %v", err)
+	}
+
+	plan, err := planFix(ctx, clients, clientset, cluster.WorkloadIdentityConfig.WorkloadPool, namespace, ksaName, fixGSA)
+	if err != nil {
+		log.Fatalf("❌ Failed to plan fix: %v", err)
+	}
+
+	plan.renderDiff(os.Stdout)
+	if !plan.PatchAnnotation && !plan.AddBinding {
+		fmt.Println("🎉 Nothing to do. The KSA is already annotated and bound to the GSA.")
+		return
+	}
+	if fixDryRun {
+		fmt.Println("ℹ️  Dry run: no changes were made.")
+		return
+	}
+
+	if err := applyFix(ctx, clients, clientset, plan); err != nil {
+		log.Fatalf("❌ Failed to apply fix: %v", err)
+	}
+	fmt.Println("🎉 Fix applied. Run 'check ksa' again to verify the configuration.")
+}
+
+// planFix works out which of the annotation and the IAM binding are missing. gsa may be empty,
+// in which case the GSA from the KSA's existing annotation is used.
+func planFix(ctx context.Context, clients *gcpClients, clientset kubernetes.Interface, workloadPool, namespace, ksaName, gsa string) (*fixPlan, error) {
+	ksa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, ksaName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", ksaName, namespace, err)
+	}
+
+	plan := &fixPlan{
+		Namespace:         namespace,
+		KSA:               ksaName,
+		CurrentAnnotation: ksa.Annotations[gsaAnnotation],
+		Member:            ksaServiceAccountMember(workloadPool, namespace, ksaName),
+	}
+
+	plan.GSA = gsa
+	if plan.GSA == "" {
+		plan.GSA = plan.CurrentAnnotation
+	}
+	if plan.GSA == "" {
+		return nil, fmt.Errorf("KSA '%s/%s' has no '%s' annotation; pass --gsa to choose the Google Service Account", namespace, ksaName, gsaAnnotation)
+	}
+	plan.PatchAnnotation = plan.CurrentAnnotation != plan.GSA
+
+	policy, err := clients.iam.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: gsaPolicyResource(plan.GSA),
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IAM policy for GSA '%s': %w", plan.GSA, err)
+	}
+	plan.AddBinding = !hasUnconditionalMember(policy.InternalProto, workloadIdentityUserRole, plan.Member)
+
+	return plan, nil
+}
+
+// hasUnconditionalMember reports whether member holds role without a condition attached.
+func hasUnconditionalMember(policy *iampb.Policy, role, member string) bool {
+	for _, b := range policy.GetBindings() {
+		if b.Role != role || b.Condition != nil {
+			continue
+		}
+		for _, m := range b.Members {
+			if m == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addUnconditionalMember grants role to member, reusing an existing unconditional binding for the
+// role if there is one. Conditional bindings are left untouched so the grant isn't narrowed by accident.
+func addUnconditionalMember(policy *iampb.Policy, role, member string) {
+	if hasUnconditionalMember(policy, role, member) {
+		return
+	}
+	for _, b := range policy.Bindings {
+		if b.Role == role && b.Condition == nil {
+			b.Members = append(b.Members, member)
+			return
+		}
+	}
+	policy.Bindings = append(policy.Bindings, &iampb.Binding{Role: role, Members: []string{member}})
+}
+
+// applyFix patches the KSA annotation and adds the IAM binding as described by the plan.
+func applyFix(ctx context.Context, clients *gcpClients, clientset kubernetes.Interface, plan *fixPlan) error {
+	if plan.PatchAnnotation {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{gsaAnnotation: plan.GSA},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to build annotation patch: %w", err)
+		}
+		_, err = clientset.CoreV1().ServiceAccounts(plan.Namespace).Patch(ctx, plan.KSA, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to annotate KSA '%s/%s': %w", plan.Namespace, plan.KSA, err)
+		}
+		fmt.Printf("   ✅ Annotated KSA '%s/%s' with '%s'.\n", plan.Namespace, plan.KSA, plan.GSA)
+	}
+
+	if plan.AddBinding {
+		if err := addWorkloadIdentityBinding(ctx, clients.iam, plan.GSA, plan.Member); err != nil {
+			return err
+		}
+		fmt.Printf("   ✅ Granted %s to '%s' on GSA '%s'.\n", workloadIdentityUserRole, plan.Member, plan.GSA)
+	}
+	return nil
+}
+
+// addWorkloadIdentityBinding adds member to the GSA's roles/iam.workloadIdentityUser binding with a
+// read-modify-write cycle. The policy etag guards against concurrent edits; when SetIamPolicy
+// reports a conflict the policy is re-read and the change retried.
+func addWorkloadIdentityBinding(ctx context.Context, client iamAdminClient, gsaEmail, member string) error {
+	resource := gsaPolicyResource(gsaEmail)
+	for attempt := 1; attempt <= maxPolicyUpdateAttempts; attempt++ {
+		policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: resource,
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get IAM policy for GSA '%s': %w", gsaEmail, err)
+		}
+		if policy.InternalProto == nil {
+			policy.InternalProto = &iampb.Policy{}
+		}
+		if hasUnconditionalMember(policy.InternalProto, workloadIdentityUserRole, member) {
+			return nil
+		}
+		addUnconditionalMember(policy.InternalProto, workloadIdentityUserRole, member)
+		policy.InternalProto.Version = 3
+
+		_, err = client.SetIamPolicy(ctx, &iam.SetIamPolicyRequest{
+			Resource: resource,
+			Policy:   &iampolicy.Policy{InternalProto: policy.InternalProto},
+		})
+		if err == nil {
+			return nil
+		}
+		if code := status.Code(err); code != codes.Aborted && code != codes.FailedPrecondition {
+			return fmt.Errorf("failed to set IAM policy for GSA '%s': %w", gsaEmail, err)
+		}
+	}
+	return fmt.Errorf("failed to set IAM policy for GSA '%s': policy kept changing after %d attempts", gsaEmail, maxPolicyUpdateAttempts)
+}
+
+// renderDiff prints the changes the plan would make.
+func (p *fixPlan) renderDiff(w io.Writer) {
+	fmt.Fprintf(w, "🔧 Workload Identity fix for KSA %s/%s\n", p.Namespace, p.KSA)
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+
+	fmt.Fprintf(w, "ServiceAccount %s/%s (metadata.annotations):\n", p.Namespace, p.KSA)
+	switch {
+	case !p.PatchAnnotation:
+		fmt.Fprintf(w, "    %s: %s\n", gsaAnnotation, p.GSA)
+	case p.CurrentAnnotation != "":
+		fmt.Fprintf(w, "  - %s: %s\n", gsaAnnotation, p.CurrentAnnotation)
+		fmt.Fprintf(w, "  + %s: %s\n", gsaAnnotation, p.GSA)
+	default:
+		fmt.Fprintf(w, "  + %s: %s\n", gsaAnnotation, p.GSA)
+	}
+
+	fmt.Fprintf(w, "\nIAM policy of %s (%s):\n", gsaPolicyResource(p.GSA), workloadIdentityUserRole)
+	if p.AddBinding {
+		fmt.Fprintf(w, "  + %s\n", p.Member)
+	} else {
+		fmt.Fprintf(w, "    %s\n", p.Member)
+	}
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+}
+
+func init() {
+	rootCmd.AddCommand(fixCmd)
+	addClusterFlags(fixCmd)
+	fixCmd.PersistentFlags().StringVar(&fixGSA, "gsa", "", "Google Service Account email to bind (defaults to the KSA's existing annotation)")
+	fixCmd.PersistentFlags().BoolVar(&fixDryRun, "dry-run", false, "Print the changes without applying them")
+	fixCmd.PersistentFlags().StringVarP(&fixNamespace, "namespace", "n", "default", "Kubernetes namespace of the service account or workload")
+
+	fixCmd.AddCommand(fixKsaCmd)
+	fixCmd.AddCommand(fixWorkloadCmd)
+	fixWorkloadCmd.Flags().StringVarP(&fixWorkloadType, "type", "t", "deployment", "Type of the workload (deployment, statefulset, daemonset, replicaset, job, cronjob, pod)")
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+
+	iampolicy "cloud.google.com/go/iam"
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeIamAdmin keeps a single GSA policy in memory and rejects writes carrying a stale etag,
+// like the IAM API does. conflicts forces that many SetIamPolicy calls to fail with Aborted.
+// Roles are looked up in roles, keyed by role name.
+type fakeIamAdmin struct {
+	policy    *iampb.Policy
+	conflicts int
+	sets      int
+	roles     map[string][]string
+	// accounts overrides the GSAs, keyed by email; any other GSA exists and is enabled.
+	accounts   map[string]*adminpb.ServiceAccount
+	accountErr error
+	keys       []*adminpb.ServiceAccountKey
+	keysErr    error
+}
+
+func (f *fakeIamAdmin) GetServiceAccount(ctx context.Context, req *adminpb.GetServiceAccountRequest, opts ...gax.CallOption) (*adminpb.ServiceAccount, error) {
+	if f.accountErr != nil {
+		return nil, f.accountErr
+	}
+	email := path.Base(req.Name)
+	if sa, ok := f.accounts[email]; ok {
+		return sa, nil
+	}
+	return &adminpb.ServiceAccount{Name: req.Name, Email: email, UniqueId: "100"}, nil
+}
+
+func (f *fakeIamAdmin) ListServiceAccountKeys(ctx context.Context, req *adminpb.ListServiceAccountKeysRequest, opts ...gax.CallOption) (*adminpb.ListServiceAccountKeysResponse, error) {
+	if f.keysErr != nil {
+		return nil, f.keysErr
+	}
+	return &adminpb.ListServiceAccountKeysResponse{Keys: f.keys}, nil
+}
+
+func (f *fakeIamAdmin) GetRole(ctx context.Context, req *adminpb.GetRoleRequest, opts ...gax.CallOption) (*adminpb.Role, error) {
+	permissions, ok := f.roles[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "role %s not found", req.Name)
+	}
+	return &adminpb.Role{Name: req.Name, IncludedPermissions: permissions}, nil
+}
+
+func (f *fakeIamAdmin) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampolicy.Policy, error) {
+	return &iampolicy.Policy{InternalProto: proto.Clone(f.policy).(*iampb.Policy)}, nil
+}
+
+func (f *fakeIamAdmin) SetIamPolicy(ctx context.Context, req *iam.SetIamPolicyRequest) (*iampolicy.Policy, error) {
+	f.sets++
+	if f.conflicts > 0 {
+		f.conflicts--
+		return nil, status.Error(codes.Aborted, "There were concurrent policy changes")
+	}
+	if !bytes.Equal(req.Policy.InternalProto.Etag, f.policy.Etag) {
+		return nil, status.Error(codes.Aborted, "etag mismatch")
+	}
+	f.policy = proto.Clone(req.Policy.InternalProto).(*iampb.Policy)
+	f.policy.Etag = append(f.policy.Etag, '+')
+	return &iampolicy.Policy{InternalProto: f.policy}, nil
+}
+
+func TestPlanAndApplyFix(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	gsa := "test-gsa@test-project.iam.gserviceaccount.com"
+	workloadPool := "test-project.svc.id.goog"
+	member := "serviceAccount:test-project.svc.id.goog[default/test-ksa]"
+
+	newClientset := func(annotations map[string]string) *fake.Clientset {
+		return fake.NewSimpleClientset(&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ksa", Namespace: "default", Annotations: annotations},
+		})
+	}
+
+	t.Run("Missing annotation and binding", func(t *testing.T) {
+		admin := &fakeIamAdmin{policy: &iampb.Policy{Etag: []byte("v1")}}
+		clients := &gcpClients{iam: admin}
+		clientset := newClientset(nil)
+
+		plan, err := planFix(ctx, clients, clientset, workloadPool, "default", "test-ksa", gsa)
+		assert.NoError(t, err)
+		assert.True(t, plan.PatchAnnotation)
+		assert.True(t, plan.AddBinding)
+		assert.Equal(t, member, plan.Member)
+
+		var buf bytes.Buffer
+		plan.renderDiff(&buf)
+		assert.Contains(t, buf.String(), "  + "+gsaAnnotation+": "+gsa)
+		assert.Contains(t, buf.String(), "  + "+member)
+
+		assert.NoError(t, applyFix(ctx, clients, clientset, plan))
+		ksa, err := clientset.CoreV1().ServiceAccounts("default").Get(ctx, "test-ksa", metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, gsa, ksa.Annotations[gsaAnnotation])
+		assert.True(t, hasUnconditionalMember(admin.policy, workloadIdentityUserRole, member))
+		assert.Equal(t, int32(3), admin.policy.Version)
+	})
+
+	t.Run("Already configured", func(t *testing.T) {
+		admin := &fakeIamAdmin{policy: &iampb.Policy{Bindings: []*iampb.Binding{{Role: workloadIdentityUserRole, Members: []string{member}}}}}
+		plan, err := planFix(ctx, &gcpClients{iam: admin}, newClientset(map[string]string{gsaAnnotation: gsa}), workloadPool, "default", "test-ksa", "")
+		assert.NoError(t, err)
+		assert.Equal(t, gsa, plan.GSA)
+		assert.False(t, plan.PatchAnnotation)
+		assert.False(t, plan.AddBinding)
+	})
+
+	t.Run("Annotation points at another GSA", func(t *testing.T) {
+		admin := &fakeIamAdmin{policy: &iampb.Policy{}}
+		plan, err := planFix(ctx, &gcpClients{iam: admin}, newClientset(map[string]string{gsaAnnotation: "old@test-project.iam.gserviceaccount.com"}), workloadPool, "default", "test-ksa", gsa)
+		assert.NoError(t, err)
+		assert.True(t, plan.PatchAnnotation)
+
+		var buf bytes.Buffer
+		plan.renderDiff(&buf)
+		assert.Contains(t, buf.String(), "  - "+gsaAnnotation+": old@test-project.iam.gserviceaccount.com")
+	})
+
+	t.Run("No GSA known", func(t *testing.T) {
+		_, err := planFix(ctx, &gcpClients{iam: &fakeIamAdmin{policy: &iampb.Policy{}}}, newClientset(nil), workloadPool, "default", "test-ksa", "")
+		assert.ErrorContains(t, err, "pass --gsa")
+	})
+
+	t.Run("Conditional binding is not reused", func(t *testing.T) {
+		conditional := &iampb.Binding{Role: workloadIdentityUserRole, Members: []string{member}, Condition: &expr.Expr{Expression: "request.time < timestamp('2020-01-01T00:00:00Z')"}}
+		admin := &fakeIamAdmin{policy: &iampb.Policy{Bindings: []*iampb.Binding{conditional}}}
+
+		assert.NoError(t, addWorkloadIdentityBinding(ctx, admin, gsa, member))
+		assert.Len(t, admin.policy.Bindings, 2)
+		assert.Equal(t, []string{member}, admin.policy.Bindings[0].Members)
+		assert.NotNil(t, admin.policy.Bindings[0].Condition)
+		assert.True(t, hasUnconditionalMember(admin.policy, workloadIdentityUserRole, member))
+	})
+
+	t.Run("Retries on etag conflict", func(t *testing.T) {
+		admin := &fakeIamAdmin{policy: &iampb.Policy{Etag: []byte("v1")}, conflicts: 2}
+		assert.NoError(t, addWorkloadIdentityBinding(ctx, admin, gsa, member))
+		assert.Equal(t, 3, admin.sets)
+		assert.True(t, hasUnconditionalMember(admin.policy, workloadIdentityUserRole, member))
+	})
+
+	t.Run("Gives up after repeated conflicts", func(t *testing.T) {
+		admin := &fakeIamAdmin{policy: &iampb.Policy{}, conflicts: maxPolicyUpdateAttempts}
+		err := addWorkloadIdentityBinding(ctx, admin, gsa, member)
+		assert.ErrorContains(t, err, "policy kept changing")
+		assert.Equal(t, maxPolicyUpdateAttempts, admin.sets)
+	})
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	crossProjectUsageConstraint = "iam.disableCrossProjectServiceAccountUsage"
+	docCrossProjectUsage        = "https://cloud.google.com/iam/docs/attach-service-accounts#enabling-cross-project"
+	docServiceAccounts          = "https://cloud.google.com/iam/docs/service-accounts-create"
+	docServiceAccountKeys       = "https://cloud.google.com/iam/docs/best-practices-for-managing-service-account-keys"
+	docDeletedServiceAccounts   = "https://cloud.google.com/iam/docs/service-accounts-delete-undelete#deleting"
+)
+
+// gsaProject returns the project that owns a GSA, as far as it can be told from the email alone.
+// User-managed accounts (name@PROJECT_ID.iam.gserviceaccount.com) and App Engine default accounts
+// (PROJECT_ID@appspot.gserviceaccount.com) encode the project ID. Other Google-managed accounts
+// don't, including service agents (service-PROJECT_NUMBER@gcp-sa-SERVICE.iam.gserviceaccount.com),
+// whose domain names the service; an empty string is returned for them.
+func gsaProject(gsaEmail string) string {
+	local, domain, ok := strings.Cut(gsaEmail, "@")
+	if !ok {
+		return ""
+	}
+	if project, ok := strings.CutSuffix(domain, ".iam.gserviceaccount.com"); ok {
+		if strings.HasPrefix(project, "gcp-sa-") {
+			return ""
+		}
+		return project
+	}
+	if domain == "appspot.gserviceaccount.com" {
+		return local
+	}
+	return ""
+}
+
+// gsaPolicyResource returns the IAM resource name of a GSA. The '-' wildcard lets the IAM API
+// infer the project from the email, so GSAs living outside the cluster's project resolve too.
+func gsaPolicyResource(gsaEmail string) string {
+	return fmt.Sprintf("projects/-/serviceAccounts/%s", gsaEmail)
+}
+
+// gsaConditionEnv returns the attributes that IAM conditions on a GSA's own policy are evaluated
+// against. IAM names the GSA by its unique ID there, so resource.name stays unknown without it.
+func gsaConditionEnv(uniqueID string) conditionEnv {
+	env := conditionEnv{now: time.Now(), resourceType: "iam.googleapis.com/ServiceAccount", resourceService: "iam.googleapis.com"}
+	if uniqueID != "" {
+		env.resourceName = "projects/-/serviceAccounts/" + uniqueID
+	}
+	return env
+}
+
+// checkCrossProjectUsage looks at the org policy that forbids using a project's service accounts
+// from other projects. It only runs when the GSA lives outside the cluster's project.
+func checkCrossProjectUsage(ctx context.Context, clients *gcpClients, gsaEmail, owner string) checkResult {
+	result := checkResult{
+		ID:       checkGsaCrossProject,
+		Title:    fmt.Sprintf("Checking the '%s' org policy on project '%s'", crossProjectUsageConstraint, owner),
+		Severity: severityHigh,
+		DocLink:  docCrossProjectUsage,
+		Evidence: map[string]string{
+			"gsaProject":     owner,
+			"clusterProject": projectID,
+		},
+	}
+
+	enforced, err := clients.orgPolicies.BooleanPolicyEnforced(ctx, "projects/"+owner, crossProjectUsageConstraint)
+	if err != nil {
+		result.Status = statusSkip
+		result.Severity = severityInfo
+		result.Message = fmt.Sprintf("GSA '%s' lives in project '%s', not in the cluster's project '%s', but the effective org policy could not be read: %v. Consider checking manually.", gsaEmail, owner, projectID, err)
+		return result
+	}
+	if !enforced {
+		result.Status = statusPass
+		result.Message = fmt.Sprintf("GSA '%s' lives in project '%s'. The '%s' constraint is not enforced there, so it can be used from project '%s'.", gsaEmail, owner, crossProjectUsageConstraint, projectID)
+		return result
+	}
+
+	result.Status = statusWarn
+	result.Message = fmt.Sprintf("GSA '%s' lives in project '%s', where the '%s' constraint is enforced. Service accounts of that project may not be usable from the cluster's project '%s'.", gsaEmail, owner, crossProjectUsageConstraint, projectID)
+	result.Remediation = fmt.Sprintf("gcloud resource-manager org-policies disable-enforce %s \\\n  --project=%s", crossProjectUsageConstraint, owner)
+	return result
+}
+
+// inspectGSA looks up the GSA, telling a missing GSA apart from a disabled one and from one the
+// caller isn't allowed to see. It returns an error when the KSA can't possibly impersonate the
+// GSA, and the GSA when it could be read.
+func inspectGSA(ctx context.Context, clients *gcpClients, gsaEmail string) (checkResult, *adminpb.ServiceAccount, error) {
+	result := checkResult{
+		ID:       checkGsaExists,
+		Title:    fmt.Sprintf("Checking that GSA '%s' exists and is enabled", gsaEmail),
+		Severity: severityHigh,
+		DocLink:  docServiceAccounts,
+	}
+
+	sa, err := clients.iam.GetServiceAccount(ctx, &adminpb.GetServiceAccountRequest{Name: gsaPolicyResource(gsaEmail)})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			project := gsaProject(gsaEmail)
+			if project == "" {
+				// Default and service agent accounts are created by Google and can't be recreated
+				// under the same email.
+				result.Remediation = fmt.Sprintf("'%s' is a Google-managed default or service agent account, so it can't be created again under the same email. "+
+					"If it was deleted in the last 30 days, restore it with 'gcloud iam service-accounts undelete ACCOUNT_UNIQUE_ID', taking the unique ID from the audit log entry of the deletion. "+
+					"A deleted service agent is also recreated when the API that owns it is disabled and re-enabled.", gsaEmail)
+			} else {
+				name, _, _ := strings.Cut(gsaEmail, "@")
+				result.Remediation = fmt.Sprintf("gcloud iam service-accounts create %s \\\n  --project=%s", name, project)
+			}
+			return result, nil, fmt.Errorf("GSA '%s' does not exist: %w", gsaEmail, err)
+		case codes.PermissionDenied:
+			result.Status = statusSkip
+			result.Severity = severityInfo
+			result.Message = fmt.Sprintf("GSA '%s' could not be inspected: reading it requires iam.serviceAccounts.get. Its existence and state were not verified.", gsaEmail)
+			return result, nil, nil
+		}
+		result.Status = statusSkip
+		result.Severity = severityInfo
+		result.Message = fmt.Sprintf("GSA '%s' could not be inspected: %v", gsaEmail, err)
+		return result, nil, nil
+	}
+
+	result.Evidence = map[string]string{"uniqueId": sa.UniqueId}
+	if sa.Disabled {
+		result.Remediation = fmt.Sprintf("gcloud iam service-accounts enable %s", gsaEmail)
+		return result, sa, fmt.Errorf("GSA '%s' is disabled, so tokens can't be issued for it", gsaEmail)
+	}
+	result.Status = statusPass
+	result.Message = fmt.Sprintf("GSA '%s' exists and is enabled (unique ID %s).", gsaEmail, sa.UniqueId)
+	return result, sa, nil
+}
+
+// checkGSAKeys warns about user-managed keys on the GSA. A workload that uses Workload Identity
+// doesn't need them, and anyone holding one can act as the GSA without going through the KSA.
+func checkGSAKeys(ctx context.Context, clients *gcpClients, gsaEmail string) checkResult {
+	result := checkResult{
+		ID:       checkGsaKeys,
+		Title:    fmt.Sprintf("Checking GSA '%s' for user-managed keys", gsaEmail),
+		Severity: severityMedium,
+		DocLink:  docServiceAccountKeys,
+	}
+
+	resp, err := clients.iam.ListServiceAccountKeys(ctx, &adminpb.ListServiceAccountKeysRequest{
+		Name:     gsaPolicyResource(gsaEmail),
+		KeyTypes: []adminpb.ListServiceAccountKeysRequest_KeyType{adminpb.ListServiceAccountKeysRequest_USER_MANAGED},
+	})
+	if err != nil {
+		result.Status = statusSkip
+		result.Severity = severityInfo
+		result.Message = fmt.Sprintf("Keys of GSA '%s' could not be listed: %v", gsaEmail, err)
+		return result
+	}
+
+	var keys, commands []string
+	for _, k := range resp.GetKeys() {
+		if k.Disabled {
+			continue
+		}
+		id := path.Base(k.Name)
+		key := id
+		if expiry := k.GetValidBeforeTime(); expiry != nil && expiry.GetSeconds() > 0 {
+			key += fmt.Sprintf(" (valid until %s)", expiry.AsTime().Format("2006-01-02"))
+		}
+		keys = append(keys, key)
+		commands = append(commands, fmt.Sprintf("gcloud iam service-accounts keys delete %s --iam-account=%s", id, gsaEmail))
+	}
+	if len(keys) == 0 {
+		result.Status = statusPass
+		result.Message = "No user-managed keys. The GSA can only be used through impersonation."
+		return result
+	}
+
+	result.Status = statusWarn
+	result.Evidence = map[string]string{"keys": strings.Join(keys, ", ")}
+	result.Message = fmt.Sprintf("GSA '%s' has %d active user-managed key(s): %s. Workloads using Workload Identity don't need keys, and a leaked key bypasses it.", gsaEmail, len(keys), strings.Join(keys, ", "))
+	result.Remediation = "If no other system depends on them, delete the keys:\n" + strings.Join(commands, "\n")
+	return result
+}
+
+// checkDeletedGSAMembers looks for roles granted to a deleted GSA with the same email as the
+// annotated one. IAM keeps such grants as deleted:serviceAccount:EMAIL?uid=UNIQUE_ID members, and
+// they don't carry over to a GSA recreated under the same email, which gets a new unique ID.
+func checkDeletedGSAMembers(ctx context.Context, clients *gcpClients, report *ksaReport, resources []string) checkResult {
+	result := checkResult{
+		ID:       checkGsaDeletedMembers,
+		Title:    fmt.Sprintf("Checking for roles granted to a deleted GSA named '%s'", report.GSA),
+		Severity: severityMedium,
+		DocLink:  docDeletedServiceAccounts,
+	}
+
+	prefix := deletedPrefix + "serviceAccount:" + report.GSA + "?uid="
+	var stale, unreadable, commands []string
+	for _, resource := range resources {
+		policy, err := getResourcePolicy(ctx, clients, resource)
+		if err != nil {
+			unreadable = append(unreadable, resource)
+			continue
+		}
+		for _, b := range policy.GetBindings() {
+			for _, m := range b.Members {
+				uid, ok := strings.CutPrefix(m, prefix)
+				if !ok {
+					continue
+				}
+				stale = append(stale, fmt.Sprintf("%s on %s (unique ID %s)", b.Role, resource, uid))
+				commands = append(commands, fmt.Sprintf("%s \\\n  --role=%s \\\n  --member=\"serviceAccount:%s\"", addIamPolicyBindingCommand(resource), b.Role, report.GSA))
+			}
+		}
+	}
+
+	result.Evidence = map[string]string{"resources": strings.Join(resources, ", ")}
+	if report.GSAUniqueID != "" {
+		result.Evidence["uniqueId"] = report.GSAUniqueID
+	}
+	if len(unreadable) > 0 {
+		result.Evidence["unreadablePolicies"] = strings.Join(unreadable, ", ")
+	}
+
+	if len(stale) == 0 {
+		result.Status = statusPass
+		result.Message = "No roles are granted to a deleted GSA with this email."
+		return result
+	}
+
+	result.Status = statusWarn
+	result.Evidence["staleBindings"] = strings.Join(stale, "; ")
+	result.Message = fmt.Sprintf("Roles were granted to a deleted GSA that was also named '%s'. They don't apply to the current GSA", report.GSA)
+	if report.GSAUniqueID != "" {
+		result.Message += fmt.Sprintf(" (unique ID %s)", report.GSAUniqueID)
+	}
+	result.Message += fmt.Sprintf(":\n      - %s", strings.Join(stale, "\n      - "))
+	result.Remediation = "If the current GSA should keep these roles, grant them again:\n" + strings.Join(commands, "\n")
+	return result
+}
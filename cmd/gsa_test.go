@@ -0,0 +1,237 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeOrgPolicies answers BooleanPolicyEnforced from a map keyed by resource.
+type fakeOrgPolicies struct {
+	enforced map[string]bool
+	err      error
+}
+
+func (f *fakeOrgPolicies) BooleanPolicyEnforced(ctx context.Context, resource, constraint string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.enforced[resource], nil
+}
+
+func TestGsaProject(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"app@identity-project.iam.gserviceaccount.com", "identity-project"},
+		{"my-project@appspot.gserviceaccount.com", "my-project"},
+		{"123456789-compute@developer.gserviceaccount.com", ""},
+		{"service-123456789@gcp-sa-pubsub.iam.gserviceaccount.com", ""},
+		{"not-an-email", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			assert.Equal(t, tt.want, gsaProject(tt.email))
+		})
+	}
+	assert.Equal(t, "projects/-/serviceAccounts/app@identity-project.iam.gserviceaccount.com", gsaPolicyResource("app@identity-project.iam.gserviceaccount.com"))
+}
+
+func TestCheckCrossProjectUsage(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	gsa := "app@identity-project.iam.gserviceaccount.com"
+
+	result := checkCrossProjectUsage(ctx, &gcpClients{orgPolicies: &fakeOrgPolicies{}}, gsa, "identity-project")
+	assert.Equal(t, statusPass, result.Status)
+	assert.Equal(t, "identity-project", result.Evidence["gsaProject"])
+
+	result = checkCrossProjectUsage(ctx, &gcpClients{orgPolicies: &fakeOrgPolicies{enforced: map[string]bool{"projects/identity-project": true}}}, gsa, "identity-project")
+	assert.Equal(t, statusWarn, result.Status)
+	assert.Contains(t, result.Remediation, "disable-enforce iam.disableCrossProjectServiceAccountUsage")
+
+	result = checkCrossProjectUsage(ctx, &gcpClients{orgPolicies: &fakeOrgPolicies{err: fmt.Errorf("permission denied")}}, gsa, "identity-project")
+	assert.Equal(t, statusSkip, result.Status)
+}
+
+func TestPerformKsaCheckCrossProjectGSA(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	gsa := "app@identity-project.iam.gserviceaccount.com"
+	member := "serviceAccount:test-project.svc.id.goog[default/test-ksa]"
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: "test-project.svc.id.goog"},
+	}
+	ksa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test-ksa",
+		Namespace:   "default",
+		Annotations: map[string]string{gsaAnnotation: gsa},
+	}}
+
+	clients, cleanup := newMockGcpClients(ctx, t, &iampb.Policy{
+		Bindings: []*iampb.Binding{{Role: workloadIdentityUserRole, Members: []string{member}}},
+	}, nil, nil, nil)
+	defer cleanup()
+	clients.orgPolicies = &fakeOrgPolicies{enforced: map[string]bool{"projects/identity-project": true}}
+
+	report, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(ksa))
+	assert.NoError(t, err)
+	assert.Equal(t, "identity-project", report.GSAProject)
+	assert.Equal(t, statusWarn, report.Status)
+
+	var ids []string
+	for _, c := range report.Checks {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []string{checkClusterWorkloadIdentity, checkKsaExists, checkKsaAnnotation, checkGsaCrossProject, checkGsaExists, checkGsaKeys, checkIamWorkloadIdentityUser, checkGsaDeletedMembers, checkIamDenyPolicy}, ids)
+}
+
+func TestInspectGSA(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+
+	t.Run("Exists", func(t *testing.T) {
+		result, sa, err := inspectGSA(ctx, &gcpClients{iam: &fakeIamAdmin{}}, gsa)
+		assert.NoError(t, err)
+		assert.Equal(t, statusPass, result.Status)
+		assert.Equal(t, "100", sa.UniqueId)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		result, sa, err := inspectGSA(ctx, &gcpClients{iam: &fakeIamAdmin{accountErr: status.Error(codes.NotFound, "not found")}}, gsa)
+		assert.ErrorContains(t, err, "does not exist")
+		assert.Nil(t, sa)
+		assert.Equal(t, "gcloud iam service-accounts create app \\\n  --project=test-project", result.Remediation)
+	})
+
+	t.Run("Missing Google-managed GSA", func(t *testing.T) {
+		missing := &gcpClients{iam: &fakeIamAdmin{accountErr: status.Error(codes.NotFound, "not found")}}
+		for _, email := range []string{"123-compute@developer.gserviceaccount.com", "service-123@gcp-sa-pubsub.iam.gserviceaccount.com"} {
+			result, _, err := inspectGSA(ctx, missing, email)
+			assert.ErrorContains(t, err, "does not exist")
+			assert.NotContains(t, result.Remediation, "service-accounts create")
+			assert.Contains(t, result.Remediation, "gcloud iam service-accounts undelete")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		admin := &fakeIamAdmin{accounts: map[string]*adminpb.ServiceAccount{gsa: {Email: gsa, UniqueId: "100", Disabled: true}}}
+		result, _, err := inspectGSA(ctx, &gcpClients{iam: admin}, gsa)
+		assert.ErrorContains(t, err, "is disabled")
+		assert.Equal(t, "gcloud iam service-accounts enable "+gsa, result.Remediation)
+	})
+
+	t.Run("Inaccessible", func(t *testing.T) {
+		result, sa, err := inspectGSA(ctx, &gcpClients{iam: &fakeIamAdmin{accountErr: status.Error(codes.PermissionDenied, "denied")}}, gsa)
+		assert.NoError(t, err)
+		assert.Nil(t, sa)
+		assert.Equal(t, statusSkip, result.Status)
+		assert.Contains(t, result.Message, "iam.serviceAccounts.get")
+	})
+}
+
+func TestCheckGSAKeys(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+
+	result := checkGSAKeys(ctx, &gcpClients{iam: &fakeIamAdmin{}}, gsa)
+	assert.Equal(t, statusPass, result.Status)
+
+	admin := &fakeIamAdmin{keys: []*adminpb.ServiceAccountKey{
+		{Name: "projects/test-project/serviceAccounts/" + gsa + "/keys/abc123"},
+		{Name: "projects/test-project/serviceAccounts/" + gsa + "/keys/old", Disabled: true},
+	}}
+	result = checkGSAKeys(ctx, &gcpClients{iam: admin}, gsa)
+	assert.Equal(t, statusWarn, result.Status)
+	assert.Equal(t, "abc123", result.Evidence["keys"])
+	assert.Equal(t, "If no other system depends on them, delete the keys:\ngcloud iam service-accounts keys delete abc123 --iam-account="+gsa, result.Remediation)
+
+	result = checkGSAKeys(ctx, &gcpClients{iam: &fakeIamAdmin{keysErr: status.Error(codes.PermissionDenied, "denied")}}, gsa)
+	assert.Equal(t, statusSkip, result.Status)
+}
+
+func TestCheckDeletedGSAMembers(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	h := &fakeHierarchy{
+		policies: map[string]*iampb.Policy{
+			"projects/test-project": {Bindings: []*iampb.Binding{
+				{Role: "roles/storage.objectViewer", Members: []string{"deleted:serviceAccount:" + gsa + "?uid=42", "serviceAccount:other@test-project.iam.gserviceaccount.com"}},
+				{Role: "roles/pubsub.publisher", Members: []string{"deleted:serviceAccount:app-2@test-project.iam.gserviceaccount.com?uid=7"}},
+			}},
+			"folders/2": {Bindings: []*iampb.Binding{
+				{Role: "roles/logging.logWriter", Members: []string{"deleted:serviceAccount:" + gsa + "?uid=42"}},
+			}},
+		},
+		denied: map[string]bool{"organizations/9": true},
+	}
+	report := newKsaReport("test-cluster", "us-central1", "default", "test-ksa")
+	report.GSA = gsa
+	report.GSAUniqueID = "100"
+
+	result := checkDeletedGSAMembers(ctx, newHierarchyClients(h), report, []string{"projects/test-project", "folders/2", "organizations/9"})
+	assert.Equal(t, statusWarn, result.Status)
+	assert.Equal(t, "roles/storage.objectViewer on projects/test-project (unique ID 42); roles/logging.logWriter on folders/2 (unique ID 42)", result.Evidence["staleBindings"])
+	assert.Equal(t, "organizations/9", result.Evidence["unreadablePolicies"])
+	assert.Contains(t, result.Message, "(unique ID 100)")
+	assert.Contains(t, result.Remediation, "gcloud resource-manager folders add-iam-policy-binding 2 \\\n  --role=roles/logging.logWriter \\\n  --member=\"serviceAccount:"+gsa+"\"")
+
+	report.GSA = "fresh@test-project.iam.gserviceaccount.com"
+	result = checkDeletedGSAMembers(ctx, newHierarchyClients(h), report, []string{"projects/test-project"})
+	assert.Equal(t, statusPass, result.Status)
+}
+
+func TestPerformKsaCheckGSAPolicyErrors(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: "test-project.svc.id.goog"},
+	}
+	ksa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test-ksa",
+		Namespace:   "default",
+		Annotations: map[string]string{gsaAnnotation: "app@test-project.iam.gserviceaccount.com"},
+	}}
+
+	clients, cleanup := newMockGcpClients(ctx, t, nil, status.Error(codes.PermissionDenied, "denied"), nil, nil)
+	defer cleanup()
+	_, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(ksa))
+	assert.ErrorContains(t, err, "requires iam.serviceAccounts.getIamPolicy")
+
+	clients, cleanup = newMockGcpClients(ctx, t, nil, nil, nil, nil)
+	defer cleanup()
+	clients.iam = &fakeIamAdmin{accountErr: status.Error(codes.NotFound, "not found")}
+	report, err := performKsaCheck(ctx, clients, "default", "test-ksa", cluster, newMockClientset(ksa))
+	assert.ErrorContains(t, err, "does not exist")
+	assert.Equal(t, checkGsaExists, report.Checks[len(report.Checks)-1].ID)
+}
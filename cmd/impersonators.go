@@ -0,0 +1,472 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gsaCmd represents the gsa command
+var gsaCmd = &cobra.Command{
+	Use:   "gsa <gsa-email>",
+	Short: "Lists the KSAs that can impersonate a Google Service Account and checks them against the cluster.",
+	Long: `Reads the IAM policy of a Google Service Account and lists every roles/iam.workloadIdentityUser
+member. Each member is parsed into its workload pool, namespace and KSA and looked up in the cluster:
+
+  active               the KSA exists and is annotated with the GSA
+  dangling             the namespace or the KSA no longer exists
+  unannotated          the KSA exists but is not annotated with any GSA
+  annotated-other-gsa  the KSA exists but is annotated with a different GSA
+  other-pool           the member belongs to another workload pool or cluster
+  deleted              the member was deleted and grants nothing
+
+KSAs in the cluster that are annotated with the GSA but not bound to it are listed as unbound.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		gsaEmail := args[0]
+		ctx := context.Background()
+
+		if inspectionToken != "" {
+			log.Fatalf("❌ The IAM policy of a GSA cannot be read with an inspection token.")
+		}
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		clientset, err := getK8sClientset(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		report, err := performGsaCheck(ctx, clients, gsaEmail, cluster, clientset)
+		if err != nil {
+			log.Fatalf("❌ Failed to look up the KSAs that can impersonate GSA '%s': %v", gsaEmail, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ One or more KSAs annotated with GSA '%s' cannot impersonate it.", gsaEmail)
+		}
+	},
+}
+
+// memberState classifies a roles/iam.workloadIdentityUser member against a cluster.
+type memberState string
+
+const (
+	memberActive      memberState = "active"
+	memberDangling    memberState = "dangling"
+	memberUnannotated memberState = "unannotated"
+	memberOtherGSA    memberState = "annotated-other-gsa"
+	memberOtherPool   memberState = "other-pool"
+	memberDeleted     memberState = "deleted"
+	// memberUnbound is a KSA annotated with the GSA that no member covers. It is the reverse of
+	// the other states: the annotation exists but the binding doesn't.
+	memberUnbound memberState = "unbound"
+)
+
+// impersonator is one Workload Identity member of a GSA policy, or an annotated KSA lacking one.
+type impersonator struct {
+	Member string      `json:"member,omitempty"`
+	State  memberState `json:"state"`
+	// Scope is ksa, namespace, cluster or pool.
+	Scope     string `json:"scope,omitempty"`
+	Pool      string `json:"workloadPool,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	KSA       string `json:"ksa,omitempty"`
+	// KSAs lists the annotated KSAs a namespace, cluster or pool member covers.
+	KSAs []string `json:"ksas,omitempty"`
+	// Annotation is the GSA the KSA is annotated with, when it isn't this one.
+	Annotation     string           `json:"annotation,omitempty"`
+	Condition      string           `json:"condition,omitempty"`
+	ConditionHolds conditionVerdict `json:"conditionHolds,omitempty"`
+	Detail         string           `json:"detail"`
+	Remediation    string           `json:"remediation,omitempty"`
+}
+
+// gsaReport lists the KSAs that can impersonate a GSA.
+type gsaReport struct {
+	APIVersion    string         `json:"apiVersion"`
+	Kind          string         `json:"kind"`
+	Status        checkStatus    `json:"status"`
+	Cluster       clusterInfo    `json:"cluster"`
+	GSA           string         `json:"gsa"`
+	Impersonators []impersonator `json:"impersonators"`
+	// OtherMembers are roles/iam.workloadIdentityUser members that aren't Workload Identity
+	// principals, such as users or groups.
+	OtherMembers []string `json:"otherMembers,omitempty"`
+}
+
+// scopeName returns the name used for a principal scope in reports.
+func scopeName(s principalScope) string {
+	switch s {
+	case scopeNamespace:
+		return "namespace"
+	case scopeCluster:
+		return "cluster"
+	case scopePool:
+		return "pool"
+	}
+	return "ksa"
+}
+
+// removeWorkloadIdentityUserCommand returns the command that revokes member's
+// roles/iam.workloadIdentityUser binding on the GSA, along with any condition it carries.
+func removeWorkloadIdentityUserCommand(gsaEmail, member, condition string) string {
+	cmd := fmt.Sprintf("gcloud iam service-accounts remove-iam-policy-binding %s \\\n  --role=%s \\\n  --member=\"%s\"", gsaEmail, workloadIdentityUserRole, member)
+	if condition != "" {
+		cmd += " \\\n  --all"
+	}
+	return cmd
+}
+
+// annotatedKSAs lists the KSAs in namespace, or in every namespace when it is empty, that are
+// annotated with the GSA.
+func annotatedKSAs(ctx context.Context, clientset kubernetes.Interface, namespace, gsaEmail string) ([]corev1.ServiceAccount, error) {
+	list, err := clientset.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	var annotated []corev1.ServiceAccount
+	for _, sa := range list.Items {
+		if strings.EqualFold(sa.Annotations[gsaAnnotation], gsaEmail) {
+			annotated = append(annotated, sa)
+		}
+	}
+	return annotated, nil
+}
+
+// inPool reports whether the principal belongs to the workload pool of the cluster identified by id.
+func (p *wifPrincipal) inPool(id ksaIdentity) bool {
+	return p.Pool == id.WorkloadPool && (p.ProjectNumber == "" || id.PoolProjectNumber == "" || p.ProjectNumber == id.PoolProjectNumber)
+}
+
+// classifyImpersonator looks up the KSAs a parsed member covers in the cluster identified by id,
+// whose Namespace and Name are ignored, and records what it finds in imp. gsaEmail is the GSA the
+// member is granted on; it is empty for roles granted to the member directly, which only KSAs
+// without an annotation use. revoke is the command that removes the grant.
+func classifyImpersonator(ctx context.Context, clientset kubernetes.Interface, id ksaIdentity, gsaEmail string, p *wifPrincipal, imp *impersonator, revoke string) error {
+	imp.Scope, imp.Pool, imp.Namespace, imp.KSA = scopeName(p.Scope), p.Pool, p.Namespace, p.KSA
+
+	switch {
+	case p.Deleted:
+		imp.State = memberDeleted
+		imp.Detail = "The member was deleted and grants nothing."
+		imp.Remediation = revoke
+		return nil
+	case !p.inPool(id):
+		imp.State = memberOtherPool
+		imp.Detail = fmt.Sprintf("The member belongs to workload pool '%s', not this cluster's pool '%s'.", p.Pool, id.WorkloadPool)
+		return nil
+	case p.Scope == scopeCluster && p.Cluster != id.Cluster:
+		imp.State = memberOtherPool
+		imp.Detail = fmt.Sprintf("The member covers cluster '%s', not this cluster.", p.Cluster)
+		return nil
+	}
+
+	if p.Scope == scopeKSA {
+		ksa, err := clientset.CoreV1().ServiceAccounts(p.Namespace).Get(ctx, p.KSA, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, nsErr := clientset.CoreV1().Namespaces().Get(ctx, p.Namespace, metav1.GetOptions{})
+			switch {
+			case apierrors.IsNotFound(nsErr):
+				imp.Detail = fmt.Sprintf("Namespace '%s' does not exist.", p.Namespace)
+			case nsErr != nil:
+				return fmt.Errorf("failed to get namespace '%s': %w", p.Namespace, nsErr)
+			default:
+				imp.Detail = fmt.Sprintf("KSA '%s/%s' does not exist.", p.Namespace, p.KSA)
+			}
+			imp.State = memberDangling
+			imp.Remediation = revoke
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", p.KSA, p.Namespace, err)
+		}
+		switch annotation := ksa.Annotations[gsaAnnotation]; {
+		case gsaEmail == "" && annotation == "":
+			imp.State = memberActive
+			imp.Detail = fmt.Sprintf("KSA '%s/%s' exists and authenticates as its own principal.", p.Namespace, p.KSA)
+		case gsaEmail == "":
+			imp.State = memberOtherGSA
+			imp.Annotation = annotation
+			imp.Detail = fmt.Sprintf("KSA '%s/%s' is annotated with GSA '%s', so it authenticates as the GSA and doesn't use this grant.", p.Namespace, p.KSA, annotation)
+			imp.Remediation = revoke
+		case strings.EqualFold(annotation, gsaEmail):
+			imp.State = memberActive
+			imp.Detail = fmt.Sprintf("KSA '%s/%s' is annotated with the GSA.", p.Namespace, p.KSA)
+		case annotation == "":
+			imp.State = memberUnannotated
+			imp.Detail = fmt.Sprintf("KSA '%s/%s' can impersonate the GSA but is not annotated with it, so its pods don't use it.", p.Namespace, p.KSA)
+			imp.Remediation = fmt.Sprintf("Annotate the KSA if it should use the GSA:\nkubectl annotate serviceaccount %s --namespace %s %s=%s\nor revoke the binding:\n%s", p.KSA, p.Namespace, gsaAnnotation, gsaEmail, revoke)
+		default:
+			imp.State = memberOtherGSA
+			imp.Annotation = annotation
+			imp.Detail = fmt.Sprintf("KSA '%s/%s' is annotated with GSA '%s' instead.", p.Namespace, p.KSA, annotation)
+			imp.Remediation = revoke
+		}
+		return nil
+	}
+
+	// Namespace, cluster and pool members cover every KSA in their scope; report the ones that
+	// are annotated with the GSA.
+	namespace := ""
+	if p.Scope == scopeNamespace {
+		namespace = p.Namespace
+		_, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			imp.State = memberDangling
+			imp.Detail = fmt.Sprintf("Namespace '%s' does not exist.", namespace)
+			imp.Remediation = revoke
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get namespace '%s': %w", namespace, err)
+		}
+	}
+	if gsaEmail == "" {
+		imp.State = memberActive
+		imp.Detail = fmt.Sprintf("Covers every unannotated KSA in its %s.", imp.Scope)
+		return nil
+	}
+	annotated, err := annotatedKSAs(ctx, clientset, namespace, gsaEmail)
+	if err != nil {
+		return err
+	}
+	for _, sa := range annotated {
+		imp.KSAs = append(imp.KSAs, sa.Namespace+"/"+sa.Name)
+	}
+	if len(imp.KSAs) == 0 {
+		imp.State = memberUnannotated
+		imp.Detail = fmt.Sprintf("The member covers every KSA in its %s, but none of them is annotated with the GSA.", imp.Scope)
+		imp.Remediation = revoke
+		return nil
+	}
+	imp.State = memberActive
+	imp.Detail = fmt.Sprintf("Covers %d annotated KSA(s).", len(imp.KSAs))
+	return nil
+}
+
+// performGsaCheck reads the IAM policy of the GSA and classifies every roles/iam.workloadIdentityUser
+// member against the cluster. The report fails when a KSA annotated with the GSA isn't covered by
+// any member, and warns about stale members.
+func performGsaCheck(ctx context.Context, clients *gcpClients, gsaEmail string, cluster *containerpb.Cluster, clientset kubernetes.Interface) (*gsaReport, error) {
+	if cluster.WorkloadIdentityConfig == nil || cluster.WorkloadIdentityConfig.WorkloadPool == "" {
+		return nil, fmt.Errorf("Workload Identity is not enabled on cluster '%s'", cluster.Name)
+	}
+	report := &gsaReport{
+		APIVersion:    reportAPIVersion,
+		Kind:          "GsaReport",
+		Status:        statusPass,
+		Cluster:       clusterInfo{Project: projectID, Location: cluster.Location, Name: cluster.Name, WorkloadPool: cluster.WorkloadIdentityConfig.WorkloadPool},
+		GSA:           gsaEmail,
+		Impersonators: []impersonator{},
+	}
+	if number, err := clients.projectNumber(ctx, workloadPoolProject(report.Cluster.WorkloadPool)); err == nil {
+		report.Cluster.WorkloadPoolProjectNumber = number
+	}
+	id := ksaIdentity{
+		WorkloadPool:      report.Cluster.WorkloadPool,
+		PoolProjectNumber: report.Cluster.WorkloadPoolProjectNumber,
+		Cluster:           clusterResourceName(projectID, cluster.Location, cluster.Name),
+	}
+
+	policy, err := clients.iam.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: gsaPolicyResource(gsaEmail),
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			return nil, fmt.Errorf("failed to get IAM policy for GSA '%s': the GSA does not exist: %w", gsaEmail, err)
+		case codes.PermissionDenied:
+			return nil, fmt.Errorf("failed to get IAM policy for GSA '%s': reading it requires iam.serviceAccounts.getIamPolicy on the GSA: %w", gsaEmail, err)
+		}
+		return nil, fmt.Errorf("failed to get IAM policy for GSA '%s': %w", gsaEmail, err)
+	}
+
+	// The unique ID only sharpens resource.name conditions, so a failed lookup isn't fatal.
+	uniqueID := ""
+	if sa, err := clients.iam.GetServiceAccount(ctx, &adminpb.GetServiceAccountRequest{Name: gsaPolicyResource(gsaEmail)}); err == nil {
+		uniqueID = sa.UniqueId
+	}
+	env := gsaConditionEnv(uniqueID)
+	covered := map[string]bool{}
+	for _, binding := range policy.InternalProto.GetBindings() {
+		if binding.Role != workloadIdentityUserRole {
+			continue
+		}
+		for _, m := range binding.Members {
+			p, ok := parsePrincipal(m)
+			if !ok {
+				report.OtherMembers = append(report.OtherMembers, m)
+				continue
+			}
+			imp := impersonator{Member: m}
+			if expression := binding.GetCondition().GetExpression(); expression != "" {
+				imp.Condition = expression
+				imp.ConditionHolds = evaluateCondition(expression, env)
+			}
+			revoke := removeWorkloadIdentityUserCommand(gsaEmail, m, imp.Condition)
+			if err := classifyImpersonator(ctx, clientset, id, gsaEmail, p, &imp, revoke); err != nil {
+				return nil, err
+			}
+			if imp.State == memberActive {
+				if p.Scope == scopeKSA {
+					covered[p.Namespace+"/"+p.KSA] = true
+				}
+				for _, ksa := range imp.KSAs {
+					covered[ksa] = true
+				}
+			}
+			report.Impersonators = append(report.Impersonators, imp)
+		}
+	}
+
+	// The reverse direction: KSAs that are annotated with the GSA but can't impersonate it.
+	annotated, err := annotatedKSAs(ctx, clientset, "", gsaEmail)
+	if err != nil {
+		return nil, err
+	}
+	for _, sa := range annotated {
+		if covered[sa.Namespace+"/"+sa.Name] {
+			continue
+		}
+		report.Impersonators = append(report.Impersonators, impersonator{
+			State:     memberUnbound,
+			Scope:     scopeName(scopeKSA),
+			Pool:      id.WorkloadPool,
+			Namespace: sa.Namespace,
+			KSA:       sa.Name,
+			Detail:    fmt.Sprintf("KSA '%s/%s' is annotated with the GSA but no %s member covers it.", sa.Namespace, sa.Name, workloadIdentityUserRole),
+			Remediation: fmt.Sprintf("gcloud iam service-accounts add-iam-policy-binding %s \\\n  --role=%s \\\n  --member=\"%s\"",
+				gsaEmail, workloadIdentityUserRole, ksaServiceAccountMember(id.WorkloadPool, sa.Namespace, sa.Name)),
+		})
+	}
+
+	for _, imp := range report.Impersonators {
+		s := imp.status()
+		if statusRank(s) > statusRank(report.Status) {
+			report.Status = s
+		}
+	}
+	return report, nil
+}
+
+// status returns the verdict an impersonator contributes to the report.
+func (i impersonator) status() checkStatus {
+	switch i.State {
+	case memberUnbound:
+		return statusFail
+	case memberActive, memberOtherPool:
+		if i.ConditionHolds == conditionFalse {
+			return statusWarn
+		}
+		return statusPass
+	}
+	return statusWarn
+}
+
+// renderText writes a table of the impersonators followed by the suggested fixes.
+func (r *gsaReport) renderText(w io.Writer) {
+	fmt.Fprintf(w, "🔎 KSAs that can impersonate GSA '%s' (cluster '%s', pool '%s')\n", r.GSA, r.Cluster.Name, r.Cluster.WorkloadPool)
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+	if len(r.Impersonators) == 0 {
+		fmt.Fprintf(w, "ℹ️  No %s member or annotated KSA was found.\n", workloadIdentityUserRole)
+	}
+
+	impersonators := sortedByStatus(r.Impersonators)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tSCOPE\tKSA\tDETAIL")
+	for _, imp := range impersonators {
+		detail := imp.Detail
+		if imp.Condition != "" {
+			detail += fmt.Sprintf(" Condition (%s): %s", imp.ConditionHolds, imp.Condition)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", imp.State, imp.Scope, imp.target(), detail)
+	}
+	tw.Flush()
+
+	for _, m := range r.OtherMembers {
+		fmt.Fprintf(w, "ℹ️  %s is also granted %s.\n", m, workloadIdentityUserRole)
+	}
+	for _, imp := range impersonators {
+		if imp.Remediation == "" {
+			continue
+		}
+		renderRemediation(w, fmt.Sprintf("%s %s", imp.State, imp.target()), imp.Remediation)
+	}
+}
+
+// renderRemediation writes a titled, indented suggested fix.
+func renderRemediation(w io.Writer, title, remediation string) {
+	fmt.Fprintf(w, "\n🔧 %s:\n", title)
+	for _, line := range strings.Split(remediation, "\n") {
+		fmt.Fprintf(w, "   %s\n", line)
+	}
+}
+
+// target names the KSAs an impersonator covers: NAMESPACE/KSA, NAMESPACE, or * for a whole
+// cluster or pool.
+func (i impersonator) target() string {
+	switch {
+	case i.KSA != "":
+		return i.Namespace + "/" + i.KSA
+	case i.Namespace != "":
+		return i.Namespace
+	}
+	return "*"
+}
+
+// sortedByStatus returns a copy of impersonators with the ones needing attention first.
+func sortedByStatus(impersonators []impersonator) []impersonator {
+	sorted := append([]impersonator(nil), impersonators...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return statusRank(sorted[i].status()) > statusRank(sorted[j].status())
+	})
+	return sorted
+}
+
+func init() {
+	checkCmd.AddCommand(gsaCmd)
+}
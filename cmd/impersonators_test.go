@@ -0,0 +1,194 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/type/expr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPerformGsaCheck(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	pool := "test-project.svc.id.goog"
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool},
+	}
+
+	ksa := func(namespace, name, annotation string) *corev1.ServiceAccount {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if annotation != "" {
+			sa.Annotations = map[string]string{gsaAnnotation: annotation}
+		}
+		return sa
+	}
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	clientset := fake.NewSimpleClientset(
+		namespace("web"), namespace("batch"), namespace("jobs"),
+		ksa("web", "frontend", gsa),
+		ksa("web", "backend", ""),
+		ksa("batch", "worker", "other@test-project.iam.gserviceaccount.com"),
+		ksa("jobs", "runner", gsa),
+		ksa("jobs", "cron", gsa),
+		ksa("api", "server", gsa),
+	)
+
+	admin := &fakeIamAdmin{policy: &iampb.Policy{Bindings: []*iampb.Binding{
+		{Role: workloadIdentityUserRole, Members: []string{
+			ksaServiceAccountMember(pool, "web", "frontend"),
+			ksaServiceAccountMember(pool, "web", "backend"),
+			ksaServiceAccountMember(pool, "batch", "worker"),
+			ksaServiceAccountMember(pool, "web", "deleted-ksa"),
+			ksaServiceAccountMember(pool, "gone", "app"),
+			ksaServiceAccountMember("other-project.svc.id.goog", "web", "frontend"),
+			principalSetPrefix + "projects/123/locations/global/workloadIdentityPools/" + pool + "/namespace/jobs",
+			"deleted:" + ksaServiceAccountMember(pool, "web", "old") + "?uid=1",
+			"group:admins@example.com",
+		}},
+		{
+			Role:      workloadIdentityUserRole,
+			Members:   []string{ksaPrincipal("123", pool, "batch", "expired")},
+			Condition: &expr.Expr{Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`},
+		},
+		{Role: "roles/iam.serviceAccountTokenCreator", Members: []string{ksaServiceAccountMember(pool, "api", "server")}},
+	}}}
+	clients := newHierarchyClients(&fakeHierarchy{numbers: map[string]string{"test-project": "123"}})
+	clients.iam = admin
+
+	report, err := performGsaCheck(ctx, clients, gsa, cluster, clientset)
+	assert.NoError(t, err)
+	assert.Equal(t, "123", report.Cluster.WorkloadPoolProjectNumber)
+	assert.Equal(t, []string{"group:admins@example.com"}, report.OtherMembers)
+
+	states := map[string]memberState{}
+	for _, imp := range report.Impersonators {
+		states[imp.target()+" "+imp.Pool] = imp.State
+	}
+	assert.Equal(t, map[string]memberState{
+		"web/frontend " + pool:                   memberActive,
+		"web/backend " + pool:                    memberUnannotated,
+		"batch/worker " + pool:                   memberOtherGSA,
+		"web/deleted-ksa " + pool:                memberDangling,
+		"gone/app " + pool:                       memberDangling,
+		"web/frontend other-project.svc.id.goog": memberOtherPool,
+		"jobs " + pool:                           memberActive,
+		"web/old " + pool:                        memberDeleted,
+		"batch/expired " + pool:                  memberDangling,
+		"api/server " + pool:                     memberUnbound,
+	}, states)
+	assert.Equal(t, statusFail, report.Status)
+
+	for _, imp := range report.Impersonators {
+		switch imp.target() {
+		case "jobs":
+			assert.Equal(t, []string{"jobs/cron", "jobs/runner"}, imp.KSAs)
+		case "gone/app":
+			assert.Equal(t, "Namespace 'gone' does not exist.", imp.Detail)
+		case "batch/worker":
+			assert.Equal(t, "other@test-project.iam.gserviceaccount.com", imp.Annotation)
+		case "batch/expired":
+			assert.Equal(t, conditionFalse, imp.ConditionHolds)
+			assert.Contains(t, imp.Remediation, "--all")
+		case "api/server":
+			assert.Contains(t, imp.Remediation, "add-iam-policy-binding "+gsa)
+		}
+	}
+
+	var buf bytes.Buffer
+	report.renderText(&buf)
+	assert.Regexp(t, `(?m)^unbound\s+ksa\s+api/server\s`, buf.String())
+	assert.Contains(t, buf.String(), "group:admins@example.com is also granted")
+}
+
+func TestPerformGsaCheckAllActive(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	pool := "test-project.svc.id.goog"
+	cluster := &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: pool},
+	}
+	clientset := fake.NewSimpleClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "frontend", Namespace: "web", Annotations: map[string]string{gsaAnnotation: gsa},
+	}})
+	clients := newHierarchyClients(&fakeHierarchy{})
+	clients.iam = &fakeIamAdmin{policy: &iampb.Policy{Bindings: []*iampb.Binding{
+		{Role: workloadIdentityUserRole, Members: []string{
+			principalSetPrefix + "projects/123/locations/global/workloadIdentityPools/" + pool + "/kubernetes.cluster/" + clusterURLPrefix + clusterResourceName("test-project", "us-central1", "test-cluster"),
+			principalSetPrefix + "projects/123/locations/global/workloadIdentityPools/" + pool + "/kubernetes.cluster/" + clusterURLPrefix + clusterResourceName("test-project", "us-central1", "other-cluster"),
+		}},
+	}}}
+
+	report, err := performGsaCheck(ctx, clients, gsa, cluster, clientset)
+	assert.NoError(t, err)
+	assert.Equal(t, statusPass, report.Status)
+	assert.Len(t, report.Impersonators, 2)
+	assert.Equal(t, memberActive, report.Impersonators[0].State)
+	assert.Equal(t, []string{"web/frontend"}, report.Impersonators[0].KSAs)
+	assert.Equal(t, memberOtherPool, report.Impersonators[1].State)
+
+	cluster.WorkloadIdentityConfig = nil
+	_, err = performGsaCheck(ctx, clients, gsa, cluster, clientset)
+	assert.ErrorContains(t, err, "Workload Identity is not enabled")
+}
+
+func TestClassifyImpersonatorNamespaceError(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	pool := "test-project.svc.id.goog"
+	id := ksaIdentity{WorkloadPool: pool}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "web", errors.New("access denied"))
+	})
+
+	for name, member := range map[string]string{
+		"KSA":       ksaServiceAccountMember(pool, "web", "frontend"),
+		"Namespace": principalSetPrefix + "projects/123/locations/global/workloadIdentityPools/" + pool + "/namespace/web",
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, ok := parsePrincipal(member)
+			assert.True(t, ok)
+			var imp impersonator
+			err := classifyImpersonator(ctx, clientset, id, gsa, p, &imp, "revoke")
+			assert.ErrorContains(t, err, "failed to get namespace 'web'")
+			assert.True(t, apierrors.IsForbidden(err))
+			assert.Empty(t, imp.State)
+		})
+	}
+}
@@ -18,6 +18,7 @@ package cmd
 import (
 	"context"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -37,13 +38,13 @@ It checks for the required annotation on the KSA and the corresponding IAM bindi
 		ksaName := args[0]
 		ctx := context.Background()
 
-		gkeClient, err := newGKEClient(ctx)
+		clients, err := newGCPClients(ctx)
 		if err != nil {
-			log.Fatalf("❌ Failed to create GKE client: %v", err)
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
 		}
-		defer gkeClient.Close()
+		defer clients.Close()
 
-		cluster, err := getGKECluster(ctx, gkeClient, projectID, location, clusterName)
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
 		if err != nil {
 			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
 		}
@@ -53,7 +54,11 @@ It checks for the required annotation on the KSA and the corresponding IAM bindi
 			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
 		}
 
-		if err := performKsaCheck(ctx, ksaNamespace, ksaName, cluster, clientset); err != nil {
+		report, err := performKsaCheck(ctx, clients, ksaNamespace, ksaName, cluster, clientset)
+		if outErr := writeOutput(os.Stdout, outputFormat, report); outErr != nil {
+			log.Fatalf("❌ Failed to write report: %v", outErr)
+		}
+		if err != nil {
 			log.Fatalf("❌ Check failed: %v", err)
 		}
 	},
@@ -0,0 +1,372 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	checkNodeMetadataServer     = "node.gke-metadata-server"
+	checkNodeMetadataServerLogs = "node.gke-metadata-server-logs"
+	// metadataServerNamespace and metadataServerSelector find the pods of the gke-metadata-server
+	// DaemonSet, which answers the metadata requests of Workload Identity pods on each node.
+	metadataServerNamespace = "kube-system"
+	metadataServerSelector  = "k8s-app=gke-metadata-server"
+	metadataServerContainer = "gke-metadata-server"
+	// maxLogLinesPerPod caps the log lines kept per workload pod; the most recent ones are kept.
+	maxLogLinesPerPod = 100
+)
+
+// metadataServerPods returns the gke-metadata-server pods keyed by the node they run on.
+func metadataServerPods(ctx context.Context, clientset kubernetes.Interface) (map[string]*corev1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(metadataServerNamespace).List(ctx, metav1.ListOptions{LabelSelector: metadataServerSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gke-metadata-server pods in namespace '%s': %w", metadataServerNamespace, err)
+	}
+	byNode := map[string]*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		// During a rollout a node briefly has two pods; prefer the ready one.
+		if current, ok := byNode[pod.Spec.NodeName]; ok && podReady(current) {
+			continue
+		}
+		byNode[pod.Spec.NodeName] = pod
+	}
+	return byNode, nil
+}
+
+// podReady reports whether the pod's Ready condition is true.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// metadataServerHealth assesses the gke-metadata-server pod of one node. It returns the status,
+// a short state for the evidence and, unless the pod is healthy, a sentence explaining the problem.
+func metadataServerHealth(node string, pod *corev1.Pod) (checkStatus, string, string) {
+	if pod == nil {
+		return statusFail, "missing", fmt.Sprintf("No gke-metadata-server pod runs on node '%s', so pods on it can't get Workload Identity credentials.", node)
+	}
+
+	var restarts int32
+	var crashLooping, oomKilled bool
+	for _, s := range pod.Status.ContainerStatuses {
+		restarts += s.RestartCount
+		if s.State.Waiting != nil && s.State.Waiting.Reason == "CrashLoopBackOff" {
+			crashLooping = true
+		}
+		if t := s.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+			oomKilled = true
+		}
+	}
+
+	var problems []string
+	if oomKilled {
+		problems = append(problems, "was last terminated because it ran out of memory (OOMKilled)")
+	}
+	if restarts > 0 {
+		problems = append(problems, fmt.Sprintf("has restarted %d times", restarts))
+	}
+	status := statusWarn
+	state := fmt.Sprintf("ready, %d restarts", restarts)
+	switch {
+	case crashLooping:
+		status, state = statusFail, "CrashLoopBackOff"
+		problems = append([]string{"is in CrashLoopBackOff"}, problems...)
+	case !podReady(pod):
+		status, state = statusFail, "not ready"
+		problems = append([]string{fmt.Sprintf("is not ready (phase %s)", pod.Status.Phase)}, problems...)
+	case len(problems) == 0:
+		return statusPass, "ready", ""
+	}
+	if oomKilled {
+		state += ", OOMKilled"
+	}
+	return status, state, fmt.Sprintf("gke-metadata-server pod '%s' on node '%s' %s.", pod.Name, node, strings.Join(problems, " and "))
+}
+
+// checkMetadataServers verifies that a healthy gke-metadata-server pod runs on every node that
+// runs a pod of the workload.
+func checkMetadataServers(ctx context.Context, clientset kubernetes.Interface, workload workloadRef) checkResult {
+	result := checkResult{
+		ID:       checkNodeMetadataServer,
+		Title:    "Checking the gke-metadata-server pods on the workload's nodes",
+		Severity: severityHigh,
+		DocLink:  docMetadataServer,
+	}
+
+	pods, err := workloadPods(ctx, clientset, workload)
+	if err != nil {
+		result.Status = statusSkip
+		result.Message = fmt.Sprintf("The workload's pods could not be found: %v", err)
+		return result
+	}
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		nodes[pod.Spec.NodeName] = true
+	}
+	if len(nodes) == 0 {
+		result.Status = statusSkip
+		result.Message = "The workload has no running pods, so there are no nodes to check."
+		return result
+	}
+	servers, err := metadataServerPods(ctx, clientset)
+	if err != nil {
+		result.Status = statusSkip
+		result.Message = fmt.Sprintf("The gke-metadata-server pods could not be listed: %v", err)
+		return result
+	}
+
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	result.Status = statusPass
+	result.Evidence = map[string]string{}
+	var problems []string
+	missing := false
+	for _, node := range names {
+		status, state, problem := metadataServerHealth(node, servers[node])
+		result.Evidence[node] = state
+		if statusRank(status) > statusRank(result.Status) {
+			result.Status = status
+		}
+		if problem != "" {
+			problems = append(problems, problem)
+		}
+		missing = missing || servers[node] == nil
+	}
+
+	if len(problems) == 0 {
+		result.Message = fmt.Sprintf("A ready gke-metadata-server pod runs on each of the %d nodes running the workload's pods.", len(names))
+		return result
+	}
+	result.Message = strings.Join(problems, " ")
+	result.Remediation = fmt.Sprintf("Inspect the pods with 'kubectl -n %s describe pods -l %s' and their logs. gke-metadata-server is managed by GKE; if its pods keep restarting or are OOMKilled, contact Google Cloud support.", metadataServerNamespace, metadataServerSelector)
+	if missing {
+		result.Remediation += " A node without a gke-metadata-server pod usually belongs to a node pool that doesn't use the GKE_METADATA workload metadata mode; see the nodepool.gke-metadata check."
+	}
+	return result
+}
+
+// logErrorClass names a known gke-metadata-server error.
+type logErrorClass string
+
+const (
+	logAccessTokenDenied logErrorClass = "generate-access-token-denied"
+	logTokenExchange     logErrorClass = "token-exchange"
+	logUnknownPod        logErrorClass = "unknown-pod"
+)
+
+// logErrorPatterns recognise the known errors, most specific first.
+var logErrorPatterns = []struct {
+	class   logErrorClass
+	pattern *regexp.Regexp
+}{
+	{logAccessTokenDenied, regexp.MustCompile(`(?i)generateaccesstoken.*(permission|denied|403)|iam\.serviceaccounts\.getaccesstoken`)},
+	{logUnknownPod, regexp.MustCompile(`(?i)unable to find pod|not recorded in table|unknown pod|pod not found|could not find pod`)},
+	{logTokenExchange, regexp.MustCompile(`(?i)sts\.googleapis\.com|token exchange|exchang\w* .*token|invalid_grant|invalid_target`)},
+}
+
+// classifyLogLine returns the known error a log line reports, if any.
+func classifyLogLine(line string) logErrorClass {
+	for _, p := range logErrorPatterns {
+		if p.pattern.MatchString(line) {
+			return p.class
+		}
+	}
+	return ""
+}
+
+// metadataServerLogLine is a gke-metadata-server log line that concerns a workload pod.
+type metadataServerLogLine struct {
+	Class logErrorClass `json:"class,omitempty"`
+	Line  string        `json:"line"`
+}
+
+// metadataServerLogs holds the gke-metadata-server log lines about one workload pod.
+type metadataServerLogs struct {
+	Pod       string                  `json:"pod"`
+	Node      string                  `json:"node"`
+	ServerPod string                  `json:"serverPod,omitempty"`
+	Lines     []metadataServerLogLine `json:"lines,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+}
+
+// podLogMatcher matches the log lines that mention a pod by namespace/name or IP, or its KSA by
+// namespace/name. The metadata server logs requests it can't attribute to a pod by IP only.
+func podLogMatcher(pod *corev1.Pod, ksa string) *regexp.Regexp {
+	name := `(^|[^\w.-])(` + regexp.QuoteMeta(pod.Namespace+"/"+pod.Name) + `|` + regexp.QuoteMeta(pod.Namespace+"/"+ksa) + `)($|[^\w.-])`
+	if pod.Status.PodIP == "" {
+		return regexp.MustCompile(name)
+	}
+	return regexp.MustCompile(name + `|(^|[^\d.])` + regexp.QuoteMeta(pod.Status.PodIP) + `($|[^\d.])`)
+}
+
+// collectMetadataServerLogs reads the logs of the gke-metadata-server pod on the node of each of
+// the workload's pods, keeps the lines that mention the pod or its KSA and classifies the known
+// errors among them.
+func collectMetadataServerLogs(ctx context.Context, clientset kubernetes.Interface, workload workloadRef, since time.Duration) (checkResult, []metadataServerLogs) {
+	result := checkResult{
+		ID:       checkNodeMetadataServerLogs,
+		Title:    fmt.Sprintf("Searching the gke-metadata-server logs of the last %s for the workload's pods", since),
+		Severity: severityHigh,
+		DocLink:  docMetadataServer,
+	}
+
+	pods, err := workloadPods(ctx, clientset, workload)
+	if err != nil {
+		result.Status = statusSkip
+		result.Message = fmt.Sprintf("The workload's pods could not be found: %v", err)
+		return result, nil
+	}
+	if len(pods) == 0 {
+		result.Status = statusSkip
+		result.Message = "The workload has no running pods, so there are no logs to collect."
+		return result, nil
+	}
+	servers, err := metadataServerPods(ctx, clientset)
+	if err != nil {
+		result.Status = statusSkip
+		result.Message = fmt.Sprintf("The gke-metadata-server pods could not be listed: %v", err)
+		return result, nil
+	}
+
+	type serverLog struct {
+		out string
+		err error
+	}
+	fetched := map[string]serverLog{}
+	sinceSeconds := int64(since.Seconds())
+	counts := map[logErrorClass]int{}
+	matched, failed := 0, 0
+	var collected []metadataServerLogs
+	for i := range pods {
+		pod := &pods[i]
+		entry := metadataServerLogs{Pod: pod.Name, Node: pod.Spec.NodeName}
+		server := servers[pod.Spec.NodeName]
+		if server == nil {
+			entry.Error = fmt.Sprintf("no gke-metadata-server pod runs on node '%s'", pod.Spec.NodeName)
+			failed++
+			collected = append(collected, entry)
+			continue
+		}
+		entry.ServerPod = server.Name
+
+		logs, ok := fetched[server.Name]
+		if !ok {
+			opts := &corev1.PodLogOptions{SinceSeconds: &sinceSeconds}
+			for _, c := range server.Spec.Containers {
+				if c.Name == metadataServerContainer {
+					opts.Container = c.Name
+				}
+			}
+			logs.out, logs.err = podLogs(ctx, clientset, server.Namespace, server.Name, opts)
+			fetched[server.Name] = logs
+		}
+		if logs.err != nil {
+			entry.Error = logs.err.Error()
+			failed++
+			collected = append(collected, entry)
+			continue
+		}
+
+		matcher := podLogMatcher(pod, ksaFromPodSpec(pod.Spec))
+		for _, line := range strings.Split(logs.out, "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line == "" || !matcher.MatchString(line) {
+				continue
+			}
+			class := classifyLogLine(line)
+			if class != "" {
+				counts[class]++
+			}
+			matched++
+			entry.Lines = append(entry.Lines, metadataServerLogLine{Class: class, Line: line})
+		}
+		if len(entry.Lines) > maxLogLinesPerPod {
+			entry.Lines = entry.Lines[len(entry.Lines)-maxLogLinesPerPod:]
+		}
+		collected = append(collected, entry)
+	}
+
+	if failed == len(pods) {
+		result.Status = statusSkip
+		result.Message = fmt.Sprintf("No gke-metadata-server logs could be read: %s", collected[0].Error)
+		return result, collected
+	}
+
+	result.Evidence = map[string]string{"matchedLines": fmt.Sprint(matched)}
+	var found, fixes []string
+	for _, c := range []struct {
+		class  logErrorClass
+		status checkStatus
+		what   string
+		fix    string
+	}{
+		{logAccessTokenDenied, statusFail, "permission denied on generateAccessToken",
+			fmt.Sprintf("IAM refused to let the KSA impersonate its GSA. Grant the KSA's principal roles/iam.workloadIdentityUser on the GSA (see the %s check) and look for deny policies that block getAccessToken.", checkIamWorkloadIdentityUser)},
+		{logTokenExchange, statusFail, "token exchange failures",
+			fmt.Sprintf("The Security Token Service didn't accept the KSA's token. Check that Workload Identity is enabled on the cluster and that its workload pool exists (see the %s check).", checkClusterWorkloadIdentity)},
+		{logUnknownPod, statusWarn, "requests from a pod the metadata server didn't know",
+			"The metadata server couldn't match the request to a pod. This happens when a pod asks for credentials right after it starts; retry token requests at startup or wait for the metadata server in an init container."},
+	} {
+		if counts[c.class] == 0 {
+			continue
+		}
+		result.Evidence[string(c.class)] = fmt.Sprint(counts[c.class])
+		found = append(found, fmt.Sprintf("%d %s", counts[c.class], c.what))
+		fixes = append(fixes, c.fix)
+		if statusRank(c.status) > statusRank(result.Status) {
+			result.Status = c.status
+		}
+	}
+
+	switch {
+	case len(found) > 0:
+		result.Message = fmt.Sprintf("%d log lines mention the workload's pods or KSA, including %s.", matched, strings.Join(found, ", "))
+		result.Remediation = strings.Join(fixes, "\n")
+	case matched > 0:
+		result.Status = statusPass
+		result.Message = fmt.Sprintf("%d log lines mention the workload's pods or KSA; none of them is a known error.", matched)
+	default:
+		result.Status = statusPass
+		result.Message = "No log lines mention the workload's pods or KSA."
+	}
+	if failed > 0 {
+		result.Message += fmt.Sprintf(" The logs for %d of %d pods could not be read.", failed, len(pods))
+	}
+	return result, collected
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckMetadataServers(t *testing.T) {
+	ctx := context.Background()
+	server := func(name, node string, ready bool, status corev1.ContainerStatus) *corev1.Pod {
+		condition := corev1.ConditionFalse
+		if ready {
+			condition = corev1.ConditionTrue
+		}
+		status.Name = "gke-metadata-server"
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metadataServerNamespace, Labels: map[string]string{"k8s-app": "gke-metadata-server"}},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: condition}},
+				ContainerStatuses: []corev1.ContainerStatus{status},
+			},
+		}
+	}
+	frontend := workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}
+	deployment := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "frontend-1", Namespace: "web", OwnerReferences: controlledBy("Deployment", "frontend")}}
+	pods := func(nodes ...string) []*corev1.Pod {
+		var pods []*corev1.Pod
+		for _, node := range nodes {
+			pods = append(pods, scheduledPod("frontend-"+node, node, controlledBy("ReplicaSet", "frontend-1")))
+		}
+		return pods
+	}
+	objects := func(pods []*corev1.Pod, servers ...*corev1.Pod) *fake.Clientset {
+		clientset := fake.NewSimpleClientset(deployment)
+		for _, p := range append(pods, servers...) {
+			assert.NoError(t, clientset.Tracker().Add(p))
+		}
+		return clientset
+	}
+
+	// Healthy on every node.
+	result := checkMetadataServers(ctx, objects(pods("node-1", "node-2"),
+		server("gke-metadata-server-a", "node-1", true, corev1.ContainerStatus{}),
+		server("gke-metadata-server-b", "node-2", true, corev1.ContainerStatus{}),
+		server("gke-metadata-server-c", "node-3", false, corev1.ContainerStatus{}),
+	), frontend)
+	assert.Equal(t, statusPass, result.Status)
+	assert.Equal(t, "A ready gke-metadata-server pod runs on each of the 2 nodes running the workload's pods.", result.Message)
+	assert.Equal(t, map[string]string{"node-1": "ready", "node-2": "ready"}, result.Evidence)
+
+	// Restarted after an OOMKill, crash looping, and missing.
+	oom := corev1.ContainerStatus{RestartCount: 2, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}}}
+	crash := corev1.ContainerStatus{RestartCount: 7, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+	result = checkMetadataServers(ctx, objects(pods("node-1", "node-2", "node-3"),
+		server("gke-metadata-server-a", "node-1", true, oom),
+		server("gke-metadata-server-b", "node-2", false, crash),
+	), frontend)
+	assert.Equal(t, statusFail, result.Status)
+	assert.Equal(t, map[string]string{"node-1": "ready, 2 restarts, OOMKilled", "node-2": "CrashLoopBackOff", "node-3": "missing"}, result.Evidence)
+	assert.Equal(t, "gke-metadata-server pod 'gke-metadata-server-a' on node 'node-1' was last terminated because it ran out of memory (OOMKilled) and has restarted 2 times. "+
+		"gke-metadata-server pod 'gke-metadata-server-b' on node 'node-2' is in CrashLoopBackOff and has restarted 7 times. "+
+		"No gke-metadata-server pod runs on node 'node-3', so pods on it can't get Workload Identity credentials.", result.Message)
+	assert.Contains(t, result.Remediation, "GKE_METADATA")
+
+	// Restarts alone are a warning.
+	result = checkMetadataServers(ctx, objects(pods("node-1"),
+		server("gke-metadata-server-a", "node-1", true, corev1.ContainerStatus{RestartCount: 1}),
+	), frontend)
+	assert.Equal(t, statusWarn, result.Status)
+	assert.NotContains(t, result.Remediation, "GKE_METADATA")
+
+	result = checkMetadataServers(ctx, objects(nil), frontend)
+	assert.Equal(t, statusSkip, result.Status)
+}
+
+func TestClassifyLogLine(t *testing.T) {
+	tests := map[string]logErrorClass{
+		`[conn-id:1 ip:10.8.0.12 pod:web/frontend-a] "/computeMetadata/v1/instance/service-accounts/default/token" HTTP/403: generic::permission_denied: loading: GenerateAccessToken("app@test-project.iam.gserviceaccount.com", ""): googleapi: Error 403: Permission 'iam.serviceAccounts.getAccessToken' denied on resource (or it may not exist).`: logAccessTokenDenied,
+		`[conn-id:2 ip:10.8.0.12] Unable to find pod: generic::not_found: retry budget exhausted (10 attempts): ip "10.8.0.12" not recorded in table`:                                                                                                                                                                                                   logUnknownPod,
+		`[conn-id:3 pod:web/frontend-a] failed to exchange token with https://sts.googleapis.com/v1/token: {"error":"invalid_grant"}`:                                                                                                                                                                                                                   logTokenExchange,
+		`[conn-id:4 ip:10.8.0.12 pod:web/frontend-a] "/computeMetadata/v1/instance/service-accounts/default/email" HTTP/200`:                                                                                                                                                                                                                            "",
+	}
+	for line, class := range tests {
+		assert.Equal(t, class, classifyLogLine(line), line)
+	}
+}
+
+func TestCollectMetadataServerLogs(t *testing.T) {
+	ctx := context.Background()
+	defer func(orig func(context.Context, kubernetes.Interface, string, string, *corev1.PodLogOptions) (string, error)) {
+		podLogs = orig
+	}(podLogs)
+
+	frontendA := scheduledPod("frontend-a", "node-1", controlledBy("ReplicaSet", "frontend-1"))
+	frontendA.Spec.ServiceAccountName = "app"
+	frontendA.Status.PodIP = "10.8.0.12"
+	frontendB := scheduledPod("frontend-b", "node-2", controlledBy("ReplicaSet", "frontend-1"))
+	frontendB.Spec.ServiceAccountName = "app"
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "frontend-1", Namespace: "web", OwnerReferences: controlledBy("Deployment", "frontend")}},
+		frontendA,
+		frontendB,
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "gke-metadata-server-a", Namespace: metadataServerNamespace, Labels: map[string]string{"k8s-app": "gke-metadata-server"}},
+			Spec:       corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Name: "gke-metadata-server"}, {Name: "prometheus-to-sd"}}},
+		},
+	)
+
+	lines := []string{
+		`I1016 10:00:00.000000 1 server.go:1] [conn-id:1 ip:10.8.0.12 pod:web/frontend-a] "/computeMetadata/v1/instance/service-accounts/default/email" HTTP/200`,
+		`I1016 10:00:01.000000 1 server.go:1] [conn-id:2 ip:10.8.0.12 pod:web/frontend-a] "/computeMetadata/v1/instance/service-accounts/default/token" HTTP/403: generic::permission_denied: loading: GenerateAccessToken("app@test-project.iam.gserviceaccount.com", ""): googleapi: Error 403: Permission 'iam.serviceAccounts.getAccessToken' denied`,
+		`E1016 10:00:02.000000 1 server.go:1] [conn-id:3 ip:10.8.0.12] Unable to find pod: generic::not_found: ip "10.8.0.12" not recorded in table`,
+		`E1016 10:00:03.000000 1 server.go:1] [conn-id:4 ip:10.8.0.120 pod:web/frontend-abc] Unable to find pod`,
+		`E1016 10:00:04.000000 1 server.go:1] [conn-id:5 pod:web/worker] KSA web/app: failed to exchange token with sts.googleapis.com: invalid_grant`,
+		`E1016 10:00:05.000000 1 server.go:1] [conn-id:6 pod:web/worker] KSA web/app-2: failed to exchange token with sts.googleapis.com: invalid_grant`,
+	}
+	var reads []*corev1.PodLogOptions
+	podLogs = func(ctx context.Context, clientset kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (string, error) {
+		assert.Equal(t, "gke-metadata-server-a", pod)
+		reads = append(reads, opts)
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+
+	result, logs := collectMetadataServerLogs(ctx, clientset, workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}, time.Hour)
+	assert.Equal(t, statusFail, result.Status)
+	assert.Equal(t, map[string]string{"matchedLines": "4", "generate-access-token-denied": "1", "token-exchange": "1", "unknown-pod": "1"}, result.Evidence)
+	assert.Equal(t, "4 log lines mention the workload's pods or KSA, including 1 permission denied on generateAccessToken, 1 token exchange failures, 1 requests from a pod the metadata server didn't know. The logs for 1 of 2 pods could not be read.", result.Message)
+	assert.Contains(t, result.Remediation, "roles/iam.workloadIdentityUser")
+
+	if assert.Len(t, reads, 1) {
+		assert.Equal(t, int64(3600), *reads[0].SinceSeconds)
+		assert.Equal(t, "gke-metadata-server", reads[0].Container)
+	}
+	assert.Equal(t, []metadataServerLogs{
+		{Pod: "frontend-a", Node: "node-1", ServerPod: "gke-metadata-server-a", Lines: []metadataServerLogLine{
+			{Line: lines[0]},
+			{Class: logAccessTokenDenied, Line: lines[1]},
+			{Class: logUnknownPod, Line: lines[2]},
+			{Class: logTokenExchange, Line: lines[4]},
+		}},
+		{Pod: "frontend-b", Node: "node-2", Error: "no gke-metadata-server pod runs on node 'node-2'"},
+	}, logs)
+
+	report := newKsaReport("test-cluster", "us-central1", "web", "app")
+	report.MetadataServerLogs = logs
+	report.add(result)
+	var buf bytes.Buffer
+	report.renderText(&buf)
+	assert.Contains(t, buf.String(), "📜 gke-metadata-server logs about pod 'frontend-a' on node 'node-1' (from 'gke-metadata-server-a'):\n   "+lines[0]+"\n   [generate-access-token-denied] "+lines[1]+"\n")
+	assert.Contains(t, buf.String(), "   ⚠️  no gke-metadata-server pod runs on node 'node-2'\n")
+
+	// Only known-harmless lines.
+	lines = lines[:1]
+	result, _ = collectMetadataServerLogs(ctx, clientset, workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}, time.Hour)
+	assert.Equal(t, statusPass, result.Status)
+	assert.Equal(t, "1 log lines mention the workload's pods or KSA; none of them is a known error. The logs for 1 of 2 pods could not be read.", result.Message)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceCmd represents the namespace command
+var namespaceCmd = &cobra.Command{
+	Use:   "namespace <namespace>",
+	Short: "Checks the Workload Identity configuration for every KSA and workload in a namespace.",
+	Long: `Scans a Kubernetes namespace and verifies the Workload Identity setup of everything in it.
+
+It lists all Kubernetes Service Accounts and all pod-owning workloads (Deployments, StatefulSets,
+DaemonSets, Jobs and CronJobs) in the namespace, resolves the KSA each workload runs as, and then
+runs the KSA checks once for every unique KSA.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace := args[0]
+		ctx := context.Background()
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		clientset, err := getK8sClientset(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		report, err := performNamespaceCheck(ctx, clients, namespace, cluster, clientset)
+		if err != nil {
+			log.Fatalf("❌ Failed to scan namespace '%s': %v", namespace, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ One or more KSAs in namespace '%s' failed their checks.", namespace)
+		}
+	},
+}
+
+// namespaceWorkload is a workload found in the namespace together with the KSA it runs as.
+type namespaceWorkload struct {
+	workloadRef
+	KSA string `json:"ksa"`
+}
+
+// namespaceReport aggregates the KSA reports for a whole namespace.
+type namespaceReport struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Status     checkStatus         `json:"status"`
+	Cluster    clusterInfo         `json:"cluster"`
+	Namespace  string              `json:"namespace"`
+	Error      string              `json:"error,omitempty"`
+	Workloads  []namespaceWorkload `json:"workloads"`
+	KSAReports []*ksaReport        `json:"ksaReports"`
+}
+
+// listWorkloads returns every pod-owning workload in the namespace along with its KSA.
+// Jobs created by a CronJob are skipped since the CronJob itself is listed.
+func listWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]namespaceWorkload, error) {
+	var workloads []namespaceWorkload
+	add := func(kind, name string, spec corev1.PodSpec) {
+		workloads = append(workloads, namespaceWorkload{
+			workloadRef: workloadRef{Kind: kind, Namespace: namespace, Name: name},
+			KSA:         ksaFromPodSpec(spec),
+		})
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace '%s': %w", namespace, err)
+	}
+	for _, d := range deployments.Items {
+		add("deployment", d.Name, d.Spec.Template.Spec)
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace '%s': %w", namespace, err)
+	}
+	for _, s := range statefulSets.Items {
+		add("statefulset", s.Name, s.Spec.Template.Spec)
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets in namespace '%s': %w", namespace, err)
+	}
+	for _, d := range daemonSets.Items {
+		add("daemonset", d.Name, d.Spec.Template.Spec)
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs in namespace '%s': %w", namespace, err)
+	}
+	for _, j := range jobs.Items {
+		if owner := metav1.GetControllerOf(&j); owner != nil && owner.Kind == "CronJob" {
+			continue
+		}
+		add("job", j.Name, j.Spec.Template.Spec)
+	}
+
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs in namespace '%s': %w", namespace, err)
+	}
+	for _, c := range cronJobs.Items {
+		add("cronjob", c.Name, c.Spec.JobTemplate.Spec.Template.Spec)
+	}
+
+	return workloads, nil
+}
+
+// newNamespaceReport returns an empty report for namespace on cluster.
+func newNamespaceReport(namespace string, cluster *containerpb.Cluster) *namespaceReport {
+	report := &namespaceReport{
+		APIVersion: reportAPIVersion,
+		Kind:       "NamespaceReport",
+		Status:     statusPass,
+		Cluster:    clusterInfo{Project: projectID, Location: cluster.Location, Name: cluster.Name},
+		Namespace:  namespace,
+		Workloads:  []namespaceWorkload{},
+		KSAReports: []*ksaReport{},
+	}
+	if cluster.WorkloadIdentityConfig != nil {
+		report.Cluster.WorkloadPool = cluster.WorkloadIdentityConfig.WorkloadPool
+	}
+	return report
+}
+
+// addKsaReport appends a KSA report and folds its status into the namespace status.
+func (r *namespaceReport) addKsaReport(ksa *ksaReport) {
+	r.KSAReports = append(r.KSAReports, ksa)
+	if statusRank(ksa.Status) > statusRank(r.Status) {
+		r.Status = ksa.Status
+	}
+}
+
+// discoverNamespace lists the workloads in a namespace and returns them together with the
+// sorted, de-duplicated set of KSAs that either exist there or are referenced by a workload.
+func discoverNamespace(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]namespaceWorkload, []string, error) {
+	serviceAccounts, err := clientset.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list service accounts in namespace '%s': %w", namespace, err)
+	}
+	workloads, err := listWorkloads(ctx, clientset, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ksaNames := map[string]bool{}
+	for _, sa := range serviceAccounts.Items {
+		ksaNames[sa.Name] = true
+	}
+	for _, w := range workloads {
+		ksaNames[w.KSA] = true
+	}
+	sorted := make([]string, 0, len(ksaNames))
+	for name := range ksaNames {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	return workloads, sorted, nil
+}
+
+// performNamespaceCheck runs the KSA checks once for every KSA that exists in the namespace
+// or is referenced by one of its workloads. Check failures are recorded in the per-KSA reports;
+// the returned error is only set when the namespace itself could not be listed.
+func performNamespaceCheck(ctx context.Context, clients *gcpClients, namespace string, cluster *containerpb.Cluster, clientset kubernetes.Interface) (*namespaceReport, error) {
+	report := newNamespaceReport(namespace, cluster)
+
+	workloads, ksaNames, err := discoverNamespace(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	report.Workloads = append(report.Workloads, workloads...)
+
+	for _, ksaName := range ksaNames {
+		// The error is already captured as a failed check inside the KSA report.
+		ksa, _ := performKsaCheck(ctx, clients, namespace, ksaName, cluster, clientset)
+		report.addKsaReport(ksa)
+	}
+	return report, nil
+}
+
+// renderText writes the human readable form of a namespace report.
+func (r *namespaceReport) renderText(w io.Writer) {
+	fmt.Fprintf(w, "🔎 Scanning namespace '%s' in cluster '%s'\n", r.Namespace, r.Cluster.Name)
+	fmt.Fprintf(w, "   Found %d workload(s) and %d unique KSA(s).\n", len(r.Workloads), len(r.KSAReports))
+	for _, wl := range r.Workloads {
+		fmt.Fprintf(w, "   - %s/%s → KSA '%s'\n", wl.Kind, wl.Name, wl.KSA)
+	}
+	fmt.Fprintln(w)
+
+	for _, ksa := range r.KSAReports {
+		ksa.renderText(w)
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "📋 Summary for namespace '%s':\n", r.Namespace)
+	for _, ksa := range r.KSAReports {
+		fmt.Fprintf(w, "   %s %s\n", statusIcon(ksa.Status), ksa.KSA.Name)
+	}
+}
+
+func init() {
+	checkCmd.AddCommand(namespaceCmd)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPerformNamespaceCheck(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	namespace := "team-a"
+
+	isController := true
+	clientset := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: namespace}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{ServiceAccountName: "web"}}},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: namespace},
+			Spec:       appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{ServiceAccountName: "missing-ksa"}}},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: namespace},
+			Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{ServiceAccountName: "web"}},
+			}}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "nightly-123",
+				Namespace:       namespace,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: "nightly", Controller: &isController}},
+			},
+		},
+	)
+
+	// Without Workload Identity every KSA check stops at the cluster step, which keeps
+	// this test away from the GCP APIs.
+	cluster := &containerpb.Cluster{Name: "test-cluster", Location: "us-central1"}
+
+	report, err := performNamespaceCheck(ctx, nil, namespace, cluster, clientset)
+	assert.NoError(t, err)
+	assert.Equal(t, "NamespaceReport", report.Kind)
+	assert.Len(t, report.Workloads, 3)
+
+	var ksaNames []string
+	for _, r := range report.KSAReports {
+		ksaNames = append(ksaNames, r.KSA.Name)
+	}
+	assert.Equal(t, []string{"default", "missing-ksa", "web"}, ksaNames)
+	assert.Equal(t, statusFail, report.Status)
+}
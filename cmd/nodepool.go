@@ -0,0 +1,256 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	checkNodePoolMetadataServer = "nodepool.gke-metadata"
+	docNodePoolMetadata         = "https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity#option_2_node_pool_modification"
+)
+
+// nodePoolLabels returns the node labels Kubernetes sees on nodes of a pool: the user-defined
+// labels plus the well-known ones GKE adds itself.
+func nodePoolLabels(pool *containerpb.NodePool) map[string]string {
+	labels := map[string]string{
+		"cloud.google.com/gke-nodepool": pool.Name,
+	}
+	config := pool.GetConfig()
+	for k, v := range config.GetLabels() {
+		labels[k] = v
+	}
+	if config.GetMachineType() != "" {
+		labels[corev1.LabelInstanceTypeStable] = config.GetMachineType()
+	}
+	if config.GetSpot() {
+		labels["cloud.google.com/gke-spot"] = "true"
+	}
+	if config.GetPreemptible() {
+		labels["cloud.google.com/gke-preemptible"] = "true"
+	}
+	if nodePoolMetadataMode(pool) == containerpb.WorkloadMetadataConfig_GKE_METADATA {
+		labels["iam.gke.io/gke-metadata-server-enabled"] = "true"
+	}
+	return labels
+}
+
+// nodePoolTaints converts the GKE taints on a pool into their Kubernetes form.
+func nodePoolTaints(pool *containerpb.NodePool) []corev1.Taint {
+	var taints []corev1.Taint
+	for _, t := range pool.GetConfig().GetTaints() {
+		taint := corev1.Taint{Key: t.Key, Value: t.Value}
+		switch t.Effect {
+		case containerpb.NodeTaint_NO_SCHEDULE:
+			taint.Effect = corev1.TaintEffectNoSchedule
+		case containerpb.NodeTaint_PREFER_NO_SCHEDULE:
+			taint.Effect = corev1.TaintEffectPreferNoSchedule
+		case containerpb.NodeTaint_NO_EXECUTE:
+			taint.Effect = corev1.TaintEffectNoExecute
+		default:
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	return taints
+}
+
+func nodePoolMetadataMode(pool *containerpb.NodePool) containerpb.WorkloadMetadataConfig_Mode {
+	return pool.GetConfig().GetWorkloadMetadataConfig().GetMode()
+}
+
+// matchNodeSelectorRequirement evaluates a single node affinity expression against node labels.
+func matchNodeSelectorRequirement(req corev1.NodeSelectorRequirement, labels map[string]string) bool {
+	value, exists := labels[req.Key]
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		if !exists {
+			return false
+		}
+		for _, v := range req.Values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	case corev1.NodeSelectorOpNotIn:
+		for _, v := range req.Values {
+			if exists && v == value {
+				return false
+			}
+		}
+		return true
+	case corev1.NodeSelectorOpExists:
+		return exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !exists
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if !exists || len(req.Values) != 1 {
+			return false
+		}
+		have, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		want, err := strconv.ParseInt(req.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if req.Operator == corev1.NodeSelectorOpGt {
+			return have > want
+		}
+		return have < want
+	default:
+		return false
+	}
+}
+
+// podFitsNodePool reports whether a pod with this spec could be scheduled onto a node of the pool,
+// considering its nodeSelector, required node affinity and tolerations. Resource requests and
+// preferred affinities are ignored since they don't rule a pool out. matchFields only select nodes
+// by name, which a pool doesn't determine, so they're assumed to match.
+func podFitsNodePool(spec *corev1.PodSpec, pool *containerpb.NodePool) bool {
+	labels := nodePoolLabels(pool)
+
+	for k, v := range spec.NodeSelector {
+		if labels[k] != v {
+			return false
+		}
+	}
+
+	if affinity := spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			// Terms are ORed; the expressions inside a term are ANDed.
+			matched := false
+			for _, term := range required.NodeSelectorTerms {
+				termMatches := len(term.MatchExpressions) > 0 || len(term.MatchFields) > 0
+				for _, expr := range term.MatchExpressions {
+					if !matchNodeSelectorRequirement(expr, labels) {
+						termMatches = false
+						break
+					}
+				}
+				if termMatches {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+
+	for _, taint := range nodePoolTaints(pool) {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// usesMatchFields reports whether the spec's required node affinity selects nodes with matchFields.
+func usesMatchFields(spec *corev1.PodSpec) bool {
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil || spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+	for _, term := range spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if len(term.MatchFields) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNodePoolMetadata verifies that every node pool the pod could land on runs the GKE metadata
+// server. Pods scheduled on a GCE_METADATA pool get the node's service account instead of the
+// KSA's identity.
+func checkNodePoolMetadata(cluster *containerpb.Cluster, spec *corev1.PodSpec) checkResult {
+	result := checkResult{
+		ID:       checkNodePoolMetadataServer,
+		Title:    "Checking node pools the workload can be scheduled on for GKE_METADATA mode",
+		Severity: severityHigh,
+		DocLink:  docNodePoolMetadata,
+	}
+
+	if cluster.GetAutopilot().GetEnabled() {
+		result.Status = statusPass
+		result.Message = "Autopilot cluster: every node runs the GKE metadata server."
+		return result
+	}
+
+	var eligible, gkeMetadata, other []string
+	for _, pool := range cluster.NodePools {
+		if !podFitsNodePool(spec, pool) {
+			continue
+		}
+		eligible = append(eligible, pool.Name)
+		if nodePoolMetadataMode(pool) == containerpb.WorkloadMetadataConfig_GKE_METADATA {
+			gkeMetadata = append(gkeMetadata, pool.Name)
+		} else {
+			other = append(other, pool.Name)
+		}
+	}
+
+	result.Evidence = map[string]string{
+		"eligibleNodePools": strings.Join(eligible, ", "),
+	}
+	if usesMatchFields(spec) {
+		result.Evidence["matchFields"] = "The workload's required node affinity uses matchFields, which select nodes by name; they were assumed to match every node pool."
+	}
+	if len(eligible) == 0 {
+		result.Status = statusWarn
+		result.Severity = severityMedium
+		result.Message = "No node pool matches the workload's nodeSelector, node affinity and tolerations. Pods may stay Pending, or land on pools created by node auto-provisioning."
+		return result
+	}
+	if len(other) == 0 {
+		result.Status = statusPass
+		result.Message = fmt.Sprintf("All %d node pool(s) the workload can be scheduled on run in GKE_METADATA mode.", len(eligible))
+		return result
+	}
+
+	result.Evidence["nonGkeMetadataNodePools"] = strings.Join(other, ", ")
+	var fixes []string
+	for _, name := range other {
+		fixes = append(fixes, fmt.Sprintf("gcloud container node-pools update %s \\\n  --cluster=%s \\\n  --location=%s \\\n  --workload-metadata=GKE_METADATA", name, cluster.Name, cluster.Location))
+	}
+	result.Remediation = strings.Join(fixes, "\n")
+	if len(gkeMetadata) == 0 {
+		result.Status = statusFail
+		result.Message = fmt.Sprintf("The workload can only be scheduled on node pools without GKE_METADATA (%s). Its pods will receive the node's service account instead of the KSA's identity.", strings.Join(other, ", "))
+		return result
+	}
+	result.Status = statusWarn
+	result.Message = fmt.Sprintf("The workload can be scheduled on node pools without GKE_METADATA (%s). Pods landing there will receive the node's service account instead of the KSA's identity; pin the workload to GKE_METADATA pools or update those pools.", strings.Join(other, ", "))
+	return result
+}
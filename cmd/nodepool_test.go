@@ -0,0 +1,141 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newTestNodePool(name string, mode containerpb.WorkloadMetadataConfig_Mode, labels map[string]string, taints ...*containerpb.NodeTaint) *containerpb.NodePool {
+	return &containerpb.NodePool{
+		Name: name,
+		Config: &containerpb.NodeConfig{
+			Labels:                 labels,
+			Taints:                 taints,
+			WorkloadMetadataConfig: &containerpb.WorkloadMetadataConfig{Mode: mode},
+		},
+	}
+}
+
+// matchFieldsAffinity returns a required node affinity that pins pods to a node by name.
+func matchFieldsAffinity(node string) *corev1.Affinity {
+	return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+			{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{node}}}},
+		}},
+	}}
+}
+
+func TestPodFitsNodePool(t *testing.T) {
+	gpuPool := newTestNodePool("gpu", containerpb.WorkloadMetadataConfig_GKE_METADATA, map[string]string{"accelerator": "a100"},
+		&containerpb.NodeTaint{Key: "nvidia.com/gpu", Value: "present", Effect: containerpb.NodeTaint_NO_SCHEDULE})
+
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want bool
+	}{
+		{"untolerated taint", corev1.PodSpec{}, false},
+		{"tolerated taint", corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}}}, true},
+		{"node selector mismatch", corev1.PodSpec{
+			NodeSelector: map[string]string{"cloud.google.com/gke-nodepool": "default-pool"},
+			Tolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		}, false},
+		{"required affinity match", corev1.PodSpec{
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "accelerator", Operator: corev1.NodeSelectorOpIn, Values: []string{"a100", "h100"}}}},
+				}},
+			}},
+		}, true},
+		{"required affinity mismatch", corev1.PodSpec{
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "accelerator", Operator: corev1.NodeSelectorOpDoesNotExist}}},
+				}},
+			}},
+		}, false},
+		{"required affinity on matchFields only", corev1.PodSpec{
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Affinity:    matchFieldsAffinity("gke-node-1"),
+		}, true},
+		{"required affinity on matchFields and mismatched expression", corev1.PodSpec{
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "accelerator", Operator: corev1.NodeSelectorOpDoesNotExist}},
+					MatchFields:      []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"gke-node-1"}}},
+				}}},
+			}},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, podFitsNodePool(&tt.spec, gpuPool))
+		})
+	}
+}
+
+func TestCheckNodePoolMetadata(t *testing.T) {
+	cluster := &containerpb.Cluster{
+		Name:     "test-cluster",
+		Location: "us-central1",
+		NodePools: []*containerpb.NodePool{
+			newTestNodePool("default-pool", containerpb.WorkloadMetadataConfig_GKE_METADATA, nil),
+			newTestNodePool("legacy-pool", containerpb.WorkloadMetadataConfig_GCE_METADATA, map[string]string{"legacy": "true"}),
+		},
+	}
+
+	t.Run("Mixed pools", func(t *testing.T) {
+		result := checkNodePoolMetadata(cluster, &corev1.PodSpec{})
+		assert.Equal(t, statusWarn, result.Status)
+		assert.Equal(t, "legacy-pool", result.Evidence["nonGkeMetadataNodePools"])
+		assert.Contains(t, result.Remediation, "gcloud container node-pools update legacy-pool")
+	})
+
+	t.Run("Pinned to GKE_METADATA", func(t *testing.T) {
+		spec := &corev1.PodSpec{NodeSelector: map[string]string{"iam.gke.io/gke-metadata-server-enabled": "true"}}
+		result := checkNodePoolMetadata(cluster, spec)
+		assert.Equal(t, statusPass, result.Status)
+	})
+
+	t.Run("Pinned to GCE_METADATA", func(t *testing.T) {
+		spec := &corev1.PodSpec{NodeSelector: map[string]string{"legacy": "true"}}
+		result := checkNodePoolMetadata(cluster, spec)
+		assert.Equal(t, statusFail, result.Status)
+	})
+
+	t.Run("Pinned by matchFields", func(t *testing.T) {
+		result := checkNodePoolMetadata(cluster, &corev1.PodSpec{Affinity: matchFieldsAffinity("gke-node-1")})
+		assert.Equal(t, statusWarn, result.Status)
+		assert.Equal(t, "default-pool, legacy-pool", result.Evidence["eligibleNodePools"])
+		assert.Contains(t, result.Evidence["matchFields"], "assumed to match")
+	})
+
+	t.Run("Autopilot", func(t *testing.T) {
+		autopilot := &containerpb.Cluster{Autopilot: &containerpb.Autopilot{Enabled: true}}
+		result := checkNodePoolMetadata(autopilot, &corev1.PodSpec{})
+		assert.Equal(t, statusPass, result.Status)
+	})
+}
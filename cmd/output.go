@@ -0,0 +1,72 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+var outputFormat string
+
+// textRenderer is implemented by every report that can be printed for humans.
+type textRenderer interface {
+	renderText(w io.Writer)
+}
+
+// validateOutputFormat rejects unknown --output values before any API call is made.
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format '%s' (expected one of: text, json, yaml)", format)
+	}
+}
+
+// writeOutput renders report to w in the requested format.
+func writeOutput(w io.Writer, format string, report textRenderer) error {
+	switch format {
+	case outputJSON:
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report as JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case outputYAML:
+		out, err := yaml.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("failed to encode report as YAML: %w", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case outputText, "":
+		report.renderText(w)
+		return nil
+	default:
+		return validateOutputFormat(format)
+	}
+}
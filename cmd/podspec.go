@@ -0,0 +1,88 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	checkPodHostNetwork = "pod.host-network"
+	docHostNetwork      = "https://cloud.google.com/kubernetes-engine/docs/concepts/workload-identity#limitations"
+)
+
+// analyzePodSpec runs the checks that only need a workload's pod template.
+func analyzePodSpec(cluster *containerpb.Cluster, spec *corev1.PodSpec) []checkResult {
+	return []checkResult{
+		checkNodePoolMetadata(cluster, spec),
+		checkHostNetwork(cluster, spec),
+	}
+}
+
+// nodePoolServiceAccount returns the GSA the nodes of a pool run as.
+func nodePoolServiceAccount(pool *containerpb.NodePool) string {
+	sa := pool.GetConfig().GetServiceAccount()
+	if sa == "" || sa == "default" {
+		return "Compute Engine default service account"
+	}
+	return sa
+}
+
+// checkHostNetwork flags pods that use the node's network namespace. Their requests to
+// metadata.google.internal bypass the GKE metadata server's interception, so they are answered
+// by the node's metadata server and receive the node's service account instead of the KSA's identity.
+func checkHostNetwork(cluster *containerpb.Cluster, spec *corev1.PodSpec) checkResult {
+	result := checkResult{
+		ID:       checkPodHostNetwork,
+		Title:    "Checking whether the pod template uses hostNetwork",
+		Severity: severityHigh,
+		DocLink:  docHostNetwork,
+	}
+
+	if !spec.HostNetwork {
+		result.Status = statusPass
+		result.Message = "The pod does not use hostNetwork, so its metadata requests are served by the GKE metadata server."
+		return result
+	}
+
+	seen := map[string]bool{}
+	for _, pool := range cluster.NodePools {
+		if podFitsNodePool(spec, pool) {
+			seen[nodePoolServiceAccount(pool)] = true
+		}
+	}
+	var nodeSAs []string
+	for sa := range seen {
+		nodeSAs = append(nodeSAs, sa)
+	}
+	sort.Strings(nodeSAs)
+
+	effective := "the node's service account"
+	if len(nodeSAs) > 0 {
+		effective = fmt.Sprintf("the node's service account (%s)", strings.Join(nodeSAs, ", "))
+		result.Evidence = map[string]string{"nodeServiceAccounts": strings.Join(nodeSAs, ", ")}
+	}
+
+	result.Status = statusFail
+	result.Message = fmt.Sprintf("The pod runs with hostNetwork: true. Workload Identity does not apply to host network pods: calls to the metadata server reach the node directly and the pod authenticates as %s instead of the KSA's identity.", effective)
+	result.Remediation = "Remove 'hostNetwork: true' from the pod spec. If the workload genuinely needs the host network, it cannot use Workload Identity; grant the required roles to the node service account or use a dedicated node pool with a narrowly scoped service account."
+	return result
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCheckHostNetwork(t *testing.T) {
+	pool := newTestNodePool("default-pool", containerpb.WorkloadMetadataConfig_GKE_METADATA, nil)
+	pool.Config.ServiceAccount = "nodes@test-project.iam.gserviceaccount.com"
+	cluster := &containerpb.Cluster{NodePools: []*containerpb.NodePool{pool}}
+
+	result := checkHostNetwork(cluster, &corev1.PodSpec{})
+	assert.Equal(t, statusPass, result.Status)
+
+	result = checkHostNetwork(cluster, &corev1.PodSpec{HostNetwork: true})
+	assert.Equal(t, statusFail, result.Status)
+	assert.Contains(t, result.Message, "nodes@test-project.iam.gserviceaccount.com")
+	assert.Equal(t, docHostNetwork, result.DocLink)
+}
+
+func TestAnalyzePodSpec(t *testing.T) {
+	dedicated := newTestNodePool("dedicated-pool", containerpb.WorkloadMetadataConfig_GKE_METADATA, map[string]string{"team": "web"})
+	dedicated.Config.ServiceAccount = "nodes@test-project.iam.gserviceaccount.com"
+	cluster := &containerpb.Cluster{NodePools: []*containerpb.NodePool{
+		newTestNodePool("default-pool", containerpb.WorkloadMetadataConfig_GKE_METADATA, nil),
+		dedicated,
+	}}
+
+	t.Run("Host network on any pool", func(t *testing.T) {
+		results := analyzePodSpec(cluster, &corev1.PodSpec{HostNetwork: true})
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, checkNodePoolMetadataServer, results[0].ID)
+			assert.Equal(t, statusPass, results[0].Status)
+			assert.Equal(t, checkPodHostNetwork, results[1].ID)
+			assert.Equal(t, statusFail, results[1].Status)
+			assert.Equal(t, map[string]string{"nodeServiceAccounts": "Compute Engine default service account, nodes@test-project.iam.gserviceaccount.com"}, results[1].Evidence)
+			assert.Contains(t, results[1].Message, "the pod authenticates as the node's service account (Compute Engine default service account, nodes@test-project.iam.gserviceaccount.com) instead of the KSA's identity")
+		}
+	})
+
+	t.Run("Host network pinned to a pool", func(t *testing.T) {
+		results := analyzePodSpec(cluster, &corev1.PodSpec{HostNetwork: true, NodeSelector: map[string]string{"team": "web"}})
+		result := results[len(results)-1]
+		assert.Equal(t, map[string]string{"nodeServiceAccounts": "nodes@test-project.iam.gserviceaccount.com"}, result.Evidence)
+		assert.Contains(t, result.Message, "the pod authenticates as the node's service account (nodes@test-project.iam.gserviceaccount.com) instead of the KSA's identity")
+	})
+
+	t.Run("No matching pool", func(t *testing.T) {
+		results := analyzePodSpec(cluster, &corev1.PodSpec{HostNetwork: true, NodeSelector: map[string]string{"team": "batch"}})
+		result := results[len(results)-1]
+		assert.Equal(t, statusFail, result.Status)
+		assert.Nil(t, result.Evidence)
+		assert.Contains(t, result.Message, "the pod authenticates as the node's service account instead of the KSA's identity")
+	})
+}
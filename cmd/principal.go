@@ -0,0 +1,223 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The identifiers below are derived from the cluster's workload pool rather than from --project:
+// clusters registered to a fleet in another host project use that host's pool.
+
+// ksaServiceAccountMember returns the legacy IAM member for a KSA,
+// e.g. serviceAccount:PROJECT_ID.svc.id.goog[NAMESPACE/KSA].
+func ksaServiceAccountMember(workloadPool, namespace, ksa string) string {
+	return fmt.Sprintf("serviceAccount:%s[%s/%s]", workloadPool, namespace, ksa)
+}
+
+// ksaPrincipal returns the principal:// identifier of a KSA, used to grant it roles directly.
+func ksaPrincipal(projectNumber, workloadPool, namespace, ksa string) string {
+	return fmt.Sprintf("%sprojects/%s/locations/global/workloadIdentityPools/%s/subject/ns/%s/sa/%s", principalPrefix, projectNumber, workloadPool, namespace, ksa)
+}
+
+// workloadPoolProject returns the ID of the project that hosts a GKE workload pool (PROJECT_ID.svc.id.goog).
+func workloadPoolProject(workloadPool string) string {
+	return strings.TrimSuffix(workloadPool, ".svc.id.goog")
+}
+
+// principalScope is the set of KSAs a Workload Identity principal identifier stands for.
+type principalScope int
+
+const (
+	// scopeKSA is a single Kubernetes Service Account.
+	scopeKSA principalScope = iota
+	// scopeNamespace is every KSA in a namespace, across all clusters sharing the pool.
+	scopeNamespace
+	// scopeCluster is every KSA in one cluster.
+	scopeCluster
+	// scopePool is every identity in the workload pool.
+	scopePool
+)
+
+const (
+	principalPrefix    = "principal://iam.googleapis.com/"
+	principalSetPrefix = "principalSet://iam.googleapis.com/"
+	deletedPrefix      = "deleted:"
+	clusterURLPrefix   = "https://container.googleapis.com/v1/"
+)
+
+// wifPrincipal is a parsed IAM member that refers to GKE workloads through a workload pool.
+type wifPrincipal struct {
+	Member string
+	// Deleted is set for members IAM rewrote with the deleted: prefix. They grant nothing.
+	Deleted bool
+	// Legacy is set for the serviceAccount:POOL[NS/KSA] form.
+	Legacy bool
+	// ProjectNumber is the number of the pool's project. The legacy form doesn't carry it.
+	ProjectNumber string
+	Pool          string
+	Scope         principalScope
+	Namespace     string
+	KSA           string
+	// Cluster is the cluster resource name (projects/P/locations/L/clusters/C) for scopeCluster.
+	Cluster string
+}
+
+// ksaIdentity is everything needed to decide whether a principal covers a KSA.
+type ksaIdentity struct {
+	WorkloadPool string
+	// PoolProjectNumber is optional; when empty the project number of principal:// identifiers
+	// isn't compared.
+	PoolProjectNumber string
+	Namespace         string
+	Name              string
+	// Cluster is the resource name of the KSA's cluster, projects/P/locations/L/clusters/C.
+	Cluster string
+}
+
+// clusterResourceName returns the resource name principalSet:// cluster identifiers refer to.
+func clusterResourceName(project, location, cluster string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, cluster)
+}
+
+// parsePrincipal parses the Workload Identity forms of an IAM member:
+//
+//	serviceAccount:POOL[NS/KSA]
+//	principal://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL/subject/ns/NS/sa/KSA
+//	principalSet://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL/namespace/NS
+//	principalSet://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL/kubernetes.cluster/https://container.googleapis.com/v1/projects/P/locations/L/clusters/C
+//	principalSet://iam.googleapis.com/projects/NUM/locations/global/workloadIdentityPools/POOL/*
+//
+// each optionally prefixed with deleted: and suffixed with ?uid=. It returns false for any other member.
+func parsePrincipal(member string) (*wifPrincipal, bool) {
+	p := &wifPrincipal{Member: member}
+	rest := member
+	if trimmed, ok := strings.CutPrefix(rest, deletedPrefix); ok {
+		p.Deleted = true
+		rest, _, _ = strings.Cut(trimmed, "?uid=")
+	}
+
+	if legacy, ok := strings.CutPrefix(rest, "serviceAccount:"); ok {
+		pool, subject, ok := strings.Cut(legacy, "[")
+		if !ok || !strings.HasSuffix(subject, "]") || pool == "" {
+			return nil, false
+		}
+		ns, ksa, ok := strings.Cut(strings.TrimSuffix(subject, "]"), "/")
+		if !ok || ns == "" || ksa == "" || strings.Contains(ksa, "/") {
+			return nil, false
+		}
+		p.Legacy, p.Pool, p.Scope, p.Namespace, p.KSA = true, pool, scopeKSA, ns, ksa
+		return p, true
+	}
+
+	var path string
+	isSet := false
+	if after, ok := strings.CutPrefix(rest, principalPrefix); ok {
+		path = after
+	} else if after, ok := strings.CutPrefix(rest, principalSetPrefix); ok {
+		path, isSet = after, true
+	} else {
+		return nil, false
+	}
+
+	// projects/NUM/locations/global/workloadIdentityPools/POOL/<selector>
+	parts := strings.SplitN(path, "/", 7)
+	if len(parts) != 7 || parts[0] != "projects" || parts[2] != "locations" || parts[3] != "global" || parts[4] != "workloadIdentityPools" {
+		return nil, false
+	}
+	p.ProjectNumber, p.Pool = parts[1], parts[5]
+	selector := parts[6]
+
+	if !isSet {
+		// subject/ns/NS/sa/KSA
+		s := strings.Split(selector, "/")
+		if len(s) != 5 || s[0] != "subject" || s[1] != "ns" || s[3] != "sa" || s[2] == "" || s[4] == "" {
+			return nil, false
+		}
+		p.Scope, p.Namespace, p.KSA = scopeKSA, s[2], s[4]
+		return p, true
+	}
+
+	if selector == "*" {
+		p.Scope = scopePool
+		return p, true
+	}
+	if ns, ok := strings.CutPrefix(selector, "namespace/"); ok {
+		if ns == "" || strings.Contains(ns, "/") {
+			return nil, false
+		}
+		p.Scope, p.Namespace = scopeNamespace, ns
+		return p, true
+	}
+	if url, ok := strings.CutPrefix(selector, "kubernetes.cluster/"); ok {
+		cluster, ok := strings.CutPrefix(url, clusterURLPrefix)
+		if !ok || len(strings.Split(cluster, "/")) != 6 {
+			return nil, false
+		}
+		p.Scope, p.Cluster = scopeCluster, cluster
+		return p, true
+	}
+	return nil, false
+}
+
+// appliesTo reports whether the principal grants its roles to the KSA. Deleted principals never do.
+func (p *wifPrincipal) appliesTo(id ksaIdentity) bool {
+	if p.Deleted || p.Pool != id.WorkloadPool {
+		return false
+	}
+	if p.ProjectNumber != "" && id.PoolProjectNumber != "" && p.ProjectNumber != id.PoolProjectNumber {
+		return false
+	}
+	switch p.Scope {
+	case scopeKSA:
+		return p.Namespace == id.Namespace && p.KSA == id.Name
+	case scopeNamespace:
+		return p.Namespace == id.Namespace
+	case scopeCluster:
+		return id.Cluster != "" && p.Cluster == id.Cluster
+	case scopePool:
+		return true
+	}
+	return false
+}
+
+// principalAppliesTo parses member and reports whether it covers the KSA.
+func principalAppliesTo(member string, id ksaIdentity) bool {
+	p, ok := parsePrincipal(member)
+	return ok && p.appliesTo(id)
+}
+
+// identity returns the KSA identity a report was produced for.
+func (r *ksaReport) identity() ksaIdentity {
+	return ksaIdentity{
+		WorkloadPool:      r.Cluster.WorkloadPool,
+		PoolProjectNumber: r.Cluster.WorkloadPoolProjectNumber,
+		Namespace:         r.KSA.Namespace,
+		Name:              r.KSA.Name,
+		Cluster:           clusterResourceName(r.Cluster.Project, r.Cluster.Location, r.Cluster.Name),
+	}
+}
+
+// principal returns the KSA's principal:// identifier, with a PROJECT_NUMBER placeholder when the
+// pool project's number couldn't be resolved.
+func (r *ksaReport) principal() string {
+	number := r.Cluster.WorkloadPoolProjectNumber
+	if number == "" {
+		number = "PROJECT_NUMBER"
+	}
+	return ksaPrincipal(number, r.Cluster.WorkloadPool, r.KSA.Namespace, r.KSA.Name)
+}
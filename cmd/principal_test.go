@@ -0,0 +1,103 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrincipal(t *testing.T) {
+	const pool = "test-project.svc.id.goog"
+	const base = "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool
+
+	tests := []struct {
+		member string
+		want   *wifPrincipal
+	}{
+		{"serviceAccount:" + pool + "[app/web]", &wifPrincipal{Legacy: true, Pool: pool, Scope: scopeKSA, Namespace: "app", KSA: "web"}},
+		{"principal://" + base + "/subject/ns/app/sa/web", &wifPrincipal{ProjectNumber: "123", Pool: pool, Scope: scopeKSA, Namespace: "app", KSA: "web"}},
+		{"principalSet://" + base + "/namespace/app", &wifPrincipal{ProjectNumber: "123", Pool: pool, Scope: scopeNamespace, Namespace: "app"}},
+		{"principalSet://" + base + "/kubernetes.cluster/https://container.googleapis.com/v1/projects/test-project/locations/us-central1/clusters/prod",
+			&wifPrincipal{ProjectNumber: "123", Pool: pool, Scope: scopeCluster, Cluster: "projects/test-project/locations/us-central1/clusters/prod"}},
+		{"principalSet://" + base + "/*", &wifPrincipal{ProjectNumber: "123", Pool: pool, Scope: scopePool}},
+		{"deleted:principal://" + base + "/subject/ns/app/sa/web?uid=4242", &wifPrincipal{Deleted: true, ProjectNumber: "123", Pool: pool, Scope: scopeKSA, Namespace: "app", KSA: "web"}},
+		{"deleted:serviceAccount:" + pool + "[app/web]?uid=4242", &wifPrincipal{Deleted: true, Legacy: true, Pool: pool, Scope: scopeKSA, Namespace: "app", KSA: "web"}},
+		{"serviceAccount:app@test-project.iam.gserviceaccount.com", nil},
+		{"user:someone@example.com", nil},
+		{"principal://" + base + "/subject/ns/app", nil},
+		{"principalSet://" + base + "/attribute.team/web", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.member, func(t *testing.T) {
+			got, ok := parsePrincipal(tt.member)
+			if tt.want == nil {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			tt.want.Member = tt.member
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPrincipalAppliesTo(t *testing.T) {
+	const pool = "test-project.svc.id.goog"
+	const base = "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/" + pool
+	id := ksaIdentity{
+		WorkloadPool: pool,
+		Namespace:    "app",
+		Name:         "web",
+		Cluster:      clusterResourceName("test-project", "us-central1", "prod"),
+	}
+
+	tests := []struct {
+		name   string
+		member string
+		want   bool
+	}{
+		{"legacy exact", "serviceAccount:" + pool + "[app/web]", true},
+		{"legacy other KSA with shared prefix", "serviceAccount:" + pool + "[app/web-canary]", false},
+		{"legacy other namespace with shared prefix", "serviceAccount:" + pool + "[app-2/web]", false},
+		{"legacy other pool", "serviceAccount:fleet-host.svc.id.goog[app/web]", false},
+		{"principal exact", "principal://" + base + "/subject/ns/app/sa/web", true},
+		{"principal other KSA with shared prefix", "principal://" + base + "/subject/ns/app/sa/web-canary", false},
+		{"namespace set", "principalSet://" + base + "/namespace/app", true},
+		{"other namespace set", "principalSet://" + base + "/namespace/app-2", false},
+		{"cluster set", "principalSet://" + base + "/kubernetes.cluster/https://container.googleapis.com/v1/projects/test-project/locations/us-central1/clusters/prod", true},
+		{"other cluster set", "principalSet://" + base + "/kubernetes.cluster/https://container.googleapis.com/v1/projects/test-project/locations/us-central1/clusters/prod-2", false},
+		{"whole pool", "principalSet://" + base + "/*", true},
+		{"other pool", "principalSet://iam.googleapis.com/projects/456/locations/global/workloadIdentityPools/fleet-host.svc.id.goog/*", false},
+		{"deleted", "deleted:principal://" + base + "/subject/ns/app/sa/web?uid=1", false},
+		{"unrelated", "user:someone@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, principalAppliesTo(tt.member, id))
+		})
+	}
+
+	t.Run("project number mismatch", func(t *testing.T) {
+		withNumber := id
+		withNumber.PoolProjectNumber = "456"
+		assert.False(t, principalAppliesTo("principal://"+base+"/subject/ns/app/sa/web", withNumber))
+		assert.True(t, principalAppliesTo("serviceAccount:"+pool+"[app/web]", withNumber))
+	})
+}
@@ -0,0 +1,538 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Stable identifiers of the probe checks.
+const (
+	checkProbePod         = "probe.pod"
+	checkProbeIdentity    = "probe.identity"
+	checkProbeScopes      = "probe.scopes"
+	checkProbeAccessToken = "probe.access-token"
+	checkProbeAPICall     = "probe.api-call"
+)
+
+const (
+	docMetadataServer = "https://cloud.google.com/kubernetes-engine/docs/concepts/workload-identity#metadata_server"
+	// probeOutputPrefix marks the lines of the probe script's output that carry results.
+	probeOutputPrefix = "WIF_PROBE "
+	probeContainer    = "probe"
+)
+
+// probeScript queries the metadata server the way a client library does and prints one
+// "WIF_PROBE key=value" line per result. It uses curl, python3 or wget, whichever the container
+// has, and needs no writable filesystem. The access token never leaves the shell: only its
+// lifetime is printed, and it is used as-is for the optional API call to the URL passed as $1.
+const probeScript = `md=http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default
+api_url=$1
+py='
+import sys, urllib.request, urllib.error
+name, value = sys.argv[2].split(": ", 1)
+try:
+    resp = urllib.request.urlopen(urllib.request.Request(sys.argv[1], headers={name: value}), timeout=10)
+    code, body = resp.getcode(), resp.read()
+except urllib.error.HTTPError as e:
+    code, body = e.code, e.read()
+except Exception:
+    code, body = 0, b""
+sys.stdout.write(body.decode("utf-8", "replace") + "\n%03d" % code)
+'
+# get URL HEADER prints the response body, then the HTTP status code on the last line.
+if command -v curl >/dev/null 2>&1; then
+  client=curl
+  get() { curl -s -m 10 -w '\n%{http_code}' -H "$2" "$1"; }
+elif command -v python3 >/dev/null 2>&1; then
+  client=python3
+  get() { python3 -c "$py" "$1" "$2"; }
+elif command -v wget >/dev/null 2>&1; then
+  client=wget
+  get() {
+    wget -q -T 10 -O - --header="$2" "$1" && printf '\n200' && return
+    code=$(wget -T 10 -O /dev/null --header="$2" "$1" 2>&1 | sed -n 's/.*\(HTTP\/[0-9.]* \|ERROR \)\([0-9][0-9][0-9]\).*/\2/p' | head -n 1)
+    printf '\n%s' "${code:-000}"
+  }
+else
+  echo "WIF_PROBE client=none"
+  exit 0
+fi
+echo "WIF_PROBE client=$client"
+fetch() {
+  resp=$(get "$2" "$3")
+  code=$(printf '%s' "$resp" | tail -n 1)
+  resp=$(printf '%s' "$resp" | sed '$d')
+  echo "WIF_PROBE $1.code=$code"
+}
+body() {
+  echo "WIF_PROBE $1.body=$(printf '%s' "$resp" | head -c 1000 | tr '\n' ' ')"
+}
+fetch email "$md/email" 'Metadata-Flavor: Google'; body email
+fetch scopes "$md/scopes" 'Metadata-Flavor: Google'; body scopes
+fetch token "$md/token" 'Metadata-Flavor: Google'
+if [ "$code" = 200 ]; then
+  token=$(printf '%s' "$resp" | sed -n 's/.*"access_token" *: *"\([^"]*\)".*/\1/p')
+  echo "WIF_PROBE token.expires_in=$(printf '%s' "$resp" | sed -n 's/.*"expires_in" *: *\([0-9]*\).*/\1/p')"
+  if [ -n "$api_url" ]; then
+    fetch api "$api_url" "Authorization: Bearer $token"; body api
+  fi
+else
+  body token
+fi
+`
+
+// probeCommand returns the command that runs probeScript, calling apiURL if it is set.
+func probeCommand(apiURL string) []string {
+	return []string{"sh", "-c", probeScript, "wif-probe", apiURL}
+}
+
+var (
+	probeNamespace    string
+	probeWorkloadType string
+	probeOpts         probeOptions
+)
+
+// probeOptions controls the probe pod and what it calls.
+type probeOptions struct {
+	image   string
+	apiURL  string
+	timeout time.Duration
+}
+
+// probePollInterval is how often the probe pod's status is polled.
+var probePollInterval = 2 * time.Second
+
+// podLogs reads the logs of a pod. It is a variable because the fake clientset can't serve logs.
+var podLogs = func(ctx context.Context, clientset kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (string, error) {
+	out, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs of pod '%s/%s': %w", namespace, pod, err)
+	}
+	return string(out), nil
+}
+
+// probeCmd represents the probe command
+var probeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Verifies the identity workloads actually receive from inside the cluster.",
+	Long: `Configuration checks can all pass while the runtime still fails. The probe commands ask the
+GKE metadata server, from inside the cluster, which identity a workload receives and whether it can
+get an access token.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat(outputFormat)
+	},
+}
+
+// probeWorkloadCmd represents the probe workload command
+var probeWorkloadCmd = &cobra.Command{
+	Use:   "workload <workload-name>",
+	Short: "Runs a short-lived pod as a workload's KSA and queries the metadata server from it.",
+	Long: `Launches a short-lived pod with the workload's KSA, namespace, nodeSelector, node affinity and
+tolerations, so it lands on the same kind of node. The pod asks metadata.google.internal for its
+service account email, its scopes and an access token, and optionally calls --api-url with the
+token. The token itself is never printed. The pod is deleted once the results are in.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workloadName := args[0]
+		ctx := context.Background()
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		clientset, err := getK8sClientset(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		workload := workloadRef{Kind: canonicalWorkloadKind(probeWorkloadType), Namespace: probeNamespace, Name: workloadName}
+		report, err := performWorkloadProbe(ctx, clientset, cluster, workload, probeOpts)
+		if err != nil {
+			log.Fatalf("❌ Failed to probe workload '%s': %v", workloadName, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ The probe for workload '%s' failed.", workloadName)
+		}
+	},
+}
+
+// probeReport holds what the metadata server told a pod running as the KSA.
+type probeReport struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Status     checkStatus  `json:"status"`
+	Cluster    clusterInfo  `json:"cluster"`
+	Workload   *workloadRef `json:"workload,omitempty"`
+	KSA        ksaRef       `json:"ksa"`
+	Pod        string       `json:"pod"`
+	Container  string       `json:"container,omitempty"`
+	Node       string       `json:"node,omitempty"`
+	// ExpectedIdentity is the annotated GSA, or the workload pool for KSAs that aren't annotated.
+	ExpectedIdentity string        `json:"expectedIdentity"`
+	Identity         string        `json:"identity,omitempty"`
+	Scopes           []string      `json:"scopes,omitempty"`
+	Checks           []checkResult `json:"checks"`
+}
+
+// add appends c and folds its status into the overall report status.
+func (r *probeReport) add(c checkResult) {
+	r.Checks = append(r.Checks, c)
+	if statusRank(c.Status) > statusRank(r.Status) {
+		r.Status = c.Status
+	}
+}
+
+// renderText writes the human readable form of a probe report.
+func (r *probeReport) renderText(w io.Writer) {
+	if r.Workload != nil {
+		fmt.Fprintf(w, "ℹ️ Workload %s is using Kubernetes Service Account '%s'.\n\n", r.Workload, r.KSA.Name)
+	}
+	fmt.Fprintf(w, "🔎 Probing the metadata server from pod '%s/%s'", r.KSA.Namespace, r.Pod)
+	if r.Container != "" {
+		fmt.Fprintf(w, " (container '%s')", r.Container)
+	}
+	if r.Node != "" {
+		fmt.Fprintf(w, " on node '%s'", r.Node)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+	renderChecks(w, r.Checks)
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+	switch r.Status {
+	case statusPass:
+		fmt.Fprintf(w, "🎉 The pod authenticates as '%s' and can get an access token.\n", r.Identity)
+	case statusWarn:
+		fmt.Fprintln(w, "⚠️  The probe completed with warnings. Review the items above.")
+	case statusFail:
+		fmt.Fprintln(w, "❌ The probe found a problem. Review the items above.")
+	}
+}
+
+// newProbeReport returns an empty probe report for a KSA, with the identity the metadata server
+// should hand out to it.
+func newProbeReport(cluster *containerpb.Cluster, ksa *corev1.ServiceAccount) *probeReport {
+	report := &probeReport{
+		APIVersion: reportAPIVersion,
+		Kind:       "ProbeReport",
+		Status:     statusPass,
+		Cluster:    clusterInfo{Project: projectID, Location: cluster.Location, Name: cluster.Name},
+		KSA:        ksaRef{Namespace: ksa.Namespace, Name: ksa.Name},
+		Checks:     []checkResult{},
+	}
+	if cluster.WorkloadIdentityConfig != nil {
+		report.Cluster.WorkloadPool = cluster.WorkloadIdentityConfig.WorkloadPool
+	}
+	report.ExpectedIdentity = ksa.Annotations[gsaAnnotation]
+	if report.ExpectedIdentity == "" {
+		// Without an annotation, the metadata server reports the workload pool as the email.
+		report.ExpectedIdentity = report.Cluster.WorkloadPool
+	}
+	return report
+}
+
+// newProbePod returns a pod that runs the probe script as ksa on the same kind of node as spec.
+func newProbePod(namespace, ksa string, spec *corev1.PodSpec, opts probeOptions) *corev1.Pod {
+	deadline := int64(opts.timeout.Seconds())
+	noToken := false
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wif-probe-" + rand.String(5),
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": "wif-probe", "app.kubernetes.io/managed-by": userAgentHeader},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName:           ksa,
+			AutomountServiceAccountToken: &noToken,
+			RestartPolicy:                corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:        &deadline,
+			NodeSelector:                 spec.NodeSelector,
+			Tolerations:                  spec.Tolerations,
+			Containers: []corev1.Container{{
+				Name:    probeContainer,
+				Image:   opts.image,
+				Command: probeCommand(opts.apiURL),
+			}},
+		},
+	}
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: spec.Affinity.NodeAffinity}
+	}
+	return pod
+}
+
+// waitForProbePod waits for the probe pod to finish. It gives up early when its image can't be
+// pulled, and reports why the pod isn't scheduled when the timeout expires.
+func waitForProbePod(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	err := wait.PollUntilContextTimeout(ctx, probePollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		pod, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return true, nil
+		}
+		for _, s := range pod.Status.ContainerStatuses {
+			if w := s.State.Waiting; w != nil && (w.Reason == "ErrImagePull" || w.Reason == "ImagePullBackOff" || w.Reason == "InvalidImageName") {
+				return false, fmt.Errorf("the probe image could not be pulled (%s): %s", w.Reason, w.Message)
+			}
+		}
+		return false, nil
+	})
+	if err != nil && pod != nil && wait.Interrupted(err) {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+				return pod, fmt.Errorf("the probe pod was not scheduled within %s: %s", timeout, c.Message)
+			}
+		}
+		return pod, fmt.Errorf("the probe pod did not finish within %s (phase %s)", timeout, pod.Status.Phase)
+	}
+	return pod, err
+}
+
+// parseProbeOutput extracts the results from the probe script's output, ignoring any other lines.
+func parseProbeOutput(out string) map[string]string {
+	results := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		_, rest, ok := strings.Cut(line, probeOutputPrefix)
+		if !ok {
+			continue
+		}
+		if key, value, ok := strings.Cut(rest, "="); ok {
+			results[key] = strings.TrimSpace(value)
+		}
+	}
+	return results
+}
+
+// explainIdentity explains why a pod received identity instead of the expected one.
+func explainIdentity(cluster *containerpb.Cluster, workloadPool, expected, identity string) string {
+	for _, pool := range cluster.GetNodePools() {
+		if identity == nodePoolServiceAccount(pool) {
+			return fmt.Sprintf("'%s' is the service account of node pool '%s'. The request was answered by the node's metadata server instead of the GKE metadata server: the pod uses hostNetwork, or runs on a node pool without the GKE_METADATA workload metadata mode.", identity, pool.Name)
+		}
+	}
+	switch {
+	case strings.HasSuffix(identity, "-compute@developer.gserviceaccount.com"):
+		return fmt.Sprintf("'%s' is the Compute Engine default service account, which nodes run as by default. The request was answered by the node's metadata server instead of the GKE metadata server: the pod uses hostNetwork, or runs on a node pool without the GKE_METADATA workload metadata mode.", identity)
+	case identity == workloadPool:
+		return fmt.Sprintf("The pod received the KSA's own identity in pool '%s', as if the KSA weren't annotated. The GKE metadata server can take a short while to pick up a new annotation; restart the pod if it predates the annotation.", workloadPool)
+	case expected == workloadPool:
+		return fmt.Sprintf("The KSA isn't annotated, yet the pod authenticates as '%s'.", identity)
+	}
+	return fmt.Sprintf("The pod authenticates as '%s' rather than '%s'. Check that the pod runs as the KSA you expect and that the KSA's annotation is spelled correctly.", identity, expected)
+}
+
+// evaluateProbe turns the probe script's results into checks on report.
+func evaluateProbe(report *probeReport, cluster *containerpb.Cluster, results map[string]string, apiURL string) {
+	identity := checkResult{
+		ID:       checkProbeIdentity,
+		Title:    "Asking the metadata server which service account the pod runs as",
+		Severity: severityHigh,
+		DocLink:  docMetadataServer,
+		Evidence: map[string]string{"expected": report.ExpectedIdentity},
+	}
+	if client := results["client"]; client != "" && client != "none" {
+		identity.Evidence["client"] = client
+	}
+	switch code := results["email.code"]; {
+	case results["client"] == "none":
+		identity.Status = statusFail
+		identity.Message = "The container has none of curl, python3 or wget, so the metadata server could not be queried from it."
+	case code == "":
+		identity.Status = statusFail
+		identity.Message = "The probe produced no result. The container may lack a shell."
+	case code != "200":
+		identity.Status = statusFail
+		identity.Evidence["httpStatus"] = code
+		identity.Message = fmt.Sprintf("The metadata server could not be queried (HTTP %s): %s", code, results["email.body"])
+		if code == "000" {
+			identity.Message = "metadata.google.internal could not be reached. Check for NetworkPolicies or egress rules that block 169.254.169.254 on port 80, or the GKE metadata server on 169.254.169.252 port 988."
+		}
+	default:
+		report.Identity = results["email.body"]
+		identity.Evidence["identity"] = report.Identity
+		if strings.EqualFold(report.Identity, report.ExpectedIdentity) {
+			identity.Status = statusPass
+			identity.Message = fmt.Sprintf("The pod authenticates as '%s'.", report.Identity)
+		} else {
+			identity.Status = statusFail
+			identity.Message = explainIdentity(cluster, report.Cluster.WorkloadPool, report.ExpectedIdentity, report.Identity)
+		}
+	}
+	report.add(identity)
+	if results["email.code"] == "" {
+		return
+	}
+
+	scopes := checkResult{
+		ID:       checkProbeScopes,
+		Title:    "Asking the metadata server for the token's scopes",
+		Severity: severityInfo,
+		Status:   statusPass,
+	}
+	if results["scopes.code"] == "200" {
+		report.Scopes = strings.Fields(results["scopes.body"])
+		scopes.Message = fmt.Sprintf("Scopes: %s", strings.Join(report.Scopes, ", "))
+	} else {
+		scopes.Status = statusSkip
+		scopes.Message = fmt.Sprintf("The scopes could not be read (HTTP %s).", results["scopes.code"])
+	}
+	report.add(scopes)
+
+	token := checkResult{
+		ID:       checkProbeAccessToken,
+		Title:    "Asking the metadata server for an access token",
+		Severity: severityHigh,
+		DocLink:  docMetadataServer,
+	}
+	tokenCode := results["token.code"]
+	if tokenCode == "200" {
+		token.Status = statusPass
+		token.Message = fmt.Sprintf("Got an access token that expires in %ss. The token was not printed.", results["token.expires_in"])
+	} else {
+		token.Status = statusFail
+		token.Evidence = map[string]string{"httpStatus": tokenCode}
+		token.Message = fmt.Sprintf("The metadata server refused to issue an access token (HTTP %s): %s", tokenCode, results["token.body"])
+		if report.ExpectedIdentity != report.Cluster.WorkloadPool {
+			token.Remediation = fmt.Sprintf("Run 'check ksa %s --namespace %s' to verify the KSA may impersonate '%s'.", report.KSA.Name, report.KSA.Namespace, report.ExpectedIdentity)
+		}
+	}
+	report.add(token)
+
+	if apiURL == "" || tokenCode != "200" {
+		return
+	}
+	api := checkResult{
+		ID:       checkProbeAPICall,
+		Title:    fmt.Sprintf("Calling %s with the access token", apiURL),
+		Severity: severityMedium,
+		Evidence: map[string]string{"httpStatus": results["api.code"]},
+	}
+	if code := results["api.code"]; strings.HasPrefix(code, "2") {
+		api.Status = statusPass
+		api.Message = fmt.Sprintf("The API answered HTTP %s.", code)
+	} else {
+		api.Status = statusFail
+		api.Message = fmt.Sprintf("The API answered HTTP %s: %s", code, results["api.body"])
+	}
+	report.add(api)
+}
+
+// performWorkloadProbe runs the probe script in a short-lived pod that mirrors the workload's KSA
+// and node placement, then deletes the pod. The returned error is only set when the probe pod
+// couldn't be created; problems running it are recorded as checks.
+func performWorkloadProbe(ctx context.Context, clientset kubernetes.Interface, cluster *containerpb.Cluster, workload workloadRef, opts probeOptions) (*probeReport, error) {
+	spec, err := getPodSpecFromWorkload(ctx, clientset, workload.Namespace, workload.Name, workload.Kind)
+	if err != nil {
+		return nil, err
+	}
+	ksaName := ksaFromPodSpec(*spec)
+	ksa, err := clientset.CoreV1().ServiceAccounts(workload.Namespace).Get(ctx, ksaName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", ksaName, workload.Namespace, err)
+	}
+
+	if err := resolveWorkloadOwner(ctx, clientset, &workload); err != nil {
+		log.Printf("⚠️  Could not find the owner of workload %s: %v", workload, err)
+	}
+	report := newProbeReport(cluster, ksa)
+	report.Workload = &workload
+
+	pod, err := clientset.CoreV1().Pods(workload.Namespace).Create(ctx, newProbePod(workload.Namespace, ksaName, spec, opts), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the probe pod in namespace '%s': %w", workload.Namespace, err)
+	}
+	report.Pod = pod.Name
+	defer func() {
+		// Use a fresh context so the pod is removed even when ctx has expired.
+		grace := int64(0)
+		if err := clientset.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &grace}); err != nil {
+			log.Printf("⚠️  Failed to delete probe pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+		}
+	}()
+
+	podCheck := checkResult{
+		ID:       checkProbePod,
+		Title:    fmt.Sprintf("Running probe pod '%s' as KSA '%s'", pod.Name, ksaName),
+		Severity: severityHigh,
+	}
+	finished, err := waitForProbePod(ctx, clientset, pod.Namespace, pod.Name, opts.timeout)
+	if finished != nil {
+		report.Node = finished.Spec.NodeName
+	}
+	if err != nil {
+		podCheck.Status = statusFail
+		podCheck.Message = err.Error()
+		report.add(podCheck)
+		return report, nil
+	}
+	out, err := podLogs(ctx, clientset, pod.Namespace, pod.Name, &corev1.PodLogOptions{Container: probeContainer})
+	if err != nil {
+		podCheck.Status = statusFail
+		podCheck.Message = err.Error()
+		report.add(podCheck)
+		return report, nil
+	}
+	podCheck.Status = statusPass
+	podCheck.Message = fmt.Sprintf("The probe pod ran on node '%s'.", report.Node)
+	podCheck.Evidence = map[string]string{"phase": string(finished.Status.Phase)}
+	report.add(podCheck)
+
+	evaluateProbe(report, cluster, parseProbeOutput(out), opts.apiURL)
+	return report, nil
+}
+
+func init() {
+	rootCmd.AddCommand(probeCmd)
+	addClusterFlags(probeCmd)
+	probeCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format (text, json, yaml)")
+	probeCmd.PersistentFlags().StringVarP(&probeNamespace, "namespace", "n", "default", "Kubernetes namespace of the workload or pod")
+	probeCmd.PersistentFlags().StringVar(&probeOpts.apiURL, "api-url", "", "Google API URL to call with the access token, e.g. https://storage.googleapis.com/storage/v1/b?project=PROJECT_ID")
+
+	probeCmd.AddCommand(probeWorkloadCmd)
+	probeWorkloadCmd.Flags().StringVarP(&probeWorkloadType, "type", "t", "deployment", "Type of the workload (deployment, statefulset, daemonset, replicaset, job, cronjob, pod)")
+	probeWorkloadCmd.Flags().StringVar(&probeOpts.image, "image", "curlimages/curl:8.11.1", "Image of the probe pod; it must provide sh and curl")
+	probeWorkloadCmd.Flags().DurationVar(&probeOpts.timeout, "timeout", 2*time.Minute, "How long to wait for the probe pod to finish")
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// defaultContainerAnnotation names the container kubectl execs into when none is given.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+var (
+	probePodContainer string
+	probePodTimeout   time.Duration
+)
+
+// probePodCmd represents the probe pod command
+var probePodCmd = &cobra.Command{
+	Use:   "pod <pod-name>",
+	Short: "Queries the metadata server from inside a running pod.",
+	Long: `Runs the metadata server query inside a container of a pod that is already running, through
+the exec subresource, so nothing new has to be scheduled. The query uses curl, python3 or wget,
+whichever the container has, and needs a shell. The identity the pod receives is compared with the
+GSA its KSA is annotated with, and mismatches are explained. The access token is never printed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		podName := args[0]
+		ctx := context.Background()
+
+		clients, err := newGCPClients(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
+		}
+		defer clients.Close()
+
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
+		if err != nil {
+			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
+		}
+
+		config, err := getK8sConfig(cluster)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes client config: %v", err)
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, probePodTimeout)
+		defer cancel()
+		report, err := performPodProbe(ctx, clientset, config, cluster, probeNamespace, podName, probePodContainer, probeOpts.apiURL)
+		if err != nil {
+			log.Fatalf("❌ Failed to probe pod '%s': %v", podName, err)
+		}
+		if err := writeOutput(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("❌ Failed to write report: %v", err)
+		}
+		if report.Status == statusFail {
+			log.Fatalf("❌ The probe for pod '%s' failed.", podName)
+		}
+	},
+}
+
+// probeTargetContainer returns the container to exec into: the named one, else the one kubectl
+// would pick by default.
+func probeTargetContainer(pod *corev1.Pod, name string) (string, error) {
+	if name == "" {
+		name = pod.Annotations[defaultContainerAnnotation]
+	}
+	if name == "" && len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name, nil
+	}
+	var names []string
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return name, nil
+		}
+		names = append(names, c.Name)
+	}
+	return "", fmt.Errorf("pod '%s/%s' has no container '%s'; its containers are: %s", pod.Namespace, pod.Name, name, strings.Join(names, ", "))
+}
+
+// performPodProbe runs the probe script inside a container of a running pod. The returned error
+// is only set when the pod or its KSA can't be read; problems running the probe are recorded as
+// checks.
+func performPodProbe(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, cluster *containerpb.Cluster, namespace, podName, containerName, apiURL string) (*probeReport, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod '%s' in namespace '%s': %w", podName, namespace, err)
+	}
+	containerName, err = probeTargetContainer(pod, containerName)
+	if err != nil {
+		return nil, err
+	}
+	ksaName := ksaFromPodSpec(pod.Spec)
+	ksa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, ksaName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes Service Account '%s' in namespace '%s': %w", ksaName, namespace, err)
+	}
+
+	report := newProbeReport(cluster, ksa)
+	report.Pod = pod.Name
+	report.Container = containerName
+	report.Node = pod.Spec.NodeName
+
+	podCheck := checkResult{
+		ID:       checkProbePod,
+		Title:    fmt.Sprintf("Running the probe in container '%s' of pod '%s' as KSA '%s'", containerName, pod.Name, ksaName),
+		Severity: severityHigh,
+		Evidence: map[string]string{"phase": string(pod.Status.Phase)},
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		podCheck.Status = statusFail
+		podCheck.Message = fmt.Sprintf("The pod is %s; the probe can only run in a running pod. Use 'probe workload' to launch a probe pod instead.", pod.Status.Phase)
+		report.add(podCheck)
+		return report, nil
+	}
+
+	out, err := execInPod(ctx, config, namespace, pod.Name, containerName, probeCommand(apiURL))
+	results := parseProbeOutput(out)
+	if err != nil && len(results) == 0 {
+		podCheck.Status = statusFail
+		podCheck.Message = fmt.Sprintf("The probe could not run in the container: %v", err)
+		if strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file or directory") {
+			podCheck.Message = "The container has no shell to run the probe in. Use 'probe workload' to launch a probe pod with the same KSA instead."
+		}
+		report.add(podCheck)
+		return report, nil
+	}
+	podCheck.Status = statusPass
+	podCheck.Message = fmt.Sprintf("The probe ran in the pod on node '%s'.", report.Node)
+	if pod.Spec.HostNetwork {
+		podCheck.Status = statusWarn
+		podCheck.Evidence["hostNetwork"] = "true"
+		podCheck.Message = "The pod uses hostNetwork, so its requests reach the node's metadata server rather than the GKE metadata server. Workload Identity Federation doesn't apply to such pods."
+	}
+	report.add(podCheck)
+
+	evaluateProbe(report, cluster, results, apiURL)
+	return report, nil
+}
+
+func init() {
+	probeCmd.AddCommand(probePodCmd)
+	probePodCmd.Flags().StringVarP(&probePodContainer, "container", "c", "", "Container to run the probe in (defaults to the pod's default container)")
+	probePodCmd.Flags().DurationVar(&probePodTimeout, "timeout", time.Minute, "How long to wait for the probe to finish")
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestProbeTargetContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "web"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "istio-proxy"}, {Name: "app"}}},
+	}
+	name, err := probeTargetContainer(pod, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "istio-proxy", name)
+
+	pod.Annotations = map[string]string{defaultContainerAnnotation: "app"}
+	name, err = probeTargetContainer(pod, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "app", name)
+
+	_, err = probeTargetContainer(pod, "sidecar")
+	assert.EqualError(t, err, "pod 'web/frontend' has no container 'sidecar'; its containers are: istio-proxy, app")
+}
+
+func TestPerformPodProbe(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	defer func() { execInPod = remoteExec }()
+
+	pod := func(name string, phase corev1.PodPhase, hostNetwork bool) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web"},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "app",
+				NodeName:           "node-1",
+				HostNetwork:        hostNetwork,
+				Containers:         []corev1.Container{{Name: "app"}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "web", Annotations: map[string]string{gsaAnnotation: probeTestGSA}}},
+		pod("running", corev1.PodRunning, false),
+		pod("host", corev1.PodRunning, true),
+		pod("pending", corev1.PodPending, false),
+	)
+	output := func(identity string) string {
+		return "WIF_PROBE client=python3\nWIF_PROBE email.code=200\nWIF_PROBE email.body=" + identity + "\nWIF_PROBE scopes.code=200\nWIF_PROBE scopes.body=https://www.googleapis.com/auth/cloud-platform\nWIF_PROBE token.code=200\nWIF_PROBE token.expires_in=3599\n"
+	}
+
+	tests := []struct {
+		name     string
+		pod      string
+		out      string
+		err      error
+		status   checkStatus
+		statuses []checkStatus
+		contains string
+	}{
+		{
+			name:     "Healthy",
+			pod:      "running",
+			out:      output(probeTestGSA),
+			status:   statusPass,
+			statuses: []checkStatus{statusPass, statusPass, statusPass, statusPass},
+		},
+		{
+			name:     "NodeServiceAccount",
+			pod:      "host",
+			out:      output("nodes@test-project.iam.gserviceaccount.com"),
+			status:   statusFail,
+			statuses: []checkStatus{statusWarn, statusFail, statusPass, statusPass},
+			contains: "service account of node pool 'legacy'",
+		},
+		{
+			name:     "NoShell",
+			pod:      "running",
+			err:      errors.New(`command failed: exec: "sh": executable file not found in $PATH`),
+			status:   statusFail,
+			statuses: []checkStatus{statusFail},
+			contains: "has no shell",
+		},
+		{
+			name:     "NoClient",
+			pod:      "running",
+			out:      "WIF_PROBE client=none\n",
+			status:   statusFail,
+			statuses: []checkStatus{statusPass, statusFail},
+			contains: "none of curl, python3 or wget",
+		},
+		{
+			name:     "NotRunning",
+			pod:      "pending",
+			status:   statusFail,
+			statuses: []checkStatus{statusFail},
+			contains: "The pod is Pending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			execInPod = func(ctx context.Context, config *rest.Config, namespace, pod, container string, command []string) (string, error) {
+				ran = append(ran, namespace+"/"+pod+"/"+container)
+				assert.Equal(t, probeCommand(""), command)
+				return tt.out, tt.err
+			}
+
+			report, err := performPodProbe(ctx, clientset, &rest.Config{}, newProbeTestCluster(), "web", tt.pod, "", "")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, "app", report.Container)
+			assert.Equal(t, "node-1", report.Node)
+
+			var statuses []checkStatus
+			messages := ""
+			for _, c := range report.Checks {
+				statuses = append(statuses, c.Status)
+				messages += c.Message + "\n"
+			}
+			assert.Equal(t, tt.statuses, statuses)
+			assert.Contains(t, messages, tt.contains)
+			if tt.pod != "pending" {
+				assert.Equal(t, []string{"web/" + tt.pod + "/app"}, ran)
+			} else {
+				assert.Empty(t, ran)
+			}
+		})
+	}
+
+	_, err := performPodProbe(ctx, clientset, &rest.Config{}, newProbeTestCluster(), "web", "missing", "", "")
+	assert.ErrorContains(t, err, "failed to get pod 'missing'")
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const probeTestGSA = "app@test-project.iam.gserviceaccount.com"
+
+func newProbeTestCluster() *containerpb.Cluster {
+	return &containerpb.Cluster{
+		Name:                   "test-cluster",
+		Location:               "us-central1",
+		WorkloadIdentityConfig: &containerpb.WorkloadIdentityConfig{WorkloadPool: "test-project.svc.id.goog"},
+		NodePools: []*containerpb.NodePool{
+			{Name: "legacy", Config: &containerpb.NodeConfig{ServiceAccount: "nodes@test-project.iam.gserviceaccount.com"}},
+		},
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	out := "some noise\nWIF_PROBE email.code=200\r\nWIF_PROBE email.body=" + probeTestGSA + "\nWIF_PROBE scopes.body=https://www.googleapis.com/auth/cloud-platform \nnot WIF_PROBE-ish\n"
+	assert.Equal(t, map[string]string{
+		"email.code":  "200",
+		"email.body":  probeTestGSA,
+		"scopes.body": "https://www.googleapis.com/auth/cloud-platform",
+	}, parseProbeOutput(out))
+}
+
+func TestEvaluateProbe(t *testing.T) {
+	cluster := newProbeTestCluster()
+	annotated := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "web", Annotations: map[string]string{gsaAnnotation: probeTestGSA}}}
+	ok := map[string]string{
+		"email.code":       "200",
+		"email.body":       probeTestGSA,
+		"scopes.code":      "200",
+		"scopes.body":      "https://www.googleapis.com/auth/cloud-platform https://www.googleapis.com/auth/userinfo.email",
+		"token.code":       "200",
+		"token.expires_in": "3599",
+		"api.code":         "200",
+	}
+	with := func(overrides map[string]string) map[string]string {
+		results := map[string]string{}
+		for k, v := range ok {
+			results[k] = v
+		}
+		for k, v := range overrides {
+			results[k] = v
+		}
+		return results
+	}
+
+	tests := []struct {
+		name     string
+		results  map[string]string
+		apiURL   string
+		statuses map[string]checkStatus
+		contains string
+	}{
+		{
+			name:     "Healthy",
+			results:  ok,
+			apiURL:   "https://storage.googleapis.com/storage/v1/b?project=test-project",
+			statuses: map[string]checkStatus{checkProbeIdentity: statusPass, checkProbeScopes: statusPass, checkProbeAccessToken: statusPass, checkProbeAPICall: statusPass},
+		},
+		{
+			name:     "NodeServiceAccount",
+			results:  with(map[string]string{"email.body": "nodes@test-project.iam.gserviceaccount.com"}),
+			statuses: map[string]checkStatus{checkProbeIdentity: statusFail, checkProbeScopes: statusPass, checkProbeAccessToken: statusPass},
+			contains: "service account of node pool 'legacy'",
+		},
+		{
+			name:     "DefaultComputeServiceAccount",
+			results:  with(map[string]string{"email.body": "123-compute@developer.gserviceaccount.com"}),
+			statuses: map[string]checkStatus{checkProbeIdentity: statusFail, checkProbeScopes: statusPass, checkProbeAccessToken: statusPass},
+			contains: "Compute Engine default service account",
+		},
+		{
+			name:     "AnnotationNotInEffect",
+			results:  with(map[string]string{"email.body": "test-project.svc.id.goog"}),
+			statuses: map[string]checkStatus{checkProbeIdentity: statusFail, checkProbeScopes: statusPass, checkProbeAccessToken: statusPass},
+			contains: "as if the KSA weren't annotated",
+		},
+		{
+			name: "TokenRefused",
+			results: with(map[string]string{
+				"token.code": "403",
+				"token.body": "Unable to generate access token; IAM returned 403 Forbidden: Permission 'iam.serviceAccounts.getAccessToken' denied",
+			}),
+			apiURL:   "https://storage.googleapis.com/storage/v1/b",
+			statuses: map[string]checkStatus{checkProbeIdentity: statusPass, checkProbeScopes: statusPass, checkProbeAccessToken: statusFail},
+			contains: "iam.serviceAccounts.getAccessToken",
+		},
+		{
+			name:     "APIDenied",
+			results:  with(map[string]string{"api.code": "403", "api.body": "does not have storage.buckets.list access"}),
+			apiURL:   "https://storage.googleapis.com/storage/v1/b",
+			statuses: map[string]checkStatus{checkProbeIdentity: statusPass, checkProbeScopes: statusPass, checkProbeAccessToken: statusPass, checkProbeAPICall: statusFail},
+			contains: "storage.buckets.list",
+		},
+		{
+			name:     "MetadataUnreachable",
+			results:  map[string]string{"email.code": "000", "scopes.code": "000", "token.code": "000"},
+			statuses: map[string]checkStatus{checkProbeIdentity: statusFail, checkProbeScopes: statusSkip, checkProbeAccessToken: statusFail},
+			contains: "could not be reached",
+		},
+		{
+			name:     "NoOutput",
+			results:  map[string]string{},
+			statuses: map[string]checkStatus{checkProbeIdentity: statusFail},
+			contains: "no result",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newProbeReport(cluster, annotated)
+			evaluateProbe(report, cluster, tt.results, tt.apiURL)
+
+			statuses := map[string]checkStatus{}
+			messages := ""
+			for _, c := range report.Checks {
+				statuses[c.ID] = c.Status
+				messages += c.Message + "\n"
+			}
+			assert.Equal(t, tt.statuses, statuses)
+			assert.Contains(t, messages, tt.contains)
+		})
+	}
+
+	unannotated := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "web"}}
+	report := newProbeReport(cluster, unannotated)
+	assert.Equal(t, "test-project.svc.id.goog", report.ExpectedIdentity)
+	evaluateProbe(report, cluster, with(map[string]string{"email.body": "test-project.svc.id.goog"}), "")
+	assert.Equal(t, statusPass, report.Status)
+}
+
+// completePodsOnCreate makes the fake clientset run every pod to completion on node as soon as it
+// is created.
+func completePodsOnCreate(clientset *fake.Clientset, node string) {
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Spec.NodeName = node
+		pod.Status.Phase = corev1.PodSucceeded
+		return false, nil, nil
+	})
+}
+
+func TestPerformWorkloadProbe(t *testing.T) {
+	ctx := context.Background()
+	setProjectID(t, "test-project")
+	probePollInterval = time.Millisecond
+	defer func() { probePollInterval = 2 * time.Second }()
+
+	tolerations := []corev1.Toleration{{Key: "dedicated", Value: "web", Effect: corev1.TaintEffectNoSchedule}}
+	clientset := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "web", Annotations: map[string]string{gsaAnnotation: probeTestGSA}}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "web"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				ServiceAccountName: "app",
+				NodeSelector:       map[string]string{"pool": "web"},
+				Tolerations:        tolerations,
+			}}},
+		},
+	)
+	completePodsOnCreate(clientset, "node-1")
+
+	var created *corev1.Pod
+	podLogs = func(ctx context.Context, cs kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions) (string, error) {
+		created, _ = cs.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+		return "WIF_PROBE email.code=200\nWIF_PROBE email.body=" + probeTestGSA + "\nWIF_PROBE scopes.code=200\nWIF_PROBE scopes.body=https://www.googleapis.com/auth/cloud-platform\nWIF_PROBE token.code=200\nWIF_PROBE token.expires_in=3599\n", nil
+	}
+
+	opts := probeOptions{image: "curlimages/curl:8.11.1", timeout: time.Second}
+	workload := workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}
+	report, err := performWorkloadProbe(ctx, clientset, newProbeTestCluster(), workload, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, statusPass, report.Status)
+	assert.Equal(t, "node-1", report.Node)
+	assert.Equal(t, probeTestGSA, report.Identity)
+	assert.Equal(t, []string{checkProbePod, checkProbeIdentity, checkProbeScopes, checkProbeAccessToken}, checkIDs(report.Checks))
+
+	// The probe pod mirrors the workload's KSA and placement, and is gone afterwards.
+	if assert.NotNil(t, created) {
+		assert.Equal(t, "app", created.Spec.ServiceAccountName)
+		assert.Equal(t, map[string]string{"pool": "web"}, created.Spec.NodeSelector)
+		assert.Equal(t, tolerations, created.Spec.Tolerations)
+		assert.Equal(t, corev1.RestartPolicyNever, created.Spec.RestartPolicy)
+		_, err = clientset.CoreV1().Pods("web").Get(ctx, created.Name, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	}
+
+	_, err = performWorkloadProbe(ctx, clientset, newProbeTestCluster(), workloadRef{Kind: "deployment", Namespace: "web", Name: "missing"}, opts)
+	assert.ErrorContains(t, err, "could not get workload")
+}
+
+func TestPerformWorkloadProbeUnschedulable(t *testing.T) {
+	ctx := context.Background()
+	probePollInterval = time.Millisecond
+	defer func() { probePollInterval = 2 * time.Second }()
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "web"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "web"}},
+	)
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = corev1.PodPending
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Message: "0/3 nodes are available: 3 node(s) didn't match Pod's node affinity/selector."}}
+		return false, nil, nil
+	})
+
+	report, err := performWorkloadProbe(ctx, clientset, newProbeTestCluster(), workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}, probeOptions{timeout: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, statusFail, report.Status)
+	assert.Equal(t, checkProbePod, report.Checks[0].ID)
+	assert.Contains(t, report.Checks[0].Message, "was not scheduled within 20ms: 0/3 nodes are available")
+
+	pods, _ := clientset.CoreV1().Pods("web").List(ctx, metav1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
+
+func checkIDs(checks []checkResult) []string {
+	ids := make([]string, 0, len(checks))
+	for _, c := range checks {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
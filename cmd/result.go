@@ -0,0 +1,269 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// checkStatus is the verdict of a single check.
+type checkStatus string
+
+const (
+	statusPass checkStatus = "pass"
+	statusWarn checkStatus = "warn"
+	statusFail checkStatus = "fail"
+	statusSkip checkStatus = "skip"
+)
+
+// severity ranks how much a non-passing check matters.
+type severity string
+
+const (
+	severityInfo   severity = "info"
+	severityLow    severity = "low"
+	severityMedium severity = "medium"
+	severityHigh   severity = "high"
+)
+
+// Stable check identifiers. Automation keys off these, so never rename one.
+const (
+	checkClusterWorkloadIdentity = "cluster.workload-identity"
+	checkKsaExists               = "ksa.exists"
+	checkKsaAnnotation           = "ksa.gsa-annotation"
+	checkIamWorkloadIdentityUser = "iam.workload-identity-user"
+	checkIamDirectBinding        = "iam.direct-binding"
+	checkIamDenyPolicy           = "iam.deny-policy"
+	checkGsaCrossProject         = "gsa.cross-project"
+	checkGsaExists               = "gsa.exists"
+	checkGsaKeys                 = "gsa.keys"
+	checkGsaDeletedMembers       = "gsa.deleted-members"
+	checkAccessPermission        = "access.permission"
+)
+
+const (
+	docWorkloadIdentity = "https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity"
+	docPrincipals       = "https://cloud.google.com/kubernetes-engine/docs/concepts/workload-identity#kubernetes-resources-iam-policies"
+)
+
+// checkResult is the outcome of one diagnostic step.
+type checkResult struct {
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Status      checkStatus       `json:"status"`
+	Severity    severity          `json:"severity"`
+	Message     string            `json:"message"`
+	Evidence    map[string]string `json:"evidence,omitempty"`
+	Remediation string            `json:"remediation,omitempty"`
+	DocLink     string            `json:"docLink,omitempty"`
+}
+
+// reportAPIVersion versions the JSON/YAML document. Bump it whenever a field is
+// renamed or removed; adding fields is backwards compatible.
+const reportAPIVersion = "gke-wif-troubleshooter/v1"
+
+// clusterInfo identifies the GKE cluster a report was produced against.
+type clusterInfo struct {
+	Project      string `json:"project"`
+	Location     string `json:"location"`
+	Name         string `json:"name"`
+	WorkloadPool string `json:"workloadPool,omitempty"`
+	// WorkloadPoolProjectNumber is the number of the project hosting the workload pool.
+	WorkloadPoolProjectNumber string `json:"workloadPoolProjectNumber,omitempty"`
+}
+
+// workloadRef identifies the workload a KSA was resolved from.
+type workloadRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Owner is the workload that manages a pod or ReplicaSet, such as its Deployment.
+	Owner *workloadRef `json:"owner,omitempty"`
+}
+
+// String describes the workload, and its owner if it has one.
+func (w workloadRef) String() string {
+	s := fmt.Sprintf("'%s/%s' (%s)", w.Namespace, w.Name, w.Kind)
+	if w.Owner != nil {
+		s = fmt.Sprintf("'%s/%s' (%s, managed by %s '%s')", w.Namespace, w.Name, w.Kind, w.Owner.Kind, w.Owner.Name)
+	}
+	return s
+}
+
+// ksaRef identifies a Kubernetes Service Account.
+type ksaRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ksaReport collects every check run against a single KSA.
+type ksaReport struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Status     checkStatus  `json:"status"`
+	Cluster    clusterInfo  `json:"cluster"`
+	Workload   *workloadRef `json:"workload,omitempty"`
+	KSA        ksaRef       `json:"ksa"`
+	GSA        string       `json:"gsa,omitempty"`
+	GSAProject string       `json:"gsaProject,omitempty"`
+	Members    []string     `json:"iamMembersFound,omitempty"`
+	// GSAUniqueID is the unique ID of the annotated GSA. It changes when a GSA is deleted and
+	// recreated with the same email.
+	GSAUniqueID string `json:"gsaUniqueId,omitempty"`
+	// Bindings lists the roles granted to the KSA principal and where each is attached: the
+	// roles/iam.workloadIdentityUser bindings on the annotated GSA, or the direct bindings otherwise.
+	Bindings []grantedBinding `json:"bindingsFound,omitempty"`
+	// Denials lists the deny rules that apply to the KSA or its GSA.
+	Denials []deniedRule `json:"denyRules,omitempty"`
+	// Access is set by check access.
+	Access *accessResult `json:"access,omitempty"`
+	// Troubleshooter is the Policy Troubleshooter's explanation, set by check access --troubleshoot.
+	Troubleshooter *troubleshootExplanation `json:"policyTroubleshooter,omitempty"`
+	// MetadataServerLogs is set by check workload --collect-logs.
+	MetadataServerLogs []metadataServerLogs `json:"metadataServerLogs,omitempty"`
+	Checks             []checkResult        `json:"checks"`
+}
+
+func newKsaReport(clusterName, clusterLocation, namespace, ksa string) *ksaReport {
+	return &ksaReport{
+		APIVersion: reportAPIVersion,
+		Kind:       "KsaReport",
+		Status:     statusPass,
+		Cluster: clusterInfo{
+			Project:  projectID,
+			Location: clusterLocation,
+			Name:     clusterName,
+		},
+		KSA:    ksaRef{Namespace: namespace, Name: ksa},
+		Checks: []checkResult{},
+	}
+}
+
+// add appends c and folds its status into the overall report status.
+func (r *ksaReport) add(c checkResult) {
+	r.Checks = append(r.Checks, c)
+	if statusRank(c.Status) > statusRank(r.Status) {
+		r.Status = c.Status
+	}
+}
+
+// fail records c as a failed check and hands err back so callers can return it directly.
+func (r *ksaReport) fail(c checkResult, err error) error {
+	c.Status = statusFail
+	if c.Message == "" {
+		c.Message = err.Error()
+	}
+	r.add(c)
+	return err
+}
+
+func statusRank(s checkStatus) int {
+	switch s {
+	case statusFail:
+		return 3
+	case statusWarn:
+		return 2
+	case statusPass:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func statusIcon(s checkStatus) string {
+	switch s {
+	case statusPass:
+		return "✅"
+	case statusWarn:
+		return "⚠️ "
+	case statusFail:
+		return "❌"
+	default:
+		return "ℹ️ "
+	}
+}
+
+// renderText writes the human readable form of a report.
+func (r *ksaReport) renderText(w io.Writer) {
+	if r.Workload != nil {
+		fmt.Fprintf(w, "ℹ️ Workload %s is using Kubernetes Service Account '%s'.\n\n", r.Workload, r.KSA.Name)
+	}
+	fmt.Fprintf(w, "🔎 Starting GKE Workload Identity analysis for KSA: %s/%s\n", r.KSA.Namespace, r.KSA.Name)
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+
+	renderChecks(w, r.Checks)
+	for _, l := range r.MetadataServerLogs {
+		fmt.Fprintf(w, "\n📜 gke-metadata-server logs about pod '%s' on node '%s'", l.Pod, l.Node)
+		if l.ServerPod != "" {
+			fmt.Fprintf(w, " (from '%s')", l.ServerPod)
+		}
+		fmt.Fprintln(w, ":")
+		if l.Error != "" {
+			fmt.Fprintf(w, "   ⚠️  %s\n", l.Error)
+		} else if len(l.Lines) == 0 {
+			fmt.Fprintln(w, "   (no matching lines)")
+		}
+		for _, line := range l.Lines {
+			if line.Class != "" {
+				fmt.Fprintf(w, "   [%s] %s\n", line.Class, line.Line)
+			} else {
+				fmt.Fprintf(w, "   %s\n", line.Line)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "-------------------------------------------------------------")
+	switch r.Status {
+	case statusPass:
+		fmt.Fprintln(w, "🎉 All checks passed! Your Workload Identity setup seems correct for this KSA.")
+	case statusWarn:
+		fmt.Fprintln(w, "⚠️  Checks completed with warnings. Review the items above.")
+	case statusFail:
+		fmt.Fprintln(w, "❌ One or more checks failed. Review the items above.")
+	}
+}
+
+// renderChecks writes a numbered list of checks with their evidence, suggested fix and docs.
+func renderChecks(w io.Writer, checks []checkResult) {
+	for i, c := range checks {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%d. %s\n", i+1, c.Title)
+		fmt.Fprintf(w, "   %s %s\n", statusIcon(c.Status), c.Message)
+
+		keys := make([]string, 0, len(c.Evidence))
+		for k := range c.Evidence {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "      %s: %s\n", k, c.Evidence[k])
+		}
+		if c.Remediation != "" {
+			fmt.Fprintln(w, "   🔧 Suggested fix:")
+			for _, line := range strings.Split(c.Remediation, "\n") {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+		}
+		if c.DocLink != "" {
+			fmt.Fprintf(w, "   📖 %s\n", c.DocLink)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	checkAccessTroubleshooter = "access.policy-troubleshooter"
+	docPolicyTroubleshooter   = "https://cloud.google.com/policy-intelligence/docs/troubleshoot-access"
+	// policyTroubleshooterEndpoint serves the Policy Troubleshooter v3 API.
+	policyTroubleshooterEndpoint = "https://policytroubleshooter.googleapis.com/"
+)
+
+// Access states reported by the Policy Troubleshooter, overall and, with their ALLOW_ACCESS_STATE_
+// and DENY_ACCESS_STATE_ prefixes removed, for each policy, binding and deny rule.
+const (
+	accessGranted            = "CAN_ACCESS"
+	accessNotGranted         = "CANNOT_ACCESS"
+	accessUnknownConditional = "UNKNOWN_CONDITIONAL"
+	accessUnknownInfo        = "UNKNOWN_INFO"
+
+	allowGranted = "GRANTED"
+	denyDenied   = "DENIED"
+)
+
+// troubleshootExplanation is the Policy Troubleshooter's verdict for one access tuple.
+type troubleshootExplanation struct {
+	Principal    string                `json:"principal"`
+	Resource     string                `json:"resource"`
+	Permission   string                `json:"permission"`
+	Access       string                `json:"access"`
+	Policies     []explainedPolicy     `json:"policies,omitempty"`
+	DenyPolicies []explainedDenyPolicy `json:"denyPolicies,omitempty"`
+	Errors       []string              `json:"errors,omitempty"`
+}
+
+// explainedPolicy is one allow policy the Policy Troubleshooter evaluated.
+type explainedPolicy struct {
+	Resource  string             `json:"resource"`
+	Access    string             `json:"access"`
+	Relevance string             `json:"relevance,omitempty"`
+	Bindings  []explainedBinding `json:"bindings,omitempty"`
+}
+
+// explainedBinding explains how one binding affects the principal.
+type explainedBinding struct {
+	Role           string `json:"role"`
+	Access         string `json:"access"`
+	RolePermission string `json:"rolePermission,omitempty"`
+	Relevance      string `json:"relevance,omitempty"`
+	Condition      string `json:"condition,omitempty"`
+	// ConditionValue is the Troubleshooter's evaluation of Condition, when it could evaluate it.
+	ConditionValue *bool `json:"conditionValue,omitempty"`
+	// Memberships maps each member of the binding to whether it includes the principal.
+	Memberships map[string]string `json:"memberships,omitempty"`
+}
+
+// explainedDenyPolicy is one deny policy the Policy Troubleshooter evaluated.
+type explainedDenyPolicy struct {
+	Name      string              `json:"name"`
+	Resource  string              `json:"resource"`
+	Access    string              `json:"access"`
+	Relevance string              `json:"relevance,omitempty"`
+	Rules     []explainedDenyRule `json:"rules,omitempty"`
+}
+
+// explainedDenyRule explains how one rule of a deny policy affects the principal.
+type explainedDenyRule struct {
+	Access    string `json:"access"`
+	Relevance string `json:"relevance,omitempty"`
+	// PermissionDenied is whether the rule's denied permissions match the permission.
+	PermissionDenied bool   `json:"permissionDenied"`
+	Condition        string `json:"condition,omitempty"`
+	ConditionValue   *bool  `json:"conditionValue,omitempty"`
+	// DeniedPrincipals and ExceptionPrincipals are the rule's principals that match the principal.
+	DeniedPrincipals    []string `json:"deniedPrincipals,omitempty"`
+	ExceptionPrincipals []string `json:"exceptionPrincipals,omitempty"`
+}
+
+// policyTroubleshooter explains why a principal does or doesn't have a permission on a resource.
+type policyTroubleshooter interface {
+	Troubleshoot(ctx context.Context, principal, resource, permission string) (*troubleshootExplanation, error)
+}
+
+// restPolicyTroubleshooter implements policyTroubleshooter with the Policy Troubleshooter v3 API,
+// which explains deny policies and condition evaluation as well as allow policies.
+// google.golang.org/api has no v3 client, so the request is sent with an authenticated HTTP
+// client and the parts of the response the report shows are decoded below.
+type restPolicyTroubleshooter struct {
+	client   *http.Client
+	endpoint string
+}
+
+// The subset of the v3 TroubleshootIamPolicyResponse the report uses.
+type (
+	v3TroubleshootResponse struct {
+		OverallAccessState     string                   `json:"overallAccessState"`
+		AllowPolicyExplanation v3AllowPolicyExplanation `json:"allowPolicyExplanation"`
+		DenyPolicyExplanation  v3DenyPolicyExplanation  `json:"denyPolicyExplanation"`
+		Errors                 []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	v3AllowPolicyExplanation struct {
+		ExplainedPolicies []struct {
+			AllowAccessState    string `json:"allowAccessState"`
+			FullResourceName    string `json:"fullResourceName"`
+			Relevance           string `json:"relevance"`
+			BindingExplanations []struct {
+				AllowAccessState     string                  `json:"allowAccessState"`
+				Role                 string                  `json:"role"`
+				RolePermission       string                  `json:"rolePermission"`
+				Relevance            string                  `json:"relevance"`
+				Condition            *v3Expr                 `json:"condition"`
+				ConditionExplanation *v3ConditionExplanation `json:"conditionExplanation"`
+				Memberships          map[string]v3Membership `json:"memberships"`
+			} `json:"bindingExplanations"`
+		} `json:"explainedPolicies"`
+	}
+	v3DenyPolicyExplanation struct {
+		ExplainedResources []struct {
+			FullResourceName  string `json:"fullResourceName"`
+			ExplainedPolicies []struct {
+				DenyAccessState string `json:"denyAccessState"`
+				Relevance       string `json:"relevance"`
+				Policy          struct {
+					Name string `json:"name"`
+				} `json:"policy"`
+				RuleExplanations []struct {
+					DenyAccessState          string `json:"denyAccessState"`
+					Relevance                string `json:"relevance"`
+					CombinedDeniedPermission struct {
+						PermissionMatchingState string `json:"permissionMatchingState"`
+					} `json:"combinedDeniedPermission"`
+					DeniedPrincipals     map[string]v3Membership `json:"deniedPrincipals"`
+					ExceptionPrincipals  map[string]v3Membership `json:"exceptionPrincipals"`
+					Condition            *v3Expr                 `json:"condition"`
+					ConditionExplanation *v3ConditionExplanation `json:"conditionExplanation"`
+				} `json:"ruleExplanations"`
+			} `json:"explainedPolicies"`
+		} `json:"explainedResources"`
+	}
+	v3Expr struct {
+		Expression string `json:"expression"`
+	}
+	v3Membership struct {
+		Membership string `json:"membership"`
+	}
+	v3ConditionExplanation struct {
+		Value any `json:"value"`
+	}
+)
+
+func (t *restPolicyTroubleshooter) Troubleshoot(ctx context.Context, principal, resource, permission string) (*troubleshootExplanation, error) {
+	body, err := json.Marshal(map[string]any{
+		"accessTuple": map[string]string{
+			"principal":        principal,
+			"fullResourceName": resource,
+			"permission":       permission,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.endpoint, "/")+"/v3/iam:troubleshoot", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	var v3 v3TroubleshootResponse
+	if err := json.NewDecoder(resp.Body).Decode(&v3); err != nil {
+		return nil, fmt.Errorf("failed to decode Policy Troubleshooter response: %w", err)
+	}
+
+	explanation := &troubleshootExplanation{
+		Principal:  principal,
+		Resource:   resource,
+		Permission: permission,
+		Access:     v3.OverallAccessState,
+	}
+	for _, e := range v3.Errors {
+		explanation.Errors = append(explanation.Errors, e.Message)
+	}
+	for _, p := range v3.AllowPolicyExplanation.ExplainedPolicies {
+		policy := explainedPolicy{
+			Resource:  p.FullResourceName,
+			Access:    strings.TrimPrefix(p.AllowAccessState, "ALLOW_ACCESS_STATE_"),
+			Relevance: strings.TrimPrefix(p.Relevance, "HEURISTIC_RELEVANCE_"),
+		}
+		for _, b := range p.BindingExplanations {
+			binding := explainedBinding{
+				Role:           b.Role,
+				Access:         strings.TrimPrefix(b.AllowAccessState, "ALLOW_ACCESS_STATE_"),
+				RolePermission: b.RolePermission,
+				Relevance:      strings.TrimPrefix(b.Relevance, "HEURISTIC_RELEVANCE_"),
+				Condition:      b.Condition.expression(),
+				ConditionValue: b.ConditionExplanation.boolValue(),
+			}
+			for member, m := range b.Memberships {
+				if binding.Memberships == nil {
+					binding.Memberships = map[string]string{}
+				}
+				binding.Memberships[member] = m.Membership
+			}
+			policy.Bindings = append(policy.Bindings, binding)
+		}
+		explanation.Policies = append(explanation.Policies, policy)
+	}
+	for _, r := range v3.DenyPolicyExplanation.ExplainedResources {
+		for _, p := range r.ExplainedPolicies {
+			policy := explainedDenyPolicy{
+				Name:      p.Policy.Name,
+				Resource:  r.FullResourceName,
+				Access:    strings.TrimPrefix(p.DenyAccessState, "DENY_ACCESS_STATE_"),
+				Relevance: strings.TrimPrefix(p.Relevance, "HEURISTIC_RELEVANCE_"),
+			}
+			for _, rule := range p.RuleExplanations {
+				policy.Rules = append(policy.Rules, explainedDenyRule{
+					Access:              strings.TrimPrefix(rule.DenyAccessState, "DENY_ACCESS_STATE_"),
+					Relevance:           strings.TrimPrefix(rule.Relevance, "HEURISTIC_RELEVANCE_"),
+					PermissionDenied:    rule.CombinedDeniedPermission.PermissionMatchingState == "PERMISSION_PATTERN_MATCHED",
+					Condition:           rule.Condition.expression(),
+					ConditionValue:      rule.ConditionExplanation.boolValue(),
+					DeniedPrincipals:    matchedPrincipals(rule.DeniedPrincipals),
+					ExceptionPrincipals: matchedPrincipals(rule.ExceptionPrincipals),
+				})
+			}
+			explanation.DenyPolicies = append(explanation.DenyPolicies, policy)
+		}
+	}
+	return explanation, nil
+}
+
+func (e *v3Expr) expression() string {
+	if e == nil {
+		return ""
+	}
+	return e.Expression
+}
+
+// boolValue returns the value a condition evaluated to, or nil when it couldn't be evaluated.
+func (c *v3ConditionExplanation) boolValue() *bool {
+	if c == nil {
+		return nil
+	}
+	if b, ok := c.Value.(bool); ok {
+		return &b
+	}
+	return nil
+}
+
+// matchedPrincipals returns the principals whose membership matches the troubleshot principal.
+func matchedPrincipals(memberships map[string]v3Membership) []string {
+	var matched []string
+	for principal, m := range memberships {
+		if m.Membership == "MEMBERSHIP_MATCHED" {
+			matched = append(matched, principal)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// conditionSuffix renders a condition and, if known, the value the Troubleshooter evaluated it to.
+func conditionSuffix(condition string, value *bool) string {
+	if condition == "" {
+		return ""
+	}
+	s := " if " + condition
+	if value != nil {
+		s += fmt.Sprintf(" [evaluated to %t]", *value)
+	}
+	return s
+}
+
+// relevantLines renders the bindings and deny rules that decided the outcome: those that grant or
+// deny access, possibly subject to a condition, and those the Troubleshooter marked as highly
+// relevant.
+func (e *troubleshootExplanation) relevantLines() []string {
+	var lines []string
+	for _, p := range e.Policies {
+		for _, b := range p.Bindings {
+			if b.Access != allowGranted && b.Access != accessUnknownConditional && b.Relevance != "HIGH" {
+				continue
+			}
+			line := fmt.Sprintf("%s on %s: %s (%s", b.Role, p.Resource, b.Access, strings.ToLower(strings.TrimPrefix(b.RolePermission, "ROLE_PERMISSION_")))
+			var members []string
+			for member, membership := range b.Memberships {
+				if membership == "MEMBERSHIP_MATCHED" {
+					members = append(members, member)
+				}
+			}
+			sort.Strings(members)
+			if len(members) > 0 {
+				line += ", via " + strings.Join(members, ", ")
+			}
+			line += ")" + conditionSuffix(b.Condition, b.ConditionValue)
+			lines = append(lines, line)
+		}
+	}
+	for _, p := range e.DenyPolicies {
+		for _, r := range p.Rules {
+			if r.Access != denyDenied && r.Access != accessUnknownConditional && r.Relevance != "HIGH" {
+				continue
+			}
+			line := fmt.Sprintf("deny policy %s on %s: %s", p.Name, p.Resource, r.Access)
+			if len(r.DeniedPrincipals) > 0 {
+				line += " (via " + strings.Join(r.DeniedPrincipals, ", ") + ")"
+			}
+			if len(r.ExceptionPrincipals) > 0 {
+				line += " (excepted via " + strings.Join(r.ExceptionPrincipals, ", ") + ")"
+			}
+			line += conditionSuffix(r.Condition, r.ConditionValue)
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// checkPolicyTroubleshooter asks the Policy Troubleshooter whether the identity of the report's
+// KSA holds permission on the resource, and attaches its explanation to the report. The API only
+// explains access for Google accounts and service accounts, so KSAs that aren't annotated with a
+// GSA are skipped.
+func checkPolicyTroubleshooter(ctx context.Context, clients *gcpClients, report *ksaReport, resource, permission string) checkResult {
+	result := checkResult{
+		ID:       checkAccessTroubleshooter,
+		Title:    fmt.Sprintf("Asking the Policy Troubleshooter whether '%s' has '%s' on '%s'", report.GSA, permission, resource),
+		Severity: severityHigh,
+		DocLink:  docPolicyTroubleshooter,
+	}
+	if report.GSA == "" {
+		result.Title = "Asking the Policy Troubleshooter about the KSA principal"
+		result.Status = statusSkip
+		result.Severity = severityInfo
+		result.Message = "The Policy Troubleshooter only explains access for Google accounts and service accounts; the KSA is not annotated with a GSA."
+		return result
+	}
+
+	explanation, err := clients.troubleshooter.Troubleshoot(ctx, report.GSA, resource, permission)
+	if err != nil {
+		result.Status = statusSkip
+		result.Severity = severityInfo
+		result.Message = fmt.Sprintf("The Policy Troubleshooter could not be queried: %v", err)
+		return result
+	}
+	report.Troubleshooter = explanation
+
+	result.Evidence = map[string]string{"access": explanation.Access}
+	if len(explanation.Errors) > 0 {
+		result.Evidence["errors"] = strings.Join(explanation.Errors, "; ")
+	}
+	details := ""
+	if lines := explanation.relevantLines(); len(lines) > 0 {
+		details = "\n      - " + strings.Join(lines, "\n      - ")
+	}
+
+	switch explanation.Access {
+	case accessGranted:
+		result.Status = statusPass
+		result.Message = fmt.Sprintf("Granted. Relevant bindings:%s", details)
+	case accessUnknownConditional:
+		result.Status = statusWarn
+		result.Message = fmt.Sprintf("Granted only if a condition holds. Relevant bindings:%s", details)
+	case accessNotGranted:
+		result.Status = statusFail
+		result.Message = "Not granted." + details
+	default:
+		result.Status = statusWarn
+		result.Message = fmt.Sprintf("The Policy Troubleshooter could not reach a verdict (%s); the caller may lack permission to read some of the policies.%s", explanation.Access, details)
+	}
+	return result
+}
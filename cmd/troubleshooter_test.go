@@ -0,0 +1,188 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTroubleshooter returns a canned explanation.
+type fakeTroubleshooter struct {
+	explanation *troubleshootExplanation
+	err         error
+	calls       int
+}
+
+func (f *fakeTroubleshooter) Troubleshoot(ctx context.Context, principal, resource, permission string) (*troubleshootExplanation, error) {
+	f.calls++
+	return f.explanation, f.err
+}
+
+func TestRestPolicyTroubleshooter(t *testing.T) {
+	ctx := context.Background()
+	var got struct {
+		AccessTuple struct {
+			Principal        string `json:"principal"`
+			FullResourceName string `json:"fullResourceName"`
+			Permission       string `json:"permission"`
+		} `json:"accessTuple"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v3/iam:troubleshoot", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"overallAccessState": "CANNOT_ACCESS",
+			"errors": [{"message": "could not read organizations/9"}],
+			"allowPolicyExplanation": {
+				"allowAccessState": "ALLOW_ACCESS_STATE_GRANTED",
+				"explainedPolicies": [{
+					"fullResourceName": "//storage.googleapis.com/projects/_/buckets/assets",
+					"allowAccessState": "ALLOW_ACCESS_STATE_GRANTED",
+					"relevance": "HEURISTIC_RELEVANCE_HIGH",
+					"bindingExplanations": [{
+						"role": "roles/storage.objectViewer",
+						"allowAccessState": "ALLOW_ACCESS_STATE_GRANTED",
+						"rolePermission": "ROLE_PERMISSION_INCLUDED",
+						"relevance": "HEURISTIC_RELEVANCE_HIGH",
+						"condition": {"expression": "request.time < timestamp('2030-01-01T00:00:00Z')"},
+						"conditionExplanation": {"value": true},
+						"memberships": {"serviceAccount:app@test-project.iam.gserviceaccount.com": {"membership": "MEMBERSHIP_MATCHED", "relevance": "HEURISTIC_RELEVANCE_HIGH"}}
+					}]
+				}]
+			},
+			"denyPolicyExplanation": {
+				"denyAccessState": "DENY_ACCESS_STATE_DENIED",
+				"permissionDeniable": true,
+				"explainedResources": [{
+					"fullResourceName": "//cloudresourcemanager.googleapis.com/projects/test-project",
+					"denyAccessState": "DENY_ACCESS_STATE_DENIED",
+					"explainedPolicies": [{
+						"denyAccessState": "DENY_ACCESS_STATE_DENIED",
+						"relevance": "HEURISTIC_RELEVANCE_HIGH",
+						"policy": {"name": "policies/cloudresourcemanager.googleapis.com%2Fprojects%2Ftest-project/denypolicies/no-storage"},
+						"ruleExplanations": [{
+							"denyAccessState": "DENY_ACCESS_STATE_DENIED",
+							"relevance": "HEURISTIC_RELEVANCE_HIGH",
+							"combinedDeniedPermission": {"permissionMatchingState": "PERMISSION_PATTERN_MATCHED"},
+							"deniedPrincipals": {
+								"principalSet://goog/public:all": {"membership": "MEMBERSHIP_MATCHED"},
+								"principal://goog/subject/someone@example.com": {"membership": "MEMBERSHIP_NOT_MATCHED"}
+							},
+							"exceptionPrincipals": {"principal://iam.googleapis.com/projects/-/serviceAccounts/admin@test-project.iam.gserviceaccount.com": {"membership": "MEMBERSHIP_NOT_MATCHED"}},
+							"condition": {"expression": "resource.matchTag('123/env', 'prod')"}
+						}]
+					}]
+				}]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	client := &restPolicyTroubleshooter{client: server.Client(), endpoint: server.URL + "/"}
+	explanation, err := client.Troubleshoot(ctx, "app@test-project.iam.gserviceaccount.com", "//storage.googleapis.com/projects/_/buckets/assets", "storage.objects.get")
+	assert.NoError(t, err)
+	assert.Equal(t, "app@test-project.iam.gserviceaccount.com", got.AccessTuple.Principal)
+	assert.Equal(t, "//storage.googleapis.com/projects/_/buckets/assets", got.AccessTuple.FullResourceName)
+	assert.Equal(t, "storage.objects.get", got.AccessTuple.Permission)
+
+	granted := true
+	assert.Equal(t, accessNotGranted, explanation.Access)
+	assert.Equal(t, []string{"could not read organizations/9"}, explanation.Errors)
+	assert.Equal(t, []explainedPolicy{{
+		Resource:  "//storage.googleapis.com/projects/_/buckets/assets",
+		Access:    allowGranted,
+		Relevance: "HIGH",
+		Bindings: []explainedBinding{{
+			Role:           "roles/storage.objectViewer",
+			Access:         allowGranted,
+			RolePermission: "ROLE_PERMISSION_INCLUDED",
+			Relevance:      "HIGH",
+			Condition:      "request.time < timestamp('2030-01-01T00:00:00Z')",
+			ConditionValue: &granted,
+			Memberships:    map[string]string{"serviceAccount:app@test-project.iam.gserviceaccount.com": "MEMBERSHIP_MATCHED"},
+		}},
+	}}, explanation.Policies)
+	assert.Equal(t, []explainedDenyPolicy{{
+		Name:      "policies/cloudresourcemanager.googleapis.com%2Fprojects%2Ftest-project/denypolicies/no-storage",
+		Resource:  "//cloudresourcemanager.googleapis.com/projects/test-project",
+		Access:    denyDenied,
+		Relevance: "HIGH",
+		Rules: []explainedDenyRule{{
+			Access:           denyDenied,
+			Relevance:        "HIGH",
+			PermissionDenied: true,
+			Condition:        "resource.matchTag('123/env', 'prod')",
+			DeniedPrincipals: []string{"principalSet://goog/public:all"},
+		}},
+	}}, explanation.DenyPolicies)
+	assert.Equal(t, []string{
+		"roles/storage.objectViewer on //storage.googleapis.com/projects/_/buckets/assets: GRANTED (included, via serviceAccount:app@test-project.iam.gserviceaccount.com) if request.time < timestamp('2030-01-01T00:00:00Z') [evaluated to true]",
+		"deny policy policies/cloudresourcemanager.googleapis.com%2Fprojects%2Ftest-project/denypolicies/no-storage on //cloudresourcemanager.googleapis.com/projects/test-project: DENIED (via principalSet://goog/public:all) if resource.matchTag('123/env', 'prod')",
+	}, explanation.relevantLines())
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED"}}`))
+	})
+	_, err = client.Troubleshoot(ctx, "app@test-project.iam.gserviceaccount.com", "//storage.googleapis.com/projects/_/buckets/assets", "storage.objects.get")
+	assert.ErrorContains(t, err, "The caller does not have permission")
+}
+
+func TestCheckPolicyTroubleshooter(t *testing.T) {
+	ctx := context.Background()
+	gsa := "app@test-project.iam.gserviceaccount.com"
+	bucket := "//storage.googleapis.com/projects/_/buckets/assets"
+
+	tests := []struct {
+		name       string
+		gsa        string
+		fake       *fakeTroubleshooter
+		wantStatus checkStatus
+		wantCalls  int
+	}{
+		{"Granted", gsa, &fakeTroubleshooter{explanation: &troubleshootExplanation{Access: accessGranted}}, statusPass, 1},
+		{"Not granted", gsa, &fakeTroubleshooter{explanation: &troubleshootExplanation{Access: accessNotGranted}}, statusFail, 1},
+		{"Conditional", gsa, &fakeTroubleshooter{explanation: &troubleshootExplanation{Access: accessUnknownConditional}}, statusWarn, 1},
+		{"Info denied", gsa, &fakeTroubleshooter{explanation: &troubleshootExplanation{Access: accessUnknownInfo}}, statusWarn, 1},
+		{"API error", gsa, &fakeTroubleshooter{err: errors.New("permission denied")}, statusSkip, 1},
+		{"No GSA", "", &fakeTroubleshooter{}, statusSkip, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newKsaReport("test-cluster", "us-central1", "web", "frontend")
+			report.GSA = tt.gsa
+
+			result := checkPolicyTroubleshooter(ctx, &gcpClients{troubleshooter: tt.fake}, report, bucket, "storage.objects.get")
+			assert.Equal(t, checkAccessTroubleshooter, result.ID)
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantCalls, tt.fake.calls)
+			if tt.fake.explanation != nil {
+				assert.Equal(t, tt.fake.explanation, report.Troubleshooter)
+			}
+		})
+	}
+}
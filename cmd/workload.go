@@ -19,18 +19,25 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
 var (
-	workloadNamespace string
-	workloadType      string
+	workloadNamespace   string
+	workloadType        string
+	workloadCollectLogs bool
+	workloadLogsSince   time.Duration
 )
 
 // workloadCmd represents the workload command
@@ -48,14 +55,13 @@ var workloadCmd = &cobra.Command{
 		workloadName := args[0]
 		ctx := context.Background()
 
-		gkeClient, err := newGKEClient(ctx)
-
+		clients, err := newGCPClients(ctx)
 		if err != nil {
-			log.Fatalf("❌ Failed to create GKE client: %v", err)
+			log.Fatalf("❌ Failed to create Google Cloud clients: %v", err)
 		}
-		defer gkeClient.Close()
+		defer clients.Close()
 
-		cluster, err := getGKECluster(ctx, gkeClient, projectID, location, clusterName)
+		cluster, err := getGKECluster(ctx, clients.gke, projectID, location, clusterName)
 		if err != nil {
 			log.Fatalf("❌ Failed to get GKE cluster details: %v", err)
 		}
@@ -65,21 +71,48 @@ var workloadCmd = &cobra.Command{
 			log.Fatalf("❌ Failed to create Kubernetes clientset: %v", err)
 		}
 
-		ksaName, err := getKsaFromWorkload(ctx, clientset, workloadNamespace, workloadName, workloadType)
+		podSpec, err := getPodSpecFromWorkload(ctx, clientset, workloadNamespace, workloadName, workloadType)
 		if err != nil {
 			log.Fatalf("❌ Failed to get KSA from workload: %v", err)
 		}
+		ksaName := ksaFromPodSpec(*podSpec)
 
-		fmt.Printf("ℹ️ Workload '%s/%s' is using Kubernetes Service Account '%s'.\n\n", workloadNamespace, workloadName, ksaName)
+		workload := workloadRef{Kind: canonicalWorkloadKind(workloadType), Namespace: workloadNamespace, Name: workloadName}
+		if err := resolveWorkloadOwner(ctx, clientset, &workload); err != nil {
+			log.Printf("⚠️  Could not find the owner of workload %s: %v", workload, err)
+		}
 
-		if err := performKsaCheck(ctx, workloadNamespace, ksaName, cluster, clientset); err != nil {
+		report, err := performKsaCheck(ctx, clients, workloadNamespace, ksaName, cluster, clientset)
+		report.Workload = &workload
+		for _, c := range analyzePodSpec(cluster, podSpec) {
+			report.add(c)
+		}
+		report.add(checkMetadataServers(ctx, clientset, *report.Workload))
+		if workloadCollectLogs {
+			logsCheck, logs := collectMetadataServerLogs(ctx, clientset, *report.Workload, workloadLogsSince)
+			report.MetadataServerLogs = logs
+			report.add(logsCheck)
+		}
+		if outErr := writeOutput(os.Stdout, outputFormat, report); outErr != nil {
+			log.Fatalf("❌ Failed to write report: %v", outErr)
+		}
+		if err != nil {
 			log.Fatalf("❌ Check failed for KSA '%s': %v", ksaName, err)
 		}
 	},
 }
 
 func getKsaFromWorkload(ctx context.Context, clientset kubernetes.Interface, namespace, name, wType string) (string, error) {
-	var serviceAccountName string
+	podSpec, err := getPodSpecFromWorkload(ctx, clientset, namespace, name, wType)
+	if err != nil {
+		return "", err
+	}
+	return ksaFromPodSpec(*podSpec), nil
+}
+
+// getPodSpecFromWorkload returns the pod template spec of a workload.
+func getPodSpecFromWorkload(ctx context.Context, clientset kubernetes.Interface, namespace, name, wType string) (*corev1.PodSpec, error) {
+	var podSpec corev1.PodSpec
 	var err error
 
 	switch strings.ToLower(wType) {
@@ -87,50 +120,211 @@ func getKsaFromWorkload(ctx context.Context, clientset kubernetes.Interface, nam
 		var workload *appsv1.Deployment
 		workload, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err == nil {
-			serviceAccountName = workload.Spec.Template.Spec.ServiceAccountName
+			podSpec = workload.Spec.Template.Spec
 		}
 	case "statefulset", "sts":
 		var workload *appsv1.StatefulSet
 		workload, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err == nil {
-			serviceAccountName = workload.Spec.Template.Spec.ServiceAccountName
+			podSpec = workload.Spec.Template.Spec
 		}
 	case "daemonset", "ds":
 		var workload *appsv1.DaemonSet
 		workload, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err == nil {
-			serviceAccountName = workload.Spec.Template.Spec.ServiceAccountName
+			podSpec = workload.Spec.Template.Spec
+		}
+	case "replicaset", "rs":
+		var workload *appsv1.ReplicaSet
+		workload, err = clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			podSpec = workload.Spec.Template.Spec
 		}
 	case "job":
 		var workload *batchv1.Job
 		workload, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err == nil {
-			serviceAccountName = workload.Spec.Template.Spec.ServiceAccountName
+			podSpec = workload.Spec.Template.Spec
 		}
 	case "cronjob", "cj":
 		var workload *batchv1.CronJob
 		workload, err = clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err == nil {
-			serviceAccountName = workload.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName
+			podSpec = workload.Spec.JobTemplate.Spec.Template.Spec
+		}
+	case "pod", "po":
+		var pod *corev1.Pod
+		pod, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			podSpec = pod.Spec
 		}
 	default:
-		return "", fmt.Errorf("unsupported workload type '%s'", wType)
+		return nil, fmt.Errorf("unsupported workload type '%s'", wType)
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("could not get workload '%s/%s' of type '%s': %w", namespace, name, wType, err)
+		return nil, fmt.Errorf("could not get workload '%s/%s' of type '%s': %w", namespace, name, wType, err)
 	}
 
-	// If the service account is not specified in the pod spec, it defaults to "default".
-	if serviceAccountName == "" {
-		return "default", nil
+	return &podSpec, nil
+}
+
+// canonicalWorkloadKind maps a workload type or its short name to the lower-case kind.
+func canonicalWorkloadKind(wType string) string {
+	switch strings.ToLower(wType) {
+	case "deployment", "deploy":
+		return "deployment"
+	case "statefulset", "sts":
+		return "statefulset"
+	case "daemonset", "ds":
+		return "daemonset"
+	case "replicaset", "rs":
+		return "replicaset"
+	case "cronjob", "cj":
+		return "cronjob"
+	case "pod", "po":
+		return "pod"
+	}
+	return strings.ToLower(wType)
+}
+
+// topLevelOwner follows the controller references of an object in namespace up to the workload
+// that manages it: ReplicaSets lead to their Deployment and Jobs to their CronJob. It returns nil
+// for objects without a controller. cache, keyed by owner UID, saves lookups across the pods of
+// the same workload.
+func topLevelOwner(ctx context.Context, clientset kubernetes.Interface, namespace string, refs []metav1.OwnerReference, cache map[types.UID]*workloadRef) (*workloadRef, error) {
+	var owner *metav1.OwnerReference
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			owner = &refs[i]
+			break
+		}
+	}
+	if owner == nil {
+		return nil, nil
+	}
+	if w, ok := cache[owner.UID]; ok {
+		return w, nil
+	}
+
+	var parents []metav1.OwnerReference
+	var err error
+	switch owner.Kind {
+	case "ReplicaSet":
+		var rs *appsv1.ReplicaSet
+		if rs, err = clientset.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{}); err == nil {
+			parents = rs.OwnerReferences
+		}
+	case "Job":
+		var job *batchv1.Job
+		if job, err = clientset.BatchV1().Jobs(namespace).Get(ctx, owner.Name, metav1.GetOptions{}); err == nil {
+			parents = job.OwnerReferences
+		}
+	}
+	// An owner that is already gone is as far as the chain goes.
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get %s '%s/%s': %w", owner.Kind, namespace, owner.Name, err)
 	}
 
-	return serviceAccountName, nil
+	w := &workloadRef{Kind: strings.ToLower(owner.Kind), Namespace: namespace, Name: owner.Name}
+	parent, err := topLevelOwner(ctx, clientset, namespace, parents, cache)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		w = parent
+	}
+	cache[owner.UID] = w
+	return w, nil
+}
+
+// resolveWorkloadOwner records the workload that manages a pod or ReplicaSet as its owner, so
+// reports name both. Other kinds are left as they are.
+func resolveWorkloadOwner(ctx context.Context, clientset kubernetes.Interface, workload *workloadRef) error {
+	var refs []metav1.OwnerReference
+	switch canonicalWorkloadKind(workload.Kind) {
+	case "pod":
+		pod, err := clientset.CoreV1().Pods(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get pod '%s/%s': %w", workload.Namespace, workload.Name, err)
+		}
+		refs = pod.OwnerReferences
+	case "replicaset":
+		rs, err := clientset.AppsV1().ReplicaSets(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get ReplicaSet '%s/%s': %w", workload.Namespace, workload.Name, err)
+		}
+		refs = rs.OwnerReferences
+	default:
+		return nil
+	}
+	owner, err := topLevelOwner(ctx, clientset, workload.Namespace, refs, map[types.UID]*workloadRef{})
+	if err != nil {
+		return err
+	}
+	workload.Owner = owner
+	return nil
+}
+
+// podRunning reports whether a pod is scheduled and not finished.
+func podRunning(pod *corev1.Pod) bool {
+	return pod.Spec.NodeName != "" && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// workloadPods returns the pods of a workload that are scheduled and not finished. A pod belongs
+// to a workload that directly controls it, or that sits at the top of its chain of controllers.
+func workloadPods(ctx context.Context, clientset kubernetes.Interface, workload workloadRef) ([]corev1.Pod, error) {
+	kind := canonicalWorkloadKind(workload.Kind)
+	if kind == "pod" {
+		pod, err := clientset.CoreV1().Pods(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("could not get pod '%s/%s': %w", workload.Namespace, workload.Name, err)
+		}
+		if !podRunning(pod) {
+			return nil, nil
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+
+	pods, err := clientset.CoreV1().Pods(workload.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace '%s': %w", workload.Namespace, err)
+	}
+	cache := map[types.UID]*workloadRef{}
+	var matched []corev1.Pod
+	for _, pod := range pods.Items {
+		if !podRunning(&pod) {
+			continue
+		}
+		controller := metav1.GetControllerOfNoCopy(&pod)
+		if controller != nil && strings.ToLower(controller.Kind) == kind && controller.Name == workload.Name {
+			matched = append(matched, pod)
+			continue
+		}
+		owner, err := topLevelOwner(ctx, clientset, workload.Namespace, pod.OwnerReferences, cache)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil && owner.Kind == kind && owner.Name == workload.Name {
+			matched = append(matched, pod)
+		}
+	}
+	return matched, nil
+}
+
+// ksaFromPodSpec returns the KSA a pod spec runs as.
+func ksaFromPodSpec(spec corev1.PodSpec) string {
+	// If the service account is not specified in the pod spec, it defaults to "default".
+	if spec.ServiceAccountName == "" {
+		return "default"
+	}
+	return spec.ServiceAccountName
 }
 
 func init() {
 	checkCmd.AddCommand(workloadCmd)
 	workloadCmd.Flags().StringVarP(&workloadNamespace, "namespace", "n", "default", "Kubernetes namespace of the workload")
-	workloadCmd.Flags().StringVarP(&workloadType, "type", "t", "deployment", "Type of the workload (deployment, statefulset, daemonset, job, cronjob)")
+	workloadCmd.Flags().StringVarP(&workloadType, "type", "t", "deployment", "Type of the workload (deployment, statefulset, daemonset, replicaset, job, cronjob, pod)")
+	workloadCmd.Flags().BoolVar(&workloadCollectLogs, "collect-logs", false, "Search the gke-metadata-server logs on the workload's nodes for lines about its pods")
+	workloadCmd.Flags().DurationVar(&workloadLogsSince, "logs-since", time.Hour, "How far back to search the gke-metadata-server logs with --collect-logs")
 }
@@ -0,0 +1,151 @@
+/*
+Copyright 2025 Vishnu Udaikumar
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// controlledBy returns the owner references of an object controlled by kind/name.
+func controlledBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, UID: types.UID(kind + "/" + name), Controller: &controller}}
+}
+
+// scheduledPod returns a running pod in namespace web on node.
+func scheduledPod(name, node string, owners []metav1.OwnerReference) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web", OwnerReferences: owners},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestWorkloadPods(t *testing.T) {
+	ctx := context.Background()
+	finished := scheduledPod("frontend-old", "node-1", controlledBy("ReplicaSet", "frontend-1"))
+	finished.Status.Phase = corev1.PodSucceeded
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "frontend-1", Namespace: "web", OwnerReferences: controlledBy("Deployment", "frontend")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "frontend-2", Namespace: "web", OwnerReferences: controlledBy("Deployment", "frontend")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "backend-1", Namespace: "web", OwnerReferences: controlledBy("Deployment", "backend")}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "report-123", Namespace: "web", OwnerReferences: controlledBy("CronJob", "report")}},
+		scheduledPod("frontend-a", "node-1", controlledBy("ReplicaSet", "frontend-1")),
+		scheduledPod("frontend-b", "node-2", controlledBy("ReplicaSet", "frontend-2")),
+		scheduledPod("frontend-pending", "", controlledBy("ReplicaSet", "frontend-2")),
+		finished,
+		scheduledPod("backend-a", "node-1", controlledBy("ReplicaSet", "backend-1")),
+		scheduledPod("report-123-x", "node-3", controlledBy("Job", "report-123")),
+		scheduledPod("orphan-a", "node-3", controlledBy("ReplicaSet", "orphan-1")),
+		scheduledPod("debug", "node-3", nil),
+	)
+
+	names := func(workload workloadRef) []string {
+		pods, err := workloadPods(ctx, clientset, workload)
+		assert.NoError(t, err)
+		var names []string
+		for _, p := range pods {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"frontend-a", "frontend-b"}, names(workloadRef{Kind: "deploy", Namespace: "web", Name: "frontend"}))
+	assert.Equal(t, []string{"report-123-x"}, names(workloadRef{Kind: "cj", Namespace: "web", Name: "report"}))
+	// A ReplicaSet that no longer exists is as far up as the chain goes.
+	assert.Equal(t, []string{"orphan-a"}, names(workloadRef{Kind: "replicaset", Namespace: "web", Name: "orphan-1"}))
+	assert.Empty(t, names(workloadRef{Kind: "statefulset", Namespace: "web", Name: "frontend"}))
+
+	// The workload may also directly control its pods, even when something manages it in turn.
+	assert.Equal(t, []string{"frontend-b"}, names(workloadRef{Kind: "rs", Namespace: "web", Name: "frontend-2"}))
+	assert.Equal(t, []string{"report-123-x"}, names(workloadRef{Kind: "job", Namespace: "web", Name: "report-123"}))
+	assert.Equal(t, []string{"debug"}, names(workloadRef{Kind: "pod", Namespace: "web", Name: "debug"}))
+	assert.Empty(t, names(workloadRef{Kind: "po", Namespace: "web", Name: "frontend-old"}))
+}
+
+func TestPodAndReplicaSetWorkloads(t *testing.T) {
+	ctx := context.Background()
+	spec := corev1.PodSpec{ServiceAccountName: "app"}
+	bare := scheduledPod("debug", "node-1", nil)
+	bare.Spec.ServiceAccountName = "debugger"
+	managed := scheduledPod("frontend-1-abcde", "node-1", controlledBy("ReplicaSet", "frontend-1"))
+	managed.Spec.ServiceAccountName = "app"
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend-1", Namespace: "web", OwnerReferences: controlledBy("Deployment", "frontend")},
+			Spec:       appsv1.ReplicaSetSpec{Template: corev1.PodTemplateSpec{Spec: spec}},
+		},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "web"}},
+		managed,
+		bare,
+	)
+
+	ksa, err := getKsaFromWorkload(ctx, clientset, "web", "frontend-1", "rs")
+	assert.NoError(t, err)
+	assert.Equal(t, "app", ksa)
+	ksa, err = getKsaFromWorkload(ctx, clientset, "web", "debug", "pod")
+	assert.NoError(t, err)
+	assert.Equal(t, "debugger", ksa)
+	_, err = getKsaFromWorkload(ctx, clientset, "web", "missing", "pod")
+	assert.ErrorContains(t, err, "could not get workload 'web/missing' of type 'pod'")
+
+	// A pod names both itself and the Deployment at the top of its controllers.
+	pod := workloadRef{Kind: "pod", Namespace: "web", Name: "frontend-1-abcde"}
+	assert.NoError(t, resolveWorkloadOwner(ctx, clientset, &pod))
+	assert.Equal(t, &workloadRef{Kind: "deployment", Namespace: "web", Name: "frontend"}, pod.Owner)
+	assert.Equal(t, "'web/frontend-1-abcde' (pod, managed by deployment 'frontend')", pod.String())
+
+	rs := workloadRef{Kind: "replicaset", Namespace: "web", Name: "frontend-1"}
+	assert.NoError(t, resolveWorkloadOwner(ctx, clientset, &rs))
+	assert.Equal(t, "frontend", rs.Owner.Name)
+
+	for _, w := range []workloadRef{
+		{Kind: "pod", Namespace: "web", Name: "debug"},
+		{Kind: "replicaset", Namespace: "web", Name: "standalone"},
+		{Kind: "deployment", Namespace: "web", Name: "frontend"},
+	} {
+		assert.NoError(t, resolveWorkloadOwner(ctx, clientset, &w))
+		assert.Nil(t, w.Owner)
+	}
+	assert.Equal(t, "'web/debug' (pod)", workloadRef{Kind: "pod", Namespace: "web", Name: "debug"}.String())
+
+	missing := workloadRef{Kind: "pod", Namespace: "web", Name: "missing"}
+	assert.ErrorContains(t, resolveWorkloadOwner(ctx, clientset, &missing), "could not get pod 'web/missing'")
+}
+
+func TestCanonicalWorkloadKind(t *testing.T) {
+	tests := map[string]string{
+		"deploy":     "deployment",
+		"Deployment": "deployment",
+		"sts":        "statefulset",
+		"ds":         "daemonset",
+		"rs":         "replicaset",
+		"cj":         "cronjob",
+		"po":         "pod",
+		"Job":        "job",
+	}
+	for alias, kind := range tests {
+		assert.Equal(t, kind, canonicalWorkloadKind(alias), alias)
+	}
+}